@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dmh2000/talkers/internal/framing"
+)
+
+// DetectContentType returns the MIME type for a file, preferring its extension
+// and falling back to sniffing the data.
+func DetectContentType(path string, data []byte) string {
+	if ct := mime.TypeByExtension(filepath.Ext(path)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
+
+// SendFile sends the file at path to the client with ID to and returns the message
+// sent. Files that fit in one chunk travel as a single Message; larger files are
+// streamed in AttachmentChunkSize pieces.
+func (c *Client) SendFile(ctx context.Context, to, path string) (*Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > framing.MaxAttachmentSize {
+		return nil, fmt.Errorf("file is %d bytes, limit is %d", len(data), framing.MaxAttachmentSize)
+	}
+
+	msg := &Message{
+		From:        c.id,
+		To:          to,
+		ContentType: DetectContentType(path, data),
+		Data:        data,
+		Filename:    filepath.Base(path),
+	}
+
+	if len(data) <= framing.AttachmentChunkSize {
+		return msg, c.SendMessage(ctx, msg)
+	}
+
+	w := c.NewStream(ctx, to, msg)
+	for off := 0; off < len(data); off += framing.AttachmentChunkSize {
+		end := min(off+framing.AttachmentChunkSize, len(data))
+		if err = w.WriteData(data[off:end]); err != nil {
+			break
+		}
+	}
+	if closeErr := w.Close(err); err == nil {
+		err = closeErr
+	}
+	return msg, err
+}
+
+// SaveAttachment writes a received message's data into dir and returns the path.
+// The sender's file name is reduced to its base name, and a numeric suffix is added
+// rather than overwriting an existing file.
+func SaveAttachment(dir string, msg *Message) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(msg.Filename)
+	if name == "." || name == ".." || name == string(filepath.Separator) || name == "" {
+		name = "attachment-from-" + msg.From
+		if exts, _ := mime.ExtensionsByType(msg.ContentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		path := filepath.Join(dir, candidate)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(msg.Data); err != nil {
+			_ = f.Close()
+			return "", err
+		}
+		return path, f.Close()
+	}
+}
@@ -0,0 +1,445 @@
+// Package client is a Go SDK for talkers. It connects to a server, registers
+// a client ID, and sends and receives messages, streamed messages and
+// attachments. The command in cmd/client is built on it.
+//
+//	c, err := client.Dial(ctx, "127.0.0.1:4433", "bot", nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	for msg := range c.Messages() {
+//		_ = c.Send(ctx, msg.From, "echo: "+msg.Content)
+//	}
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/talkers/internal/framing"
+	pb "github.com/dmh2000/talkers/internal/proto"
+	"github.com/dmh2000/talkers/internal/transport"
+)
+
+// DefaultMessageBuffer is the capacity of the Messages channel when Options leaves it unset.
+const DefaultMessageBuffer = 16
+
+// eventBuffer is the capacity of the Events channel
+const eventBuffer = 16
+
+// Options configures a Client. The zero value is usable.
+type Options struct {
+	// Transport holds TLS and idle timeout settings. If nil, the server's
+	// self-signed certificate is accepted and framing.MaxIdleTimeout is used.
+	Transport *transport.Config
+
+	// Compression lists the compressions offered to the server in order of
+	// preference. If nil, every supported compression is offered.
+	Compression []string
+
+	// MessageBuffer is the capacity of the Messages channel (0 = DefaultMessageBuffer).
+	MessageBuffer int
+
+	// OnChunk, if set, is called with each piece of a streamed text message as it
+	// arrives, and once more with End set when the stream finishes or breaks off.
+	// The assembled message is still delivered on Messages. Calls for different
+	// streams may be concurrent.
+	OnChunk func(Chunk)
+}
+
+// Client is a registered connection to a talkers server. It is safe for concurrent use.
+type Client struct {
+	id          string
+	conn        transport.Conn
+	control     transport.Stream
+	compression framing.Compression
+	room        string
+	onChunk     func(Chunk)
+
+	messages chan *Message
+	events   chan Event
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// controlMu serializes writes to the control stream after registration
+	controlMu sync.Mutex
+
+	// turn is the floor control state; turnChanged is closed when it changes
+	turnMu      sync.Mutex
+	turn        Turn
+	turnChanged chan struct{}
+
+	// waiters holds a channel per outstanding Request, SendAcked, Ping or Roster, by ID
+	waitersMu sync.Mutex
+	waiters   map[string]chan reply
+
+	// order keeps each sender's messages in the order they were sent
+	order *receiveOrder
+
+	closeOnce sync.Once
+	done      chan struct{}
+	err       error // reason the connection ended, set before done is closed
+}
+
+// Dial connects to the server at addr ([scheme://]host:port) and registers as id.
+// It returns once the server has accepted the registration; a rejection, such as a
+// duplicate ID, is returned as an error carrying the server's message.
+func Dial(ctx context.Context, addr, id string, opts *Options) (*Client, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	cfg := opts.Transport
+	if cfg == nil {
+		cfg = &transport.Config{
+			TLS: &tls.Config{
+				InsecureSkipVerify: true, // Accept self-signed certificates
+				NextProtos:         []string{"talkers"},
+			},
+			IdleTimeout: framing.MaxIdleTimeout,
+		}
+	}
+	offered := opts.Compression
+	if offered == nil {
+		offered = framing.SupportedCompressions
+	}
+
+	// Dial the server over the transport named by the address scheme
+	conn, err := transport.Dial(ctx, addr, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+
+	// Open the bidirectional control stream
+	control, err := conn.OpenStream(ctx)
+	if err != nil {
+		_ = conn.Close("failed to open stream")
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+
+	// Send registration message
+	registerEnv := &pb.Envelope{
+		Payload: &pb.Envelope_Register{
+			Register: &pb.Register{
+				From:        id,
+				Compression: offered,
+			},
+		},
+	}
+	if err := framing.WriteEnvelope(control, registerEnv); err != nil {
+		_ = conn.Close("failed to register")
+		return nil, fmt.Errorf("failed to send registration: %w", err)
+	}
+
+	// Wait for the server to accept the registration, giving up when ctx ends
+	registered, err := awaitRegistered(ctx, control)
+	if err != nil {
+		_ = conn.Close("registration failed")
+		return nil, fmt.Errorf("registration failed: %w", err)
+	}
+	compression, ok := framing.ParseCompression(registered.GetCompression())
+	if !ok {
+		_ = conn.Close("registration failed")
+		return nil, fmt.Errorf("registration failed: server chose unsupported compression %q", registered.GetCompression())
+	}
+
+	buffer := opts.MessageBuffer
+	if buffer <= 0 {
+		buffer = DefaultMessageBuffer
+	}
+
+	c := &Client{
+		id:          id,
+		conn:        conn,
+		control:     control,
+		compression: compression,
+		onChunk:     opts.OnChunk,
+		messages:    make(chan *Message, buffer),
+		events:      make(chan Event, eventBuffer),
+		room:        registered.GetRoom(),
+		turn:        turnFromProto(registered.GetTurn()),
+		turnChanged: make(chan struct{}),
+		waiters:     make(map[string]chan reply),
+		order:       newReceiveOrder(),
+		done:        make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	loops := make(chan error, 2)
+	c.wg.Go(func() { loops <- c.controlLoop() })
+	c.wg.Go(func() { loops <- c.acceptLoop() })
+
+	// The first loop to stop ends the connection
+	go func() {
+		c.shutdown(<-loops)
+		c.wg.Wait()
+		close(c.messages)
+		close(c.events)
+	}()
+
+	return c, nil
+}
+
+// awaitRegistered reads the server's response to Register from the control
+// stream. The read is abandoned when ctx ends.
+func awaitRegistered(ctx context.Context, stream transport.Stream) (*pb.Registered, error) {
+	// Only ctx ending interrupts the read, so a failed read can report ctx's error
+	cancelled := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		_ = stream.SetReadDeadline(time.Now())
+		close(cancelled)
+	})
+	defer func() {
+		if !stop() {
+			<-cancelled
+		}
+		_ = stream.SetReadDeadline(time.Time{})
+	}()
+
+	env, err := framing.ReadEnvelope(stream)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	switch payload := env.Payload.(type) {
+	case *pb.Envelope_Registered:
+		return payload.Registered, nil
+	case *pb.Envelope_Error:
+		return nil, errors.New(payload.Error.GetError())
+	default:
+		return nil, fmt.Errorf("unexpected envelope type %T", env.Payload)
+	}
+}
+
+// ID returns the client ID this client registered as.
+func (c *Client) ID() string { return c.id }
+
+// Compression returns the compression negotiated with the server.
+func (c *Client) Compression() string { return c.compression.String() }
+
+// Room returns the name of the room the server hosts, empty if it has none.
+func (c *Client) Room() string { return c.room }
+
+// Messages returns the channel on which received messages are delivered. It is
+// closed once the connection ends. Receiving stops while the channel is full.
+func (c *Client) Messages() <-chan *Message { return c.messages }
+
+// Events returns the channel on which server errors, broken incoming streams,
+// clients joining and leaving, changes of turn and the end of the connection are
+// reported. It is closed after
+// the Disconnected event. Events that arrive while the channel is full are dropped.
+func (c *Client) Events() <-chan Event { return c.events }
+
+// Done returns a channel that is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err returns why the connection ended: nil while it is open or after a normal
+// close, otherwise the error that ended it.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close closes the connection and waits for the receive loops to exit.
+func (c *Client) Close() error {
+	c.shutdown(nil)
+	c.wg.Wait()
+	return nil
+}
+
+// shutdown ends the connection once, recording err as the reason
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		c.cancel()
+		_ = c.control.Close()
+		_ = c.conn.Close("client shutting down")
+		c.emit(Event{Type: EventDisconnected, Err: err})
+		close(c.done)
+	})
+}
+
+// emit delivers an event without blocking, dropping it if the channel is full
+func (c *Client) emit(ev Event) {
+	select {
+	case c.events <- ev:
+	default:
+	}
+}
+
+// Send sends a text message to the client with ID to.
+func (c *Client) Send(ctx context.Context, to, content string) error {
+	return c.SendMessage(ctx, &Message{To: to, Content: content})
+}
+
+// SendMessage sends msg as a single envelope on its own stream. The From field is
+// set by the server. Messages too large for one frame should be streamed with
+// NewStream or, for files, sent with SendFile.
+func (c *Client) SendMessage(ctx context.Context, msg *Message) error {
+	return c.sendWire(ctx, msg.proto(c.id))
+}
+
+// sendWire sends a wire message as a single envelope
+func (c *Client) sendWire(ctx context.Context, msg *pb.Message) error {
+	env := &pb.Envelope{
+		Payload: &pb.Envelope_Message{
+			Message: msg,
+		},
+	}
+	return c.sendEnvelope(ctx, env)
+}
+
+// sendEnvelope writes a single envelope on a new unidirectional stream and closes it.
+func (c *Client) sendEnvelope(ctx context.Context, env *pb.Envelope) error {
+	stream, err := c.conn.OpenUniStream(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to open message stream: %w", err)
+	}
+	if err := framing.WriteEnvelopeCompressed(stream, env, c.compression); err != nil {
+		stream.Cancel()
+		return err
+	}
+	return stream.Close()
+}
+
+// isClosedError reports whether err indicates a normal connection shutdown.
+func isClosedError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, transport.ErrClosed) {
+		return true
+	}
+	return strings.Contains(err.Error(), "Application error") ||
+		strings.Contains(err.Error(), "connection closed")
+}
+
+// controlLoop reads the control stream until it ends. Answers to requests, acks
+// and pongs go to the calls waiting for them; server errors, presence and changes
+// of turn are reported as events.
+func (c *Client) controlLoop() error {
+	reader := framing.NewFrameReader(c.control)
+	for {
+		env, err := reader.ReadEnvelope()
+		if err != nil {
+			// Handle EOF and connection closed gracefully
+			if c.ctx.Err() != nil || isClosedError(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to read envelope: %w", err)
+		}
+
+		switch payload := env.Payload.(type) {
+		case *pb.Envelope_Error:
+			serverErr := &ServerError{Message: payload.Error.GetError(), RequestID: payload.Error.GetRequestId()}
+			if serverErr.RequestID != "" && c.resolve(serverErr.RequestID, reply{err: serverErr}) {
+				continue
+			}
+			if ackID := payload.Error.GetAckId(); ackID != "" && c.resolve(ackID, reply{err: serverErr}) {
+				continue
+			}
+			c.emit(Event{Type: EventServerError, Err: serverErr})
+		case *pb.Envelope_Ack:
+			c.resolve(payload.Ack.GetAckId(), reply{})
+		case *pb.Envelope_Pong:
+			c.resolve(payload.Pong.GetId(), reply{})
+		case *pb.Envelope_Roster:
+			c.resolve(payload.Roster.GetId(), reply{clients: payload.Roster.GetClients()})
+		case *pb.Envelope_Presence:
+			ev := Event{Type: EventLeft, From: payload.Presence.GetClientId()}
+			if payload.Presence.GetOnline() {
+				ev.Type = EventJoined
+			}
+			c.emit(ev)
+		case *pb.Envelope_Turn:
+			turn := turnFromProto(payload.Turn)
+			if c.setTurn(turn) {
+				c.emit(Event{Type: EventTurn, From: turn.Holder, Turn: turn})
+			}
+		default:
+			c.emit(Event{Type: EventServerError, Err: fmt.Errorf("unexpected envelope type %T on control stream", env.Payload)})
+		}
+	}
+}
+
+// acceptLoop accepts unidirectional streams from the server and reads the message
+// each one carries. Streams are read concurrently so a large message does not
+// hold up smaller ones from other senders; each sender's messages are delivered
+// in the order it sent them.
+func (c *Client) acceptLoop() error {
+	for {
+		stream, err := c.conn.AcceptUniStream(c.ctx)
+		if err != nil {
+			if c.ctx.Err() != nil || isClosedError(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept message stream: %w", err)
+		}
+
+		c.wg.Go(func() {
+			msg, err := c.receive(stream)
+			if err != nil {
+				stream.Cancel()
+				c.order.finish(msg.From, msg.seq)
+				if c.ctx.Err() == nil {
+					c.emit(Event{Type: EventStreamError, From: msg.From, Err: err})
+				}
+				return
+			}
+
+			if !c.order.wait(c.ctx, msg.From, msg.seq) {
+				return
+			}
+			defer c.order.finish(msg.From, msg.seq)
+
+			// Replies go to the Request waiting for them
+			if msg.ReplyTo != "" && c.resolve(msg.ReplyTo, reply{msg: msg}) {
+				return
+			}
+
+			select {
+			case c.messages <- msg:
+			case <-c.ctx.Done():
+			}
+		})
+	}
+}
+
+// receive reads the Message or streamed message carried by stream. On error the
+// returned message is empty apart from the sender and sequence number, if known.
+func (c *Client) receive(stream transport.ReceiveStream) (*Message, error) {
+	reader := framing.NewFrameReader(stream)
+	env, err := reader.ReadEnvelope()
+	if err != nil {
+		return &Message{}, fmt.Errorf("failed to read message stream: %w", err)
+	}
+
+	switch payload := env.Payload.(type) {
+	case *pb.Envelope_Message:
+		c.order.arrive(payload.Message.GetFromId(), payload.Message.GetSeq())
+		return messageFromProto(payload.Message), nil
+	case *pb.Envelope_StreamStart:
+		start := payload.StreamStart
+		c.order.arrive(start.GetFromId(), start.GetSeq())
+		msg, err := receiveStream(reader, start, c.onChunk)
+		if err != nil {
+			return &Message{From: start.GetFromId(), seq: start.GetSeq()}, fmt.Errorf("streamed message from %s failed: %w", start.GetFromId(), err)
+		}
+		return msg, nil
+	default:
+		return &Message{}, fmt.Errorf("unexpected envelope type %T on message stream", env.Payload)
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmh2000/talkers/internal/framing"
+	pb "github.com/dmh2000/talkers/internal/proto"
+)
+
+// writeControl writes an envelope to the control stream
+func (c *Client) writeControl(env *pb.Envelope) error {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	return framing.WriteEnvelopeCompressed(c.control, env, c.compression)
+}
+
+// Ping checks that the server is responsive and returns the round-trip time.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	id := newStreamID()
+	ch, cancel := c.expect(id)
+	defer cancel()
+
+	sent := time.Now()
+	env := &pb.Envelope{
+		Payload: &pb.Envelope_Ping{
+			Ping: &pb.Ping{
+				Id: id,
+			},
+		},
+	}
+	if err := c.writeControl(env); err != nil {
+		return 0, err
+	}
+	if _, err := c.await(ctx, ch); err != nil {
+		return 0, err
+	}
+	return time.Since(sent), nil
+}
+
+// SendAcked sends msg like SendMessage and waits until the server has delivered
+// it to the recipient. A message the server cannot deliver, for example to an
+// unknown recipient, returns the server's error rather than an EventServerError.
+func (c *Client) SendAcked(ctx context.Context, msg *Message) error {
+	id := newStreamID()
+	ch, cancel := c.expect(id)
+	defer cancel()
+
+	wire := msg.proto(c.id)
+	wire.AckId = id
+	if err := c.sendWire(ctx, wire); err != nil {
+		return err
+	}
+	_, err := c.await(ctx, ch)
+	return err
+}
+
+// Roster returns the IDs of the clients connected to the server, sorted. It
+// includes this client.
+func (c *Client) Roster(ctx context.Context) ([]string, error) {
+	id := newStreamID()
+	ch, cancel := c.expect(id)
+	defer cancel()
+
+	env := &pb.Envelope{
+		Payload: &pb.Envelope_RosterRequest{
+			RosterRequest: &pb.RosterRequest{
+				Id: id,
+			},
+		},
+	}
+	if err := c.writeControl(env); err != nil {
+		return nil, err
+	}
+	r, err := c.await(ctx, ch)
+	if err != nil {
+		return nil, err
+	}
+	return r.clients, nil
+}
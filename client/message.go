@@ -0,0 +1,194 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	errs "github.com/dmh2000/talkers/internal/errors"
+	pb "github.com/dmh2000/talkers/internal/proto"
+)
+
+// ContentTypeJSON marks a message whose Content is JSON, such as a structured AI
+// reply, rather than plain text.
+const ContentTypeJSON = "application/json"
+
+// Message is a message sent to or received from another client. A message with
+// Data carries an attachment; Content may accompany it as a caption.
+type Message struct {
+	From        string
+	To          string
+	Content     string
+	ContentType string // MIME type of Data, or a content type for Content
+	Data        []byte
+	Filename    string
+	Metadata    map[string]string
+
+	// RequestID is set on a request that expects a reply; answer it with Reply
+	RequestID string
+	// ReplyTo is the RequestID of the request this message answers
+	ReplyTo string
+
+	// StreamID is set on received messages that arrived as a stream
+	StreamID string
+
+	// seq is the server's number for a received message, in its sender's order
+	seq uint64
+}
+
+// IsRequest reports whether the sender is waiting for a reply.
+func (m *Message) IsRequest() bool {
+	return m.RequestID != ""
+}
+
+// IsAttachment reports whether the message carries binary data.
+func (m *Message) IsAttachment() bool {
+	return len(m.Data) > 0
+}
+
+// IsJSON reports whether the message's Content is JSON.
+func (m *Message) IsJSON() bool {
+	return m.ContentType == ContentTypeJSON && !m.IsAttachment()
+}
+
+// Mentions reports whether the content mentions id as @id, as a whole word.
+func (m *Message) Mentions(id string) bool {
+	if id == "" {
+		return false
+	}
+	mention := "@" + id
+	content := m.Content
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], mention)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(mention)
+		if (start == 0 || !isIDByte(content[start-1])) && (end == len(content) || !isIDByte(content[end])) {
+			return true
+		}
+		offset = end
+	}
+}
+
+// isIDByte reports whether b can be part of a client ID in a mention
+func isIDByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || b == '_' || b == '-'
+}
+
+// proto converts the message to its wire form, sent from id
+func (m *Message) proto(id string) *pb.Message {
+	return &pb.Message{
+		FromId:      id,
+		ToId:        m.To,
+		Content:     m.Content,
+		ContentType: m.ContentType,
+		Data:        m.Data,
+		Filename:    m.Filename,
+		Metadata:    m.Metadata,
+		RequestId:   m.RequestID,
+		ReplyTo:     m.ReplyTo,
+	}
+}
+
+// messageFromProto converts a received wire message
+func messageFromProto(msg *pb.Message) *Message {
+	return &Message{
+		From:        msg.GetFromId(),
+		To:          msg.GetToId(),
+		Content:     msg.GetContent(),
+		ContentType: msg.GetContentType(),
+		Data:        msg.GetData(),
+		Filename:    msg.GetFilename(),
+		Metadata:    msg.GetMetadata(),
+		RequestID:   msg.GetRequestId(),
+		ReplyTo:     msg.GetReplyTo(),
+		seq:         msg.GetSeq(),
+	}
+}
+
+// Chunk is a piece of a streamed text message passed to Options.OnChunk.
+type Chunk struct {
+	StreamID string
+	From     string
+	Content  string
+
+	// End is set on the final call for a stream, with Err set if it broke off
+	End bool
+	Err error
+}
+
+// EventType identifies the kind of an Event.
+type EventType int
+
+const (
+	// EventServerError reports an error sent by the server, such as an unknown
+	// recipient. Err is a *ServerError. The connection stays open.
+	EventServerError EventType = iota
+
+	// EventStreamError reports an incoming message that could not be read, such
+	// as a streamed message that broke off. From is the sender, if known.
+	EventStreamError
+
+	// EventDisconnected reports that the connection ended. Err is nil after Close
+	// or a normal server shutdown.
+	EventDisconnected
+
+	// EventTurn reports a change of turn under floor control. Turn is the new turn.
+	EventTurn
+
+	// EventJoined reports that the client From registered with the server.
+	EventJoined
+
+	// EventLeft reports that the client From disconnected.
+	EventLeft
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventServerError:
+		return "server error"
+	case EventStreamError:
+		return "stream error"
+	case EventDisconnected:
+		return "disconnected"
+	case EventTurn:
+		return "turn"
+	case EventJoined:
+		return "joined"
+	case EventLeft:
+		return "left"
+	default:
+		return fmt.Sprintf("event(%d)", int(t))
+	}
+}
+
+// Event is a notable occurrence on a connection other than a received message.
+type Event struct {
+	Type EventType
+	From string
+	Err  error
+	Turn Turn
+}
+
+// ServerError is an error reported by the server on the control stream.
+// Message is one of the error strings in internal/errors. RequestID is set when
+// the error concerns a request.
+type ServerError struct {
+	Message   string
+	RequestID string
+}
+
+func (e *ServerError) Error() string { return e.Message }
+
+// Is reports whether target is the sentinel error for e, so that
+// errors.Is(err, ErrNotYourTurn) matches a rejection by floor control.
+func (e *ServerError) Is(target error) bool {
+	switch target {
+	case ErrNotYourTurn:
+		return e.Message == errs.ErrNotYourTurn
+	case ErrCannotPassTurn:
+		return e.Message == errs.ErrCannotPassTurn
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// orderGapTimeout is how long delivery waits for a message whose number was
+// skipped and whose stream has not arrived. The server only skips a number when
+// delivering that message failed, so the wait is a safeguard, not a delay in
+// normal operation.
+const orderGapTimeout = 10 * time.Second
+
+// receiveOrder delivers the messages from each sender in the order the server
+// numbered them. Streams are read concurrently, so a message may be ready before
+// the ones sent ahead of it; it waits until they have been delivered or failed.
+type receiveOrder struct {
+	mu      sync.Mutex
+	senders map[string]*senderOrder
+	changed chan struct{} // closed and replaced when any sender's order moves on
+}
+
+// senderOrder is the delivery state of one sender's messages
+type senderOrder struct {
+	last    uint64          // every message numbered up to last is finished
+	arrived map[uint64]bool // messages being received, by number
+	done    map[uint64]bool // messages finished ahead of their turn, by number
+}
+
+func newReceiveOrder() *receiveOrder {
+	return &receiveOrder{
+		senders: make(map[string]*senderOrder),
+		changed: make(chan struct{}),
+	}
+}
+
+// sender returns the state of from's messages; o.mu must be held
+func (o *receiveOrder) sender(from string) *senderOrder {
+	s, ok := o.senders[from]
+	if !ok {
+		s = &senderOrder{arrived: make(map[uint64]bool), done: make(map[uint64]bool)}
+		o.senders[from] = s
+	}
+	return s
+}
+
+// arrive records that the message numbered seq from from is being received.
+// Unnumbered messages (seq 0) are not ordered.
+func (o *receiveOrder) arrive(from string, seq uint64) {
+	if seq == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sender(from).arrived[seq] = true
+}
+
+// wait blocks until every message from from numbered before seq has finished.
+// A missing number whose message has not arrived within orderGapTimeout is
+// skipped. It reports false if ctx ends first.
+func (o *receiveOrder) wait(ctx context.Context, from string, seq uint64) bool {
+	if seq == 0 {
+		return true
+	}
+
+	var gap <-chan time.Time
+	for {
+		o.mu.Lock()
+		s, changed := o.sender(from), o.changed
+		next := s.last + 1
+		if next >= seq {
+			o.mu.Unlock()
+			return true
+		}
+		missing := !s.arrived[next] && !s.done[next]
+		o.mu.Unlock()
+
+		if missing && gap == nil {
+			timer := time.NewTimer(orderGapTimeout)
+			defer timer.Stop()
+			gap = timer.C
+		}
+
+		select {
+		case <-changed:
+		case <-gap:
+			o.skip(from, seq)
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// skip gives up on the missing messages from from numbered before seq
+func (o *receiveOrder) skip(from string, seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.sender(from)
+	for s.last+1 < seq && !s.arrived[s.last+1] {
+		s.last++
+	}
+	o.advance(s)
+}
+
+// finish records that the message numbered seq from from has been delivered or
+// has failed, letting the ones after it through
+func (o *receiveOrder) finish(from string, seq uint64) {
+	if seq == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.sender(from)
+	delete(s.arrived, seq)
+	if seq > s.last {
+		s.done[seq] = true
+	}
+	o.advance(s)
+}
+
+// advance moves s past messages finished ahead of their turn and wakes the
+// waiters; o.mu must be held
+func (o *receiveOrder) advance(s *senderOrder) {
+	for s.done[s.last+1] {
+		delete(s.done, s.last+1)
+		s.last++
+	}
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	errs "github.com/dmh2000/talkers/internal/errors"
+)
+
+// ErrRequestTimeout is returned by Request when no reply arrives within the timeout.
+var ErrRequestTimeout = errors.New(errs.ErrRequestTimeout)
+
+// ErrPeerUnreachable is returned by Request when the peer disconnects before replying.
+var ErrPeerUnreachable = errors.New(errs.ErrPeerUnreachable)
+
+// ErrClosed is returned by Request when this client's connection ends first.
+var ErrClosed = errors.New("client: connection closed")
+
+// requestGrace is how long past its timeout a Request waits for the server's
+// timeout notice before giving up on its own
+const requestGrace = time.Second
+
+// reply is the outcome of a Request
+type reply struct {
+	msg     *Message
+	clients []string // answer to a Roster
+	err     error
+}
+
+// Request sends content to the client with ID to and waits for its reply. The
+// server reports ErrRequestTimeout if the peer does not answer within timeout,
+// and ErrPeerUnreachable if it disconnects first. A timeout of zero uses the
+// server's default.
+func (c *Client) Request(ctx context.Context, to, content string, timeout time.Duration) (*Message, error) {
+	return c.RequestMessage(ctx, &Message{To: to, Content: content}, timeout)
+}
+
+// RequestMessage is like Request but sends msg, which may carry an attachment.
+// Its RequestID is replaced with a new one.
+func (c *Client) RequestMessage(ctx context.Context, msg *Message, timeout time.Duration) (*Message, error) {
+	id := newStreamID()
+	ch, cancel := c.expect(id)
+	defer cancel()
+
+	req := *msg
+	req.RequestID = id
+	wire := req.proto(c.id)
+	wire.TimeoutMs = uint32(min(timeout.Milliseconds(), math.MaxUint32))
+	if err := c.sendWire(ctx, wire); err != nil {
+		return nil, err
+	}
+
+	// Give up on our own if the server's timeout notice never comes
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout + requestGrace)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case r := <-ch:
+		return r.msg, r.err
+	case <-expired:
+		return nil, ErrRequestTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, ErrClosed
+	}
+}
+
+// Reply answers the request req with content.
+func (c *Client) Reply(ctx context.Context, req *Message, content string) error {
+	return c.SendMessage(ctx, &Message{To: req.From, Content: content, ReplyTo: req.RequestID})
+}
+
+// expect registers a waiter for the answer to id, whether a reply, an Ack, a
+// Pong or a Roster. The returned func removes it.
+func (c *Client) expect(id string) (chan reply, func()) {
+	ch := make(chan reply, 1)
+	c.waitersMu.Lock()
+	c.waiters[id] = ch
+	c.waitersMu.Unlock()
+	return ch, func() {
+		c.waitersMu.Lock()
+		delete(c.waiters, id)
+		c.waitersMu.Unlock()
+	}
+}
+
+// await waits for the answer on ch
+func (c *Client) await(ctx context.Context, ch chan reply) (reply, error) {
+	select {
+	case r := <-ch:
+		return r, r.err
+	case <-ctx.Done():
+		return reply{}, ctx.Err()
+	case <-c.done:
+		return reply{}, ErrClosed
+	}
+}
+
+// resolve completes the Request, SendAcked, Ping or Roster waiting on id. It reports
+// whether one was waiting.
+func (c *Client) resolve(id string, r reply) bool {
+	c.waitersMu.Lock()
+	ch, exists := c.waiters[id]
+	delete(c.waiters, id)
+	c.waitersMu.Unlock()
+	if !exists {
+		return false
+	}
+
+	// Map the server's request errors to the sentinel errors
+	var serverErr *ServerError
+	if errors.As(r.err, &serverErr) {
+		switch serverErr.Message {
+		case errs.ErrRequestTimeout:
+			r.err = ErrRequestTimeout
+		case errs.ErrPeerUnreachable:
+			r.err = ErrPeerUnreachable
+		}
+	}
+
+	ch <- r
+	return true
+}
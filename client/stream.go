@@ -0,0 +1,186 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/dmh2000/talkers/internal/framing"
+	pb "github.com/dmh2000/talkers/internal/proto"
+	"github.com/dmh2000/talkers/internal/transport"
+)
+
+// newStreamID returns a random identifier for an outgoing streamed message
+func newStreamID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// isAttachmentStream reports whether a stream carries binary data rather than text.
+// JSON content is text.
+func isAttachmentStream(start *pb.StreamStart) bool {
+	return start.ContentType != "" && start.ContentType != ContentTypeJSON || start.Filename != ""
+}
+
+// receiveStream reads the rest of a streamed message that began with start and
+// returns the assembled message once StreamEnd arrives. Text chunks are passed to
+// onChunk, if set, as they arrive; attachment data is only collected.
+func receiveStream(reader *framing.FrameReader, start *pb.StreamStart, onChunk func(Chunk)) (*Message, error) {
+	attachment := isAttachmentStream(start)
+	notify := func(chunk Chunk) {
+		if onChunk != nil && !attachment {
+			chunk.StreamID, chunk.From = start.StreamId, start.FromId
+			onChunk(chunk)
+		}
+	}
+
+	var content strings.Builder
+	var data []byte
+	for {
+		env, err := reader.ReadEnvelope()
+		if err != nil {
+			notify(Chunk{End: true, Err: err})
+			return nil, err
+		}
+
+		switch payload := env.Payload.(type) {
+		case *pb.Envelope_StreamChunk:
+			content.WriteString(payload.StreamChunk.Content)
+			data = append(data, payload.StreamChunk.Data...)
+			if len(data) > framing.MaxAttachmentSize {
+				err := fmt.Errorf("attachment in stream %s exceeds %d bytes", start.StreamId, framing.MaxAttachmentSize)
+				notify(Chunk{End: true, Err: err})
+				return nil, err
+			}
+			notify(Chunk{Content: payload.StreamChunk.Content})
+		case *pb.Envelope_StreamEnd:
+			notify(Chunk{End: true})
+			return &Message{
+				From:        start.FromId,
+				To:          start.ToId,
+				Content:     content.String(),
+				ContentType: start.ContentType,
+				Data:        data,
+				Filename:    start.Filename,
+				Metadata:    start.Metadata,
+				RequestID:   start.RequestId,
+				ReplyTo:     start.ReplyTo,
+				StreamID:    start.StreamId,
+				seq:         start.Seq,
+			}, nil
+		default:
+			err := fmt.Errorf("unexpected envelope in stream %s", start.StreamId)
+			notify(Chunk{End: true, Err: err})
+			return nil, err
+		}
+	}
+}
+
+// StreamWriter sends a message to a peer as a stream of chunks, which the server
+// forwards as they arrive. The underlying stream is opened on the first chunk, so
+// an empty message sends nothing. A StreamWriter is not safe for concurrent use.
+type StreamWriter struct {
+	ctx    context.Context
+	client *Client
+	start  *pb.StreamStart
+	stream transport.SendStream
+	writer *framing.FrameWriter
+}
+
+// NewStream prepares a streamed message to the client with ID to. Text is sent
+// with Write and binary data with WriteData; Close finishes the message.
+// ContentType, Filename and Metadata, if set on attrs, describe an attachment, or
+// ContentTypeJSON marks JSON text; ReplyTo makes the stream the reply to a request.
+func (c *Client) NewStream(ctx context.Context, to string, attrs *Message) *StreamWriter {
+	start := &pb.StreamStart{
+		StreamId: newStreamID(),
+		FromId:   c.id,
+		ToId:     to,
+	}
+	if attrs != nil {
+		start.ContentType = attrs.ContentType
+		start.Filename = attrs.Filename
+		start.Metadata = attrs.Metadata
+		start.ReplyTo = attrs.ReplyTo
+	}
+	return &StreamWriter{
+		ctx:    ctx,
+		client: c,
+		start:  start,
+	}
+}
+
+// StreamID returns the identifier of the streamed message.
+func (w *StreamWriter) StreamID() string { return w.start.StreamId }
+
+// Write sends the next piece of text
+func (w *StreamWriter) Write(chunk string) error {
+	return w.writeChunk(&pb.StreamChunk{
+		StreamId: w.start.StreamId,
+		Content:  chunk,
+	})
+}
+
+// WriteData sends the next piece of binary data
+func (w *StreamWriter) WriteData(data []byte) error {
+	return w.writeChunk(&pb.StreamChunk{
+		StreamId: w.start.StreamId,
+		Data:     data,
+	})
+}
+
+// writeChunk sends a chunk, opening the stream and sending StreamStart if needed
+func (w *StreamWriter) writeChunk(chunk *pb.StreamChunk) error {
+	if w.stream == nil {
+		stream, err := w.client.conn.OpenUniStream(w.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to open message stream: %w", err)
+		}
+		w.stream = stream
+		w.writer = framing.NewFrameWriter(stream, w.client.compression)
+
+		startEnv := &pb.Envelope{
+			Payload: &pb.Envelope_StreamStart{
+				StreamStart: w.start,
+			},
+		}
+		if err := w.writer.WriteEnvelope(startEnv); err != nil {
+			return err
+		}
+	}
+
+	chunkEnv := &pb.Envelope{
+		Payload: &pb.Envelope_StreamChunk{
+			StreamChunk: chunk,
+		},
+	}
+	return w.writer.WriteEnvelope(chunkEnv)
+}
+
+// Close sends StreamEnd and closes the stream. If err is non-nil the stream is
+// reset instead so the recipient sees the message as interrupted.
+func (w *StreamWriter) Close(err error) error {
+	if w.stream == nil {
+		return nil
+	}
+	if err != nil {
+		w.stream.Cancel()
+		return nil
+	}
+
+	endEnv := &pb.Envelope{
+		Payload: &pb.Envelope_StreamEnd{
+			StreamEnd: &pb.StreamEnd{
+				StreamId: w.start.StreamId,
+			},
+		},
+	}
+	if err := w.writer.WriteEnvelope(endEnv); err != nil {
+		w.stream.Cancel()
+		return err
+	}
+	return w.stream.Close()
+}
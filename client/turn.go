@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	errs "github.com/dmh2000/talkers/internal/errors"
+	pb "github.com/dmh2000/talkers/internal/proto"
+)
+
+// ErrNotYourTurn matches, with errors.Is, the ServerError reported when the server
+// rejects a message because another client holds the turn.
+var ErrNotYourTurn = errors.New(errs.ErrNotYourTurn)
+
+// ErrCannotPassTurn matches, with errors.Is, the ServerError reported when the
+// server rejects a PassTurn, such as one naming an unknown client.
+var ErrCannotPassTurn = errors.New(errs.ErrCannotPassTurn)
+
+// ErrNoFloorControl is returned by PassTurn when the server does not run floor control.
+var ErrNoFloorControl = errors.New(errs.ErrNoFloorControl)
+
+// Floor control modes reported in Turn.Mode.
+const (
+	FloorRoundRobin = "round-robin"
+	FloorToken      = "token"
+	FloorModerated  = "moderated"
+)
+
+// Turn is the state of floor control on the server. When the server runs floor
+// control it only accepts messages from the client the turn allows.
+type Turn struct {
+	// Mode is the floor control mode, empty if the server does not run floor control
+	Mode string
+
+	// Holder is the client that holds the turn. It is empty when the floor is
+	// free, so that the next client to send takes the turn, or in moderated mode
+	// when the floor is with the moderator.
+	Holder string
+
+	// Moderator is the moderator's client ID in moderated mode
+	Moderator string
+
+	// Number increases with every change of turn
+	Number uint64
+}
+
+// Allows reports whether the client with ID id may send during the turn.
+func (t Turn) Allows(id string) bool {
+	switch {
+	case t.Mode == "" || t.Holder == id:
+		return true
+	case t.Mode == FloorModerated:
+		return id == t.Moderator
+	default:
+		return t.Holder == ""
+	}
+}
+
+// turnFromProto converts a wire turn; nil gives the zero Turn of an open floor
+func turnFromProto(turn *pb.Turn) Turn {
+	return Turn{
+		Mode:      turn.GetMode(),
+		Holder:    turn.GetHolder(),
+		Moderator: turn.GetModerator(),
+		Number:    turn.GetNumber(),
+	}
+}
+
+// Turn returns the current state of floor control.
+func (c *Client) Turn() Turn {
+	c.turnMu.Lock()
+	defer c.turnMu.Unlock()
+	return c.turn
+}
+
+// HasTurn reports whether this client may send now.
+func (c *Client) HasTurn() bool {
+	return c.Turn().Allows(c.id)
+}
+
+// TurnChanged returns a channel that is closed at the next change of turn.
+func (c *Client) TurnChanged() <-chan struct{} {
+	c.turnMu.Lock()
+	defer c.turnMu.Unlock()
+	return c.turnChanged
+}
+
+// WaitTurn blocks until this client may send. It returns at once if the server
+// does not run floor control.
+func (c *Client) WaitTurn(ctx context.Context) error {
+	for {
+		c.turnMu.Lock()
+		turn, changed := c.turn, c.turnChanged
+		c.turnMu.Unlock()
+		if turn.Allows(c.id) {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return ErrClosed
+		}
+	}
+}
+
+// PassTurn passes the turn this client holds to the client with ID to, or with
+// to empty to the next client in turn order. In round-robin mode only the next
+// client may be chosen; in moderated mode the moderator grants the turn to any
+// client, and the holder may only hand it back. The server reports a rejected
+// pass as an EventServerError; a pass of a turn that has already moved on is
+// ignored.
+func (c *Client) PassTurn(to string) error {
+	turn := c.Turn()
+	if turn.Mode == "" {
+		return ErrNoFloorControl
+	}
+	env := &pb.Envelope{
+		Payload: &pb.Envelope_Turn{
+			Turn: &pb.Turn{
+				Holder: to,
+				Number: turn.Number,
+			},
+		},
+	}
+	return c.writeControl(env)
+}
+
+// setTurn records a turn announced by the server. The server may send the
+// notifications of successive turns out of order, so one whose Number is not
+// above the current turn's is stale and ignored. It reports whether the turn changed.
+func (c *Client) setTurn(turn Turn) bool {
+	c.turnMu.Lock()
+	defer c.turnMu.Unlock()
+	if turn.Number <= c.turn.Number {
+		return false
+	}
+	c.turn = turn
+	close(c.turnChanged)
+	c.turnChanged = make(chan struct{})
+	return true
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/ai"
+	"github.com/dmh2000/talkers/internal/profile"
+)
+
+// terminalAgent is an agent run from the terminal: its messages and replies are
+// printed, its drafts are reviewed by the operator, and input lines are routed to it
+type terminalAgent struct {
+	*agent.Agent
+	label     string    // names the agent on a shared terminal; empty when it runs alone
+	out       *printer  // shared by every agent
+	approver  *approver // set in approval mode
+	writeChan chan string
+
+	echoing bool // an AI reply is being printed; used only by the reply loop
+}
+
+// newTerminalAgent builds the agent for p, printing through out
+func newTerminalAgent(p profile.Profile, label string, out *printer) (*terminalAgent, error) {
+	t := &terminalAgent{label: label, out: out, writeChan: make(chan string, 16)}
+	hooks := agent.Hooks{
+		OnMessage:    t.show,
+		OnReplyChunk: t.echo,
+		OnToolCall:   t.showToolCall,
+		Logf:         t.logf,
+	}
+	if p.Reply.Approve {
+		t.approver = &approver{timeout: p.Reply.ApproveTimeout, label: label}
+		hooks.Review = t.approver.review
+	}
+
+	a, err := agent.New(p, hooks)
+	if err != nil {
+		return nil, err
+	}
+	t.Agent = a
+	return t, nil
+}
+
+// start connects the agent and starts its event and write loops alongside its own.
+// A server error or the end of the connection is passed to done.
+func (t *terminalAgent) start(ctx context.Context, done chan<- error) error {
+	// Streamed messages are rendered as their chunks arrive
+	onChunk := func(ch client.Chunk) { t.out.streamChunk(t.label, ch) }
+	if err := t.Start(ctx, &client.Options{OnChunk: onChunk}); err != nil {
+		return err
+	}
+	go eventLoop(t, done)
+	go writeLoop(ctx, t)
+	return nil
+}
+
+// show displays a received message and saves its attachment. Streamed text has
+// already been rendered chunk by chunk.
+func (t *terminalAgent) show(msg *client.Message) {
+	switch {
+	case msg.IsAttachment():
+		path, err := client.SaveAttachment(t.Profile().Attachments, msg)
+		if err != nil {
+			t.logf("Error: failed to save attachment from %s: %v", msg.From, err)
+			return
+		}
+		t.out.message(t.label, msg.From, fmt.Sprintf("%s saved to %s", agent.ContextText(msg), path))
+	case msg.StreamID == "":
+		t.out.message(t.label, msg.From, msg.Content)
+	}
+}
+
+// echo prints an AI reply as it is streamed
+func (t *terminalAgent) echo(peer, chunk string, end bool) {
+	if end {
+		fmt.Printf("%s\n", colorGreen)
+		t.echoing = false
+		return
+	}
+	if !t.echoing {
+		fmt.Printf("%s%s", colorCyan, tagged(t.label, "[AI]: "))
+		t.echoing = true
+	}
+	fmt.Printf("%s%s", colorCyan, chunk)
+}
+
+// showToolCall prints a tool call the AI made and its result
+func (t *terminalAgent) showToolCall(peer string, call ai.ToolCall, result ai.ToolResult) {
+	outcome := "->"
+	if result.IsError {
+		outcome = "failed:"
+	}
+	text := fmt.Sprintf("[tool] %s %s %s %s", call.Name, call.Arguments, outcome, firstLine(result.Content))
+	t.out.notice(tagged(t.label, text))
+}
+
+// firstLine returns the first line of text, marking any that follow
+func firstLine(text string) string {
+	line, rest, found := strings.Cut(strings.TrimSpace(text), "\n")
+	if found && rest != "" {
+		line += " ..."
+	}
+	return line
+}
+
+// showTurn prints a change of turn under floor control
+func (t *terminalAgent) showTurn(turn client.Turn) {
+	var text string
+	switch {
+	case turn.Holder == t.ID():
+		text = "Your turn"
+	case turn.Holder != "":
+		text = fmt.Sprintf("Turn: %s", turn.Holder)
+	case turn.Mode == client.FloorModerated:
+		text = fmt.Sprintf("Turn: %s (moderator)", turn.Moderator)
+	default:
+		text = "Turn: open to the next sender"
+	}
+	t.out.notice(tagged(t.label, text))
+}
+
+// logf reports a warning or error to stderr, labelled with the agent
+func (t *terminalAgent) logf(format string, args ...any) {
+	fmt.Fprintln(os.Stderr, tagged(t.label, fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/talkers/internal/agent"
+)
+
+// approver holds AI drafts for the operator to approve, edit, regenerate or discard
+// before they are sent. One draft is reviewed at a time.
+type approver struct {
+	timeout time.Duration // auto-approve after this long; 0 waits indefinitely
+	label   string        // names the agent when several share the terminal
+
+	mu      sync.Mutex
+	pending chan agent.Decision // set while a draft awaits a decision
+}
+
+// review shows the draft reply to to, with the problem with the operator's last
+// edit if any, and waits for the operator's decision, the auto-approve timeout, or
+// ctx to end, which discards the draft
+func (a *approver) review(ctx context.Context, to, draft string, problem error) agent.Decision {
+	if problem != nil {
+		fmt.Printf("%s%s%s\n", colorCyan, tagged(a.label, fmt.Sprintf("Edit refused: %v", problem)), colorGreen)
+	}
+	d := a.wait(ctx, to, draft)
+	if d.Action == agent.Discard {
+		fmt.Printf("%s%s%s\n", colorCyan, tagged(a.label, "Discarded draft to "+to), colorGreen)
+	}
+	return d
+}
+
+// wait shows the draft and returns the decision on it
+func (a *approver) wait(ctx context.Context, to, draft string) agent.Decision {
+	decisions := make(chan agent.Decision, 1)
+	a.mu.Lock()
+	a.pending = decisions
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.pending = nil
+		a.mu.Unlock()
+	}()
+
+	fmt.Printf("%s%s\n", colorCyan, tagged(a.label, fmt.Sprintf("[draft to %s]: %s", to, draft)))
+	fmt.Printf("/approve, /edit <text>, /regen or /discard")
+	if a.timeout > 0 {
+		fmt.Printf(" (auto-approve in %v)", a.timeout)
+	}
+	fmt.Printf("%s\n", colorGreen)
+
+	var expired <-chan time.Time
+	if a.timeout > 0 {
+		timer := time.NewTimer(a.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case d := <-decisions:
+		return d
+	case <-expired:
+		fmt.Printf("%s%s%s\n", colorCyan, tagged(a.label, "Auto-approved draft to "+to), colorGreen)
+		return agent.Decision{Action: agent.Approve}
+	case <-ctx.Done():
+		return agent.Decision{Action: agent.Discard}
+	}
+}
+
+// decide passes d to the draft under review. It reports false if there is none.
+func (a *approver) decide(d agent.Decision) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending == nil {
+		return false
+	}
+	select {
+	case a.pending <- d:
+		return true
+	default:
+		// A decision has already been made
+		return false
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/dmh2000/talkers/internal/profile"
+)
+
+// listFlag is a comma-separated list option; each use replaces the list
+type listFlag struct {
+	items *[]string
+}
+
+func (l listFlag) String() string {
+	if l.items == nil {
+		return ""
+	}
+	return strings.Join(*l.items, ",")
+}
+
+func (l listFlag) Set(value string) error {
+	*l.items = splitList(value)
+	return nil
+}
+
+// float32Flag is a float32 option
+type float32Flag struct {
+	value *float32
+}
+
+func (f float32Flag) String() string {
+	if f.value == nil {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(*f.value), 'g', -1, 32)
+}
+
+func (f float32Flag) Set(value string) error {
+	v, err := strconv.ParseFloat(value, 32)
+	if err != nil {
+		return err
+	}
+	*f.value = float32(v)
+	return nil
+}
+
+// bindFlags defines the options that set fields of p on fs, defaulting to the
+// values already in p
+func bindFlags(fs *flag.FlagSet, p *profile.Profile) {
+	fs.StringVar(&p.Attachments, "attachments", p.Attachments, "directory for received attachments")
+	fs.IntVar(&p.Context.Budget, "context-budget", p.Context.Budget, "token budget for each AI query (0 = model default)")
+	fs.StringVar(&p.Context.Strategy, "context-strategy", p.Context.Strategy, "how to fit a long conversation: window, drop or summarize")
+	fs.IntVar(&p.Limits.MaxTurns, "max-turns", p.Limits.MaxTurns, "AI replies per conversation (0 = unlimited)")
+	fs.IntVar(&p.Limits.TokenBudget, "token-budget", p.Limits.TokenBudget, "estimated tokens per conversation (0 = unlimited)")
+	fs.IntVar(&p.Limits.RepeatWindow, "repeat-window", p.Limits.RepeatWindow, "stop when a reply repeats one of the last n messages (0 = off)")
+	fs.StringVar(&p.Limits.EndMarker, "end-marker", p.Limits.EndMarker, "text the model emits to end a conversation")
+	fs.DurationVar(&p.Limits.Cooldown, "cooldown", p.Limits.Cooldown, "minimum time between AI replies to a peer")
+	fs.BoolVar(&p.Reply.Approve, "approve", p.Reply.Approve, "hold each AI reply for approval before sending it")
+	fs.DurationVar(&p.Reply.ApproveTimeout, "approve-timeout", p.Reply.ApproveTimeout, "send a draft unchanged if not reviewed within this time (0 = wait)")
+	fs.BoolVar(&p.NoAI, "no-ai", p.NoAI, "run as a plain chat client without AI replies")
+	fs.Var(listFlag{&p.Reply.To}, "reply-to", "comma-separated peers the AI answers (default all)")
+	fs.Var(listFlag{&p.Reply.Ignore}, "ignore", "comma-separated peers the AI never answers")
+	fs.BoolVar(&p.Reply.MentionOnly, "mention-only", p.Reply.MentionOnly, "answer only messages that mention this client, and requests")
+	fs.DurationVar(&p.Limits.AITimeout, "ai-timeout", p.Limits.AITimeout, "time limit for each AI query (0 = none)")
+	fs.StringVar(&p.AI.Record, "record", p.AI.Record, "record every AI query and response to this cassette file")
+	fs.StringVar(&p.AI.Replay, "replay", p.AI.Replay, "answer AI queries from this cassette file instead of the model")
+	fs.BoolVar(&p.AI.ReplayStrict, "replay-strict", p.AI.ReplayStrict, "with -replay, fail queries that differ from the recording")
+	fs.Var(listFlag{&p.AI.Fallback}, "fallback", "comma-separated models to use, in order, when the model fails")
+	fs.IntVar(&p.AI.Retries, "retries", p.AI.Retries, "attempts per model for rate limits, timeouts and other transient errors")
+	fs.StringVar(&p.AI.Prices, "prices", p.AI.Prices, "JSON file of model prices in dollars per million tokens")
+	fs.Float64Var(&p.Limits.MaxSpend, "max-spend", p.Limits.MaxSpend, "stop AI replies once they have cost this many dollars (0 = no limit)")
+	fs.Var(float32Flag{&p.Generation.Temperature}, "temperature", "sampling temperature passed to the model")
+	fs.Int64Var(&p.Generation.MaxTokens, "max-tokens", p.Generation.MaxTokens, "maximum tokens in each AI response (0 = model default)")
+	fs.Var(listFlag{&p.Tools.Use}, "tools", "comma-separated tools the AI may call: calculate, read_file, list_files, list_clients")
+	fs.StringVar(&p.Tools.Files, "tool-files", p.Tools.Files, "directory the file tools may read")
+	fs.IntVar(&p.Tools.MaxRounds, "tool-rounds", p.Tools.MaxRounds, "rounds of tool calls per AI reply (0 = default)")
+	fs.StringVar(&p.Output.SchemaFile, "schema", p.Output.SchemaFile, "JSON Schema file AI replies must match; replies are sent as JSON")
+	fs.IntVar(&p.Output.Retries, "schema-retries", p.Output.Retries, "queries again after an AI reply that does not match the schema")
+}
+
+// overrideFlags applies the options set on the command line to p, so they take
+// precedence over the values in its profile
+func overrideFlags(p *profile.Profile) error {
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	bindFlags(fs, p)
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if err == nil && fs.Lookup(f.Name) != nil {
+			err = fs.Set(f.Name, f.Value.String())
+		}
+	})
+	return err
+}
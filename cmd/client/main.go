@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/ai"
+	"github.com/dmh2000/talkers/internal/profile"
+)
+
+const (
+	maxInputLength = 256
+
+	// askTimeout is how long /ask waits for an answer
+	askTimeout = 2 * time.Minute
+
+	colorBlue  = "\033[94m"
+	colorGreen = "\033[92m"
+	colorCyan  = "\033[96m"
+	colorReset = "\033[0m"
+)
+
+func help(msg string) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <client-id> <server-ip:port> <model> <system-file>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s -no-ai [options] <client-id> <server-ip:port>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s [options] -profile file [-profile file ...]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Arguments:\n")
+	fmt.Fprintf(os.Stderr, "  client-id       Unique identifier for this client (1-%d chars)\n", profile.MaxIDLength)
+	fmt.Fprintf(os.Stderr, "  server-ip:port  Address of the talkers server, optionally prefixed with a\n")
+	fmt.Fprintf(os.Stderr, "                  transport scheme (quic://, tcp://, wss://, ws://)\n")
+	fmt.Fprintf(os.Stderr, "  model           LLM model name (e.g. claude-sonnet-4)\n")
+	fmt.Fprintf(os.Stderr, "  system-file     Path to file containing the AI system prompt, a Go template\n")
+	fmt.Fprintf(os.Stderr, "                  with {{.Self}}, {{.Peer}}, {{.Peers}}, {{.Room}}, {{.Model}},\n")
+	fmt.Fprintf(os.Stderr, "                  {{.Date}} and {{.Now}}\n\n")
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	fmt.Fprintf(os.Stderr, "  -profile file              Run the agent described by a YAML profile; repeat to run several\n")
+	fmt.Fprintf(os.Stderr, "                             agents. Options given with profiles override every profile.\n")
+	fmt.Fprintf(os.Stderr, "  -attachments dir           Directory for received attachments (default %q)\n", profile.DefaultAttachments)
+	fmt.Fprintf(os.Stderr, "  -no-ai                     Run as a plain chat client without AI replies\n")
+	fmt.Fprintf(os.Stderr, "  -temperature t             Sampling temperature passed to the model\n")
+	fmt.Fprintf(os.Stderr, "  -max-tokens n              Maximum tokens in each AI response (default: model limit)\n")
+	fmt.Fprintf(os.Stderr, "  -tools names               Comma-separated tools the AI may call: %s\n", strings.Join(agent.BuiltinToolNames, ", "))
+	fmt.Fprintf(os.Stderr, "  -tool-files dir            Directory read_file and list_files may read\n")
+	fmt.Fprintf(os.Stderr, "  -tool-rounds n             Rounds of tool calls per AI reply (default %d)\n", ai.DefaultMaxToolRounds)
+	fmt.Fprintf(os.Stderr, "  -schema file               JSON Schema AI replies must match; replies are sent as JSON\n")
+	fmt.Fprintf(os.Stderr, "  -schema-retries n          Queries again after a reply that does not match (default %d)\n", ai.DefaultSchemaRetries)
+	fmt.Fprintf(os.Stderr, "  -reply-to peers            Comma-separated peers the AI answers, * wildcards allowed (default all)\n")
+	fmt.Fprintf(os.Stderr, "  -ignore peers              Comma-separated peers the AI never answers\n")
+	fmt.Fprintf(os.Stderr, "  -mention-only              Answer only messages that mention @<client-id>, and requests\n")
+	fmt.Fprintf(os.Stderr, "  -ai-timeout duration       Time limit for each AI query, 0 = none (default %v)\n", profile.DefaultAITimeout)
+	fmt.Fprintf(os.Stderr, "  -fallback models           Comma-separated models to use, in order, when the model fails\n")
+	fmt.Fprintf(os.Stderr, "  -retries n                 Attempts per model for transient errors (default %d)\n", ai.DefaultMaxAttempts)
+	fmt.Fprintf(os.Stderr, "  -prices file               JSON file of model prices in dollars per million tokens\n")
+	fmt.Fprintf(os.Stderr, "  -max-spend dollars         Stop AI replies once they have cost this much\n")
+	fmt.Fprintf(os.Stderr, "  -record file               Record every AI query and response to a cassette file\n")
+	fmt.Fprintf(os.Stderr, "  -replay file               Answer AI queries from a cassette file instead of the model\n")
+	fmt.Fprintf(os.Stderr, "  -replay-strict             With -replay, fail queries that differ from the recording\n")
+	fmt.Fprintf(os.Stderr, "  -context-budget tokens     Token budget for each AI query (default: model window less output)\n")
+	fmt.Fprintf(os.Stderr, "  -context-strategy name     window, drop or summarize (default %q)\n", ai.StrategyWindow)
+	fmt.Fprintf(os.Stderr, "  -max-turns n               AI replies per conversation, 0 = unlimited (default %d)\n", profile.DefaultMaxTurns)
+	fmt.Fprintf(os.Stderr, "  -token-budget tokens       Tokens per conversation, 0 = unlimited\n")
+	fmt.Fprintf(os.Stderr, "  -repeat-window n           Stop when a reply repeats one of the last n, 0 = off (default %d)\n", profile.DefaultRepeatWindow)
+	fmt.Fprintf(os.Stderr, "  -end-marker text           Text the model emits to end a conversation (default %q)\n", ai.DefaultEndMarker)
+	fmt.Fprintf(os.Stderr, "  -cooldown duration         Minimum time between AI replies to a peer\n")
+	fmt.Fprintf(os.Stderr, "  -approve                   Hold each AI reply for approval before sending it\n")
+	fmt.Fprintf(os.Stderr, "  -approve-timeout duration  Send a draft unchanged if not reviewed in time\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  <to_id>:<content>     Send a text message\n")
+	fmt.Fprintf(os.Stderr, "  /send <to_id> <path>  Send a file as an attachment\n")
+	fmt.Fprintf(os.Stderr, "  /ask <to_id> <text>   Send a request and wait for the reply\n")
+	fmt.Fprintf(os.Stderr, "  /context [peer_id]    List conversations, or show one's AI context\n")
+	fmt.Fprintf(os.Stderr, "  /cost                 Show AI token usage and cost per conversation\n")
+	fmt.Fprintf(os.Stderr, "  /clear <peer_id>      Clear the AI context of a conversation and resume replies\n")
+	fmt.Fprintf(os.Stderr, "  /approve              Send the AI draft as written (approval mode)\n")
+	fmt.Fprintf(os.Stderr, "  /edit <text>          Send <text> in place of the AI draft\n")
+	fmt.Fprintf(os.Stderr, "  /regen                Ask the AI for a new draft\n")
+	fmt.Fprintf(os.Stderr, "  /discard              Drop the AI draft without replying\n")
+	fmt.Fprintf(os.Stderr, "  /pass [peer_id]       Pass the turn to a peer, or the next client (floor control)\n")
+	fmt.Fprintf(os.Stderr, "  With several agents, prefix a line with <client-id>> to give it to that agent;\n")
+	fmt.Fprintf(os.Stderr, "  unprefixed lines go to the first.\n")
+	os.Exit(1)
+}
+
+func main() {
+	// Parse command-line arguments; the options fill in a profile for the agent
+	base := profile.Default()
+	bindFlags(flag.CommandLine, &base)
+	var profilePaths []string
+	flag.Func("profile", "YAML agent profile; repeat to run several agents", func(path string) error {
+		profilePaths = append(profilePaths, path)
+		return nil
+	})
+	flag.Usage = func() { help("invalid arguments") }
+	flag.Parse()
+
+	profiles, err := loadProfiles(base, profilePaths)
+	if err != nil {
+		help(err.Error())
+	}
+
+	// Build every agent before connecting any; all share the terminal
+	out := &printer{}
+	agents := make([]*terminalAgent, 0, len(profiles))
+	for _, p := range profiles {
+		label := ""
+		if len(profiles) > 1 {
+			label = p.ID
+		}
+		a, err := newTerminalAgent(p, label, out)
+		if err != nil {
+			help(err.Error())
+		}
+		agents = append(agents, a)
+	}
+
+	// Set up context with cancellation for clean shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Set up signal handling for SIGINT (Ctrl-C)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT)
+
+	// Channel to signal termination from an event loop
+	readDone := make(chan error, len(agents))
+
+	// Connect each agent and start its loops
+	for _, a := range agents {
+		if err := a.start(ctx, readDone); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Channel to coordinate shutdown on stdin close
+	shutdownChan := make(chan struct{})
+
+	// Terminal input goroutine
+	go terminalInput(agents, shutdownChan, ctx)
+
+	// Wait for shutdown signal, read error, or stdin close
+	select {
+	case <-sigChan:
+		fmt.Fprintf(os.Stderr, "\nReceived interrupt signal, shutting down...\n")
+	case err := <-readDone:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Read loop terminated: %v\n", err)
+		}
+	case <-shutdownChan:
+		// Terminal input closed
+	}
+
+	// Reset terminal color and clean shutdown
+	fmt.Print(colorReset)
+	cancel()
+	for _, a := range agents {
+		_ = a.Close()
+	}
+}
+
+// loadProfiles returns the profiles of the agents to run: one per profile file,
+// with the options set on the command line applied over each, or else the single
+// agent described by base and the positional arguments
+func loadProfiles(base profile.Profile, paths []string) ([]profile.Profile, error) {
+	if len(paths) == 0 {
+		if base.NoAI && flag.NArg() != 2 {
+			return nil, fmt.Errorf("expected 2 arguments with -no-ai")
+		}
+		if !base.NoAI && flag.NArg() != 4 {
+			return nil, fmt.Errorf("expected 4 arguments")
+		}
+		base.ID, base.Server = flag.Arg(0), flag.Arg(1)
+		base.Model, base.SystemFile = flag.Arg(2), flag.Arg(3)
+		if err := base.Validate(); err != nil {
+			return nil, err
+		}
+		return []profile.Profile{base}, nil
+	}
+
+	if flag.NArg() > 0 {
+		return nil, fmt.Errorf("arguments cannot be used with -profile")
+	}
+	profiles := make([]profile.Profile, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		p, err := profile.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := overrideFlags(&p); err != nil {
+			return nil, err
+		}
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", path, err)
+		}
+		if seen[p.ID] {
+			return nil, fmt.Errorf("profile %s: client ID %s is used by another profile", path, p.ID)
+		}
+		seen[p.ID] = true
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// formatSpend describes a running total for /cost; estimated token counts are marked ~
+func formatSpend(s ai.Spend) string {
+	approx := ""
+	if s.Estimated {
+		approx = "~"
+	}
+	return fmt.Sprintf("%d queries, %s%d prompt + %s%d completion tokens, $%.4f",
+		s.Queries, approx, s.PromptTokens, approx, s.CompletionTokens, s.Cost)
+}
+
+// splitList splits a comma-separated list, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for item := range strings.SplitSeq(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// terminalInput reads lines from stdin, validates format and length, and sends each
+// to the write loop of the agent it is for.
+func terminalInput(agents []*terminalAgent, done chan struct{}, ctx context.Context) {
+	defer close(done)
+	scanner := bufio.NewScanner(os.Stdin)
+
+	// Set input color to light green
+	fmt.Print(colorGreen)
+
+	for scanner.Scan() {
+		a, line := route(agents, scanner.Text())
+		writeChan := a.writeChan
+
+		// Commands are validated by the write loop
+		if strings.HasPrefix(line, "/") {
+			select {
+			case writeChan <- line:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// Parse input format: <to_id>:<content>
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			fmt.Fprintf(os.Stderr, "Error: invalid input format, expected <to_id>:<content>\n")
+			continue
+		}
+
+		// Validate input length
+		if len(parts[1]) > maxInputLength {
+			fmt.Fprintf(os.Stderr, "Error: input exceeds maximum length of %d characters\n", maxInputLength)
+			continue
+		}
+
+		select {
+		case writeChan <- line:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reading from stdin: %v\n", err)
+	}
+}
+
+// route picks the agent a line of input is for: the one named by a <client-id>>
+// prefix, which is removed, or else the first
+func route(agents []*terminalAgent, line string) (*terminalAgent, string) {
+	if id, rest, ok := strings.Cut(line, ">"); ok && len(agents) > 1 {
+		for _, a := range agents {
+			if a.ID() == strings.TrimSpace(id) {
+				return a, strings.TrimSpace(rest)
+			}
+		}
+	}
+	return agents[0], line
+}
+
+// writeLoop reads the terminal input routed to a, sends each line as a message, and
+// updates the AI query context. Sending to a peer resumes AI replies to it.
+func writeLoop(ctx context.Context, a *terminalAgent) {
+	for {
+		select {
+		case line := <-a.writeChan:
+			if strings.HasPrefix(line, "/") {
+				runCommand(ctx, a, line)
+				continue
+			}
+
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			toID := parts[0]
+			msgContent := parts[1]
+
+			// Under floor control, only send while holding the turn
+			if turn := a.Client().Turn(); !turn.Allows(a.ID()) {
+				a.logf("Warning: not sent; %s holds the turn", turnHolder(turn))
+				continue
+			}
+
+			// Send and add the message to the AI query context
+			if err := a.Send(ctx, toID, msgContent); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: failed to send message: %v\n", err)
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runCommand executes a terminal command entered as /<name> [args...]
+func runCommand(ctx context.Context, a *terminalAgent, line string) {
+	c, conversations, guard, drafts := a.Client(), a.Conversations(), a.Guard(), a.approver
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "/send":
+		if len(fields) != 3 {
+			fmt.Fprintf(os.Stderr, "Error: usage: /send <to_id> <path>\n")
+			return
+		}
+		msg, err := c.SendFile(ctx, fields[1], fields[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to send file: %v\n", err)
+			return
+		}
+
+		// Add sent attachment to AI query context
+		conversations.Add(fields[1], c.ID(), agent.ContextText(msg))
+
+	case "/ask":
+		if len(fields) < 3 {
+			fmt.Fprintf(os.Stderr, "Error: usage: /ask <to_id> <question>\n")
+			return
+		}
+		_, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+		toID, question, _ := strings.Cut(strings.TrimSpace(rest), " ")
+		question = strings.TrimSpace(question)
+
+		// Add the question to the AI query context now; the answer is added when it arrives
+		conversations.Add(toID, c.ID(), question)
+
+		// Wait for the answer without blocking terminal input
+		go func() {
+			answer, err := c.Request(ctx, toID, question, askTimeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: request to %s failed: %v\n", toID, err)
+				return
+			}
+			if answer.StreamID == "" {
+				a.out.message(a.label, answer.From, answer.Content)
+			}
+			conversations.Add(toID, answer.From, agent.ContextText(answer))
+		}()
+
+	case "/context":
+		if len(fields) == 1 {
+			// List conversations
+			for _, peer := range conversations.Keys() {
+				status := ""
+				if err := guard.Stopped(peer); err != nil {
+					status = fmt.Sprintf(" (replies stopped: %v)", err)
+				}
+				fmt.Printf("%s%s: %d entries%s%s\n", colorCyan, peer, conversations.Len(peer), status, colorGreen)
+			}
+			return
+		}
+		for _, entry := range conversations.Context(fields[1]) {
+			fmt.Printf("%s%s%s\n", colorCyan, entry, colorGreen)
+		}
+
+	case "/clear":
+		if len(fields) != 2 {
+			fmt.Fprintf(os.Stderr, "Error: usage: /clear <peer_id>\n")
+			return
+		}
+		conversations.Clear(fields[1])
+		guard.Reset(fields[1])
+		fmt.Printf("%sCleared conversation with %s%s\n", colorCyan, fields[1], colorGreen)
+
+	case "/approve", "/edit", "/regen", "/discard":
+		d := agent.Decision{Action: agent.Approve}
+		switch fields[0] {
+		case "/edit":
+			_, text, _ := strings.Cut(strings.TrimSpace(line), " ")
+			if text = strings.TrimSpace(text); text == "" {
+				fmt.Fprintf(os.Stderr, "Error: usage: /edit <text>\n")
+				return
+			}
+			d = agent.Decision{Action: agent.Edit, Text: text}
+		case "/regen":
+			d.Action = agent.Regenerate
+		case "/discard":
+			d.Action = agent.Discard
+		}
+		if drafts == nil || !drafts.decide(d) {
+			fmt.Fprintf(os.Stderr, "Error: no AI draft awaiting approval\n")
+		}
+
+	case "/pass":
+		if len(fields) > 2 {
+			fmt.Fprintf(os.Stderr, "Error: usage: /pass [peer_id]\n")
+			return
+		}
+		to := ""
+		if len(fields) == 2 {
+			to = fields[1]
+		}
+		if err := c.PassTurn(to); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to pass the turn: %v\n", err)
+		}
+
+	case "/ping":
+		go func() {
+			rtt, err := c.Ping(ctx)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: ping failed: %v\n", err)
+				return
+			}
+			a.out.notice(tagged(a.label, fmt.Sprintf("Server answered in %v", rtt.Round(time.Microsecond))))
+		}()
+
+	case "/cost":
+		ledger := a.Ledger()
+		for _, peer := range ledger.Keys() {
+			fmt.Printf("%s%s: %s%s\n", colorCyan, peer, formatSpend(ledger.Conversation(peer)), colorGreen)
+		}
+		total := formatSpend(ledger.Total())
+		if ledger.Ceiling() > 0 {
+			total += fmt.Sprintf(" of $%.2f ceiling", ledger.Ceiling())
+		}
+		fmt.Printf("%stotal: %s%s\n", colorCyan, total, colorGreen)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown command %s\n", fields[0])
+	}
+}
+
+// turnHolder names the client a turn belongs to
+func turnHolder(turn client.Turn) string {
+	if turn.Holder == "" {
+		return turn.Moderator
+	}
+	return turn.Holder
+}
+
+// eventLoop reports a's connection events. A server error or the end of the
+// connection is passed to done, which shuts the client down; floor control
+// rejections are only reported.
+func eventLoop(a *terminalAgent, done chan<- error) {
+	c := a.Client()
+	for ev := range c.Events() {
+		switch ev.Type {
+		case client.EventServerError:
+			if errors.Is(ev.Err, client.ErrNotYourTurn) || errors.Is(ev.Err, client.ErrCannotPassTurn) {
+				a.logf("Warning: %v", ev.Err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", ev.Err)
+			done <- fmt.Errorf("server error: %w", ev.Err)
+			return
+		case client.EventStreamError:
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", ev.Err)
+		case client.EventTurn:
+			a.showTurn(ev.Turn)
+		case client.EventJoined:
+			a.out.notice(tagged(a.label, ev.From+" joined"))
+		case client.EventLeft:
+			a.out.notice(tagged(a.label, ev.From+" left"))
+		case client.EventDisconnected:
+			done <- ev.Err
+			return
+		}
+	}
+	done <- c.Err()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dmh2000/talkers/client"
+)
+
+// printer serializes terminal output for received messages. Streamed messages are
+// rendered as their chunks arrive; when chunks from different streams interleave,
+// the sender prefix is repeated so each piece stays attributed. One printer is
+// shared by every agent on the terminal; label names the receiving agent.
+type printer struct {
+	mu      sync.Mutex
+	current string // stream ID whose output is on the current line
+}
+
+// message prints a complete message on its own line
+func (p *printer) message(label, from, content string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breakLine()
+	fmt.Printf("%s%s%s\n", colorBlue, tagged(label, fmt.Sprintf("[%s]: %s", from, content)), colorGreen)
+}
+
+// notice prints a status line
+func (p *printer) notice(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.breakLine()
+	fmt.Printf("%s%s%s\n", colorCyan, text, colorGreen)
+}
+
+// streamChunk renders a piece of a streamed message received by the agent label;
+// it backs the client's OnChunk hook
+func (p *printer) streamChunk(label string, c client.Chunk) {
+	switch {
+	case c.End && c.Err != nil:
+		p.end(c.StreamID, " [interrupted]")
+	case c.End:
+		p.end(c.StreamID, "")
+	default:
+		p.chunk(label, c.StreamID, c.From, c.Content)
+	}
+}
+
+// chunk prints the next piece of a streamed message
+func (p *printer) chunk(label, streamID, from, content string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current != streamID {
+		p.breakLine()
+		fmt.Printf("%s%s", colorBlue, tagged(label, fmt.Sprintf("[%s]: ", from)))
+		p.current = streamID
+	}
+	fmt.Printf("%s%s", colorBlue, content)
+}
+
+// end terminates the line of a streamed message
+func (p *printer) end(streamID, suffix string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == streamID {
+		fmt.Printf("%s%s\n", suffix, colorGreen)
+		p.current = ""
+	} else if suffix != "" {
+		fmt.Printf("%s%s\n", suffix, colorGreen)
+	}
+}
+
+// breakLine ends a partially printed stream line. Caller must hold mu.
+func (p *printer) breakLine() {
+	if p.current != "" {
+		fmt.Printf("%s\n", colorGreen)
+		p.current = ""
+	}
+}
+
+// tagged prefixes text with label, which names the agent it concerns when several
+// agents share the terminal. The prefix matches the one that routes input to them.
+func tagged(label, text string) string {
+	if label == "" {
+		return text
+	}
+	return label + "> " + text
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dmh2000/talkers/server"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <listen-addr> [listen-addr...]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Each listen-addr is [scheme://]ip:port, where scheme is one of:\n")
+	fmt.Fprintf(os.Stderr, "  quic  QUIC over UDP (default when no scheme is given)\n")
+	fmt.Fprintf(os.Stderr, "  tcp   TLS over TCP\n")
+	fmt.Fprintf(os.Stderr, "  wss   WebSocket over TLS, e.g. wss://0.0.0.0:8443/talkers\n")
+	fmt.Fprintf(os.Stderr, "  ws    WebSocket without TLS, for use behind a TLS-terminating proxy\n\n")
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	fmt.Fprintf(os.Stderr, "  -floor mode              Floor control: open, round-robin, token or moderated (default open)\n")
+	fmt.Fprintf(os.Stderr, "  -moderator id            Client ID of the moderator, with -floor moderated\n")
+	fmt.Fprintf(os.Stderr, "  -turn-timeout duration   How long a client may hold the turn without sending,\n")
+	fmt.Fprintf(os.Stderr, "                           negative = no limit (default %v)\n", server.DefaultTurnTimeout)
+	fmt.Fprintf(os.Stderr, "  -chunk-timeout duration  How long a streamed message may send nothing before it\n")
+	fmt.Fprintf(os.Stderr, "                           is abandoned (default %v)\n", server.DefaultChunkTimeout)
+	fmt.Fprintf(os.Stderr, "  -room name               Name of the room, shown to clients and AI prompts\n")
+}
+
+func main() {
+	// Configure logging: output to stdout with filename and line number
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	floorMode := flag.String("floor", "", "floor control mode")
+	moderator := flag.String("moderator", "", "moderator client ID")
+	turnTimeout := flag.Duration("turn-timeout", 0, "turn timeout")
+	chunkTimeout := flag.Duration("chunk-timeout", 0, "streamed message chunk timeout")
+	room := flag.String("room", "", "room name")
+	flag.Usage = usage
+	flag.Parse()
+
+	// Validate command-line arguments
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(1)
+	}
+	mode, err := server.ParseFloorMode(*floorMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		usage()
+		os.Exit(1)
+	}
+
+	// Start listening on every address; all listeners share one registry
+	srv := server.New(server.Config{
+		Addrs: flag.Args(),
+		Floor: server.FloorConfig{
+			Mode:        mode,
+			Moderator:   *moderator,
+			TurnTimeout: *turnTimeout,
+		},
+		ChunkTimeout: *chunkTimeout,
+		Room:         *room,
+	})
+	if err := srv.Start(); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	if mode != server.FloorOpen {
+		log.Printf("Floor control: %s", mode)
+	}
+
+	// Set up signal handling for graceful shutdown
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// Wait for shutdown signal
+	sig := <-sigChan
+	log.Printf("Received signal %v, initiating graceful shutdown...", sig)
+
+	// Close listeners and client connections, then wait for handlers to exit
+	srv.Stop()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/dmh2000/talkers/internal/scenario"
+)
+
+func help(msg string) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <scenario-file>\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Runs the agents of a scenario in one process, starts their conversation with\n")
+	fmt.Fprintf(os.Stderr, "the opening message, and writes the transcript when a stop condition is met.\n\n")
+	fmt.Fprintf(os.Stderr, "Options:\n")
+	fmt.Fprintf(os.Stderr, "  -o file            Write the transcript to file, as JSON lines if it ends in .jsonl\n")
+	fmt.Fprintf(os.Stderr, "                     (default: the scenario's transcript, else stdout)\n")
+	fmt.Fprintf(os.Stderr, "  -server addr       Use the server at addr instead of the scenario's\n")
+	fmt.Fprintf(os.Stderr, "  -timeout duration  Stop the run after this long\n")
+	fmt.Fprintf(os.Stderr, "  -max-messages n    Stop the run after n messages\n")
+	fmt.Fprintf(os.Stderr, "  -v                 Show the embedded server's log\n")
+	os.Exit(1)
+}
+
+func main() {
+	output := flag.String("o", "", "file to write the transcript to")
+	serverAddr := flag.String("server", "", "address of the server to use instead of the scenario's")
+	timeout := flag.Duration("timeout", 0, "stop the run after this long")
+	maxMessages := flag.Int("max-messages", 0, "stop the run after this many messages")
+	verbose := flag.Bool("v", false, "show the embedded server's log")
+	flag.Usage = func() { help("invalid arguments") }
+	flag.Parse()
+	if flag.NArg() != 1 {
+		help("expected a scenario file")
+	}
+
+	s, err := scenario.Load(flag.Arg(0))
+	if err != nil {
+		help(err.Error())
+	}
+	if *serverAddr != "" {
+		s.Server, s.Listen = *serverAddr, nil
+	}
+	if *timeout > 0 {
+		s.Stop.Timeout = *timeout
+	}
+	if *maxMessages > 0 {
+		s.Stop.MaxMessages = *maxMessages
+	}
+	if *output != "" {
+		s.Transcript = *output
+	}
+
+	// The embedded server logs every message it routes; keep agent warnings and
+	// progress on a logger of their own
+	logger := log.New(os.Stderr, "", log.Ldate|log.Ltime)
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	// Stop the run on SIGINT or SIGTERM; the transcript so far is still written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Follow the conversation on stdout when the transcript goes to a file
+	opts := &scenario.RunOptions{Logf: logger.Printf}
+	if s.Transcript != "" {
+		opts.OnEntry = func(e scenario.Entry) { fmt.Println(e) }
+	}
+
+	t, err := scenario.Run(ctx, s, opts)
+	if t != nil && t.Reason != "" {
+		logger.Printf("Scenario %s ended (%s) with %d messages", s.Name, t.Reason, t.Len())
+	}
+	if t != nil {
+		if s.Transcript == "" {
+			if writeErr := t.WriteText(os.Stdout); writeErr != nil {
+				logger.Printf("Failed to write transcript: %v", writeErr)
+			}
+		} else if saveErr := t.Save(s.Transcript); saveErr != nil {
+			logger.Printf("%v", saveErr)
+		} else {
+			logger.Printf("Transcript written to %s", s.Transcript)
+		}
+	}
+	if err != nil {
+		logger.Fatalf("Scenario %s failed: %v", s.Name, err)
+	}
+}
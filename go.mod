@@ -3,8 +3,14 @@ module github.com/dmh2000/talkers
 go 1.25.3
 
 require (
+	github.com/coder/websocket v1.8.15
+	github.com/dmh2000/go-llmclient v1.0.0
+	github.com/hashicorp/yamux v0.1.2
+	github.com/klauspost/compress v1.20.1
 	github.com/quic-go/quic-go v0.59.0
+	github.com/tmc/langchaingo v0.1.13
 	google.golang.org/protobuf v1.36.11
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -18,7 +24,6 @@ require (
 	cloud.google.com/go/longrunning v0.6.7 // indirect
 	cloud.google.com/go/vertexai v0.15.0 // indirect
 	github.com/dlclark/regexp2 v1.11.5 // indirect
-	github.com/dmh2000/go-llmclient v1.0.0 // indirect
 	github.com/felixge/httpsnoop v1.0.4 // indirect
 	github.com/go-logr/logr v1.4.3 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
@@ -28,7 +33,6 @@ require (
 	github.com/googleapis/enterprise-certificate-proxy v0.3.6 // indirect
 	github.com/googleapis/gax-go/v2 v2.15.0 // indirect
 	github.com/pkoukk/tiktoken-go v0.1.7 // indirect
-	github.com/tmc/langchaingo v0.1.13 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.63.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.63.0 // indirect
@@ -47,5 +51,4 @@ require (
 	google.golang.org/genproto/googleapis/api v0.0.0-20250826171959-ef028d996bc1 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20250826171959-ef028d996bc1 // indirect
 	google.golang.org/grpc v1.75.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,277 @@
+// Package agent runs an AI agent described by a profile: a talkers client whose
+// received messages are answered by a model, within its reply policy and limits.
+// Programs observe and steer an agent through Hooks, so the same agent serves an
+// interactive terminal or an unattended run.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/ai"
+	"github.com/dmh2000/talkers/internal/profile"
+)
+
+// replyQueue is the number of received messages that may await a reply
+const replyQueue = 16
+
+// Hooks let the program running an agent observe and steer it. Any hook may be nil.
+// Hooks are called from the agent's goroutines.
+type Hooks struct {
+	// OnMessage is called with each received message before it is queued for a reply.
+	OnMessage func(msg *client.Message)
+
+	// OnReplyChunk is called with each piece of an AI reply as it is streamed to
+	// peer, and once more with end set when the reply finishes or fails.
+	OnReplyChunk func(peer, chunk string, end bool)
+
+	// OnReply is called with each AI reply once it has been sent to peer.
+	OnReply func(peer, reply string)
+
+	// OnToolCall is called with each tool call the model makes while replying to
+	// peer, and its result.
+	OnToolCall func(peer string, call ai.ToolCall, result ai.ToolResult)
+
+	// Review, if set, holds each AI draft for approval before it is sent. problem
+	// is set when the draft is shown again because the reviewer's edit was refused.
+	Review func(ctx context.Context, peer, draft string, problem error) Decision
+
+	// Logf reports warnings and errors (default log.Printf).
+	Logf func(format string, args ...any)
+}
+
+// Agent is a client that answers received messages with AI replies. Create one
+// with New, connect it with Start, and Close it when done.
+type Agent struct {
+	profile       profile.Profile
+	hooks         Hooks
+	conversations *ai.Conversations
+	manager       *ai.ContextManager
+	guard         *ai.Guard
+	policy        *Policy
+	ledger        *ai.Ledger
+	aiClient      ai.Client // nil when running without AI
+	prompt        *ai.SystemPrompt
+	tools         *ai.Tools  // nil when the model has no tools
+	schema        *ai.Schema // nil when replies are free text
+
+	c    *client.Client
+	wg   sync.WaitGroup
+	busy atomic.Int32 // messages received and not yet handled by the reply loop
+
+	// repliedOn is the number of the last turn the agent sent a reply on. The
+	// server may not have routed the reply yet, so that turn is not idle.
+	repliedOn atomic.Uint64
+
+	// overBudget is set once the ledger's spend ceiling has been reported
+	overBudget bool
+}
+
+// New builds the agent described by p, including its AI client unless p runs
+// without AI. p must be valid.
+func New(p profile.Profile, hooks Hooks) (*Agent, error) {
+	if hooks.Logf == nil {
+		hooks.Logf = log.Printf
+	}
+
+	// Decide which messages the AI answers
+	policy, err := NewPolicy(p.ID, p.Reply.To, p.Reply.Ignore, p.Reply.MentionOnly)
+	if err != nil {
+		return nil, err
+	}
+	// Account for the tokens and cost of AI queries
+	prices := ai.DefaultPrices
+	if p.AI.Prices != "" {
+		if prices, err = ai.LoadPrices(p.AI.Prices); err != nil {
+			return nil, err
+		}
+	}
+
+	a := &Agent{
+		profile:       p,
+		hooks:         hooks,
+		conversations: ai.NewConversations(), // AI query context per peer
+		policy:        policy,
+		ledger:        ai.NewLedger(prices, p.Limits.MaxSpend),
+	}
+
+	// Stop AI replies before a conversation runs away
+	a.guard = ai.NewGuard(ai.GuardConfig{
+		MaxTurns:     p.Limits.MaxTurns,
+		TokenBudget:  p.Limits.TokenBudget,
+		RepeatWindow: p.Limits.RepeatWindow,
+		EndMarker:    p.Limits.EndMarker,
+		Cooldown:     p.Limits.Cooldown,
+	})
+
+	if p.NoAI {
+		return a, nil
+	}
+
+	if a.prompt, err = p.SystemPrompt(); err != nil {
+		return nil, err
+	}
+	if a.schema, err = p.OutputSchema(); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.ID, err)
+	}
+	// Give the model the tools it may call while replying
+	if len(p.Tools.Use) > 0 {
+		// The client connects at Start, before any tool is called
+		roster := func(ctx context.Context) ([]string, error) { return a.c.Roster(ctx) }
+		if a.tools, err = BuiltinTools(p.Tools.Use, p.Tools.Files, roster); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.ID, err)
+		}
+	}
+	// Keep each query within the model's context window
+	strategy, err := ai.ParseStrategy(p.Context.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	aiClient, err := NewAIClient(p.Model, p.AI.Record, p.AI.Replay, p.AI.ReplayStrict, ai.FailoverConfig{
+		Fallbacks:   p.AI.Fallback,
+		MaxAttempts: p.AI.Retries,
+		Logf:        hooks.Logf,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AI client: %w", err)
+	}
+	a.aiClient = ai.WithOptions(ai.NewMeter(aiClient, a.ledger), p.Options())
+	a.manager = &ai.ContextManager{
+		Model:     p.Model,
+		Strategy:  strategy,
+		Budget:    p.Context.Budget,
+		Summarize: ai.NewSummarizer(a.aiClient, p.Model),
+	}
+	return a, nil
+}
+
+// NewAIClient creates the client for model, retrying and failing over as set by
+// failover, or a client replaying the cassette at replay. Queries are recorded to
+// the cassette at record if set.
+func NewAIClient(model, record, replay string, strict bool, failover ai.FailoverConfig) (ai.Client, error) {
+	if replay != "" {
+		return ai.NewReplayer(replay, strict)
+	}
+
+	primary, err := ai.AIClient(model)
+	if err != nil {
+		return nil, err
+	}
+	aiClient, err := ai.NewFailover(primary, model, failover)
+	if err != nil {
+		_ = primary.Close()
+		return nil, err
+	}
+	if record == "" {
+		return aiClient, nil
+	}
+	recorder, err := ai.NewRecorder(aiClient, record)
+	if err != nil {
+		_ = aiClient.Close()
+		return nil, err
+	}
+	return recorder, nil
+}
+
+// Start connects the agent to its server and starts answering messages until ctx
+// ends or the connection closes. opts are passed to client.Dial.
+func (a *Agent) Start(ctx context.Context, opts *client.Options) error {
+	c, err := client.Dial(ctx, a.profile.Server, a.profile.ID, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", a.profile.ID, err)
+	}
+	a.c = c
+
+	// Channel of received messages awaiting an AI reply
+	replyChan := make(chan *client.Message, replyQueue)
+
+	a.wg.Go(func() { a.receiveLoop(ctx, replyChan) })
+	a.wg.Go(func() { a.replyLoop(ctx, replyChan) })
+	a.wg.Go(func() { a.turnLoop(ctx) })
+	return nil
+}
+
+// receiveLoop passes each received message to OnMessage and queues it for a reply
+func (a *Agent) receiveLoop(ctx context.Context, replyChan chan<- *client.Message) {
+	defer close(replyChan)
+	for msg := range a.c.Messages() {
+		a.busy.Add(1)
+		if a.hooks.OnMessage != nil {
+			a.hooks.OnMessage(msg)
+		}
+
+		select {
+		case replyChan <- msg:
+		case <-ctx.Done():
+			a.busy.Add(-1)
+			return
+		}
+	}
+}
+
+// Send sends text to peer as the agent, adds it to their conversation and resumes
+// AI replies to peer. Under floor control it first waits for the agent's turn.
+func (a *Agent) Send(ctx context.Context, peer, text string) error {
+	if err := a.c.WaitTurn(ctx); err != nil {
+		return err
+	}
+	if err := a.c.Send(ctx, peer, text); err != nil {
+		return err
+	}
+	a.conversations.Add(peer, a.c.ID(), text)
+	a.guard.Reset(peer)
+	return nil
+}
+
+// Busy reports whether the agent has received messages it has not yet finished
+// handling, such as one it is answering.
+func (a *Agent) Busy() bool { return a.busy.Load() > 0 }
+
+// ID returns the agent's client ID.
+func (a *Agent) ID() string { return a.profile.ID }
+
+// Profile returns the profile the agent was built from.
+func (a *Agent) Profile() profile.Profile { return a.profile }
+
+// Client returns the agent's connection, or nil before Start.
+func (a *Agent) Client() *client.Client { return a.c }
+
+// Conversations returns the AI query context of each of the agent's conversations.
+func (a *Agent) Conversations() *ai.Conversations { return a.conversations }
+
+// Guard returns the stop conditions applied to the agent's AI replies.
+func (a *Agent) Guard() *ai.Guard { return a.guard }
+
+// Ledger returns the usage and cost of the agent's AI queries.
+func (a *Agent) Ledger() *ai.Ledger { return a.ledger }
+
+// Close disconnects the agent, waits for its loops to exit, and closes its AI
+// client. The context passed to Start should be ended first so a query in flight
+// is abandoned.
+func (a *Agent) Close() error {
+	var err error
+	if a.c != nil {
+		err = a.c.Close()
+		a.wg.Wait()
+	}
+	if a.aiClient != nil {
+		if aiErr := a.aiClient.Close(); err == nil {
+			err = aiErr
+		}
+	}
+	return err
+}
+
+// query returns a context for one AI query, ended by ctx or the query timeout
+func (a *Agent) query(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := a.profile.Limits.AITimeout
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/dmh2000/talkers/client"
+)
+
+// Policy decides which received messages the AI answers.
+type Policy struct {
+	allow       []string // sender patterns to answer; empty answers everyone
+	ignore      []string // sender patterns never answered, checked first
+	mentionOnly bool     // answer only messages that mention self
+	self        string   // this client's ID
+}
+
+// NewPolicy builds a policy for the client self from lists of sender patterns, in
+// path.Match syntax.
+func NewPolicy(self string, allow, ignore []string, mentionOnly bool) (*Policy, error) {
+	p := &Policy{self: self, mentionOnly: mentionOnly}
+	var err error
+	if p.allow, err = parsePatterns(allow); err != nil {
+		return nil, err
+	}
+	if p.ignore, err = parsePatterns(ignore); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parsePatterns checks each pattern of a list
+func parsePatterns(patterns []string) ([]string, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid peer pattern %q: %w", pattern, err)
+		}
+	}
+	return patterns, nil
+}
+
+// matchAny reports whether id matches one of patterns
+func matchAny(patterns []string, id string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Answers reports whether the AI should reply to msg.
+func (p *Policy) Answers(msg *client.Message) bool {
+	if matchAny(p.ignore, msg.From) {
+		return false
+	}
+	if len(p.allow) > 0 && !matchAny(p.allow, msg.From) {
+		return false
+	}
+	if p.mentionOnly && !msg.Mentions(p.self) {
+		// A request is addressed to us whether or not it mentions us
+		return msg.IsRequest()
+	}
+	return true
+}
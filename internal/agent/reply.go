@@ -0,0 +1,375 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// Action is a reviewer's decision on an AI draft.
+type Action int
+
+const (
+	Approve    Action = iota // send the draft as written
+	Edit                     // send Decision.Text instead
+	Regenerate               // ask the model for a new draft
+	Discard                  // do not reply
+)
+
+// Decision is a reviewer's action on a draft, with the replacement text for Edit.
+type Decision struct {
+	Action Action
+	Text   string
+}
+
+// replyLoop is the AI worker. It takes the messages queued on replyChan, coalesces
+// those from the same sender, and answers each group in turn, so a burst of messages
+// that arrived while a query ran gets one reply. It runs until ctx ends, which also
+// aborts a query in flight, or replyChan is closed.
+func (a *Agent) replyLoop(ctx context.Context, replyChan <-chan *client.Message) {
+	for {
+		batch, ok := nextBatch(ctx, replyChan)
+		if !ok {
+			return
+		}
+		for _, group := range coalesce(batch) {
+			a.answer(ctx, group)
+			a.busy.Add(-int32(len(group)))
+		}
+		a.yieldIdle()
+	}
+}
+
+// nextBatch waits for a message on replyChan and returns it with every other message
+// already queued. It reports false once ctx ends or replyChan is closed.
+func nextBatch(ctx context.Context, replyChan <-chan *client.Message) ([]*client.Message, bool) {
+	var batch []*client.Message
+	select {
+	case msg, ok := <-replyChan:
+		if !ok {
+			return nil, false
+		}
+		batch = append(batch, msg)
+	case <-ctx.Done():
+		return nil, false
+	}
+	for {
+		select {
+		case msg, ok := <-replyChan:
+			if !ok {
+				return batch, true
+			}
+			batch = append(batch, msg)
+		default:
+			return batch, true
+		}
+	}
+}
+
+// coalesce groups messages by sender, in order of each sender's first message. A
+// request closes its sender's group, since every request needs a reply of its own.
+func coalesce(batch []*client.Message) [][]*client.Message {
+	var groups [][]*client.Message
+	open := make(map[string]int) // index of each sender's open group
+	for _, msg := range batch {
+		i, ok := open[msg.From]
+		if !ok {
+			i = len(groups)
+			groups = append(groups, nil)
+			open[msg.From] = i
+		}
+		groups[i] = append(groups[i], msg)
+		if msg.IsRequest() {
+			delete(open, msg.From)
+		}
+	}
+	return groups
+}
+
+// answer adds a group of messages from one sender to its conversation and, if the
+// policy allows, answers the last of them with an AI reply until guard stops the
+// conversation
+func (a *Agent) answer(ctx context.Context, group []*client.Message) {
+	msg := group[len(group)-1]
+	answers := false
+	for _, m := range group {
+		a.conversations.Add(m.From, m.From, ContextText(m))
+		answers = answers || a.policy.Answers(m)
+	}
+	if a.aiClient == nil || !answers {
+		return
+	}
+
+	// Stop replying to anyone once the spend ceiling is reached
+	if a.ledger.OverBudget() {
+		if !a.overBudget {
+			a.hooks.Logf("Warning: stopped AI replies: spend ceiling of $%.2f reached", a.ledger.Ceiling())
+			a.overBudget = true
+		}
+		return
+	}
+
+	// Charge the queries made for this reply to the sender's conversation, so
+	// the tokens they used are the growth of its spend
+	ctx = ai.WithConversation(ctx, msg.From)
+	spent := a.ledger.Conversation(msg.From)
+
+	// Skip the reply if the conversation has run too long or too fast. Each stop
+	// condition is reported once, when it triggers.
+	for _, m := range group {
+		if err := a.guard.Check(m.From, m.Content); err != nil {
+			switch {
+			case errors.Is(err, ai.ErrStopped):
+			case errors.Is(err, ai.ErrCooldown):
+				a.hooks.Logf("Warning: not replying to %s: %v", m.From, err)
+			default:
+				a.hooks.Logf("Warning: stopped AI replies to %s: %v", m.From, err)
+			}
+			return
+		}
+	}
+
+	// Under floor control, wait for the turn before drafting the reply
+	if err := a.c.WaitTurn(ctx); err != nil {
+		return
+	}
+	turn := a.c.Turn()
+
+	// Render the system prompt for this conversation
+	model := a.profile.Model
+	system, err := a.prompt.Render(ai.PromptVars{
+		Self:  a.c.ID(),
+		Peer:  msg.From,
+		Peers: a.peers(ctx),
+		Room:  a.c.Room(),
+		Model: model,
+		Now:   time.Now(),
+	})
+	if err != nil {
+		a.hooks.Logf("Error: %v", err)
+		return
+	}
+
+	// Take the part of the conversation that fits the token budget
+	qctx, cancel := a.query(ctx)
+	contextCopy, err := a.conversations.Query(qctx, msg.From, a.manager, system)
+	cancel()
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		a.hooks.Logf("Warning: %v; using the most recent messages only", err)
+		contextCopy = a.manager.Window(system, a.conversations.Context(msg.From))
+	}
+
+	var response string
+	if a.hooks.Review != nil {
+		response, err = a.reviewedReply(ctx, msg, system, contextCopy)
+	} else {
+		response, err = a.streamReply(ctx, msg, system, contextCopy)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			a.hooks.Logf("Error: AI query failed: %v", err)
+		}
+		return
+	}
+	if len(response) == 0 {
+		return
+	}
+	a.repliedOn.Store(turn.Number)
+
+	// Add sent reply, without the end marker, to AI query context
+	if sent := a.guard.StripMarker(response); sent != "" {
+		a.conversations.Add(msg.From, a.c.ID(), sent)
+		if a.hooks.OnReply != nil {
+			a.hooks.OnReply(msg.From, sent)
+		}
+	}
+	a.passTurn(msg.From)
+
+	now := a.ledger.Conversation(msg.From)
+	tokens := now.PromptTokens + now.CompletionTokens - spent.PromptTokens - spent.CompletionTokens
+	if err := a.guard.Record(msg.From, response, tokens); err != nil {
+		a.hooks.Logf("Warning: stopped AI replies to %s: %v", msg.From, err)
+	}
+}
+
+// rosterTimeout bounds the wait for the server's list of connected clients
+const rosterTimeout = 5 * time.Second
+
+// peers returns the other clients connected to the server, for the system prompt.
+// If the server does not answer, the peers this agent has conversations with are
+// used instead.
+func (a *Agent) peers(ctx context.Context) []string {
+	ctx, cancel := context.WithTimeout(ctx, rosterTimeout)
+	defer cancel()
+	roster, err := a.c.Roster(ctx)
+	if err != nil {
+		a.hooks.Logf("Warning: could not list connected clients: %v", err)
+		return a.conversations.Keys()
+	}
+	return slices.DeleteFunc(roster, func(id string) bool { return id == a.c.ID() })
+}
+
+// streamReply queries the AI and streams the response, less the end marker, to
+// the sender of msg. The response is returned as the model wrote it.
+func (a *Agent) streamReply(ctx context.Context, msg *client.Message, system string, queryContext []string) (string, error) {
+	qctx, cancel := a.query(ctx)
+	defer cancel()
+
+	reply := a.c.NewStream(ctx, msg.From, a.replyAttrs(msg))
+	started := false
+	filter := a.guard.NewMarkerFilter(func(chunk string) error {
+		started = true
+		if a.hooks.OnReplyChunk != nil {
+			a.hooks.OnReplyChunk(msg.From, chunk, false)
+		}
+		return reply.Write(chunk)
+	})
+	response, err := a.draft(qctx, msg.From, system, queryContext, filter.Write)
+	if err == nil {
+		err = filter.Flush()
+	}
+	if started && a.hooks.OnReplyChunk != nil {
+		a.hooks.OnReplyChunk(msg.From, "", true)
+	}
+	if closeErr := reply.Close(err); err == nil {
+		err = closeErr
+	}
+	return response, err
+}
+
+// draft queries the AI for a reply to peer, passing it to emit as it is produced
+// if emit is set. When the model has tools it may call them first, and when replies
+// must match a schema it is asked again until one does; the reply is then emitted
+// whole.
+func (a *Agent) draft(ctx context.Context, peer, system string, queryContext []string, emit func(chunk string) error) (string, error) {
+	if a.schema == nil {
+		return a.compose(ctx, peer, system, queryContext, emit)
+	}
+
+	structured := &ai.StructuredQuery{
+		Schema:  a.schema,
+		Retries: a.profile.Output.Retries,
+		OnInvalid: func(response string, err error) {
+			a.hooks.Logf("Warning: reply to %s does not match the schema: %v", peer, err)
+		},
+	}
+	response, err := structured.Query(ctx, system, queryContext, func(ctx context.Context, system string, prompts []string) (string, error) {
+		return a.compose(ctx, peer, system, prompts, nil)
+	})
+	if err != nil || emit == nil {
+		return response, err
+	}
+	return response, emit(response)
+}
+
+// compose queries the AI for a free-text reply to peer, running the model's tool
+// calls first if it has tools. The reply is passed to emit, if set, as it is produced.
+func (a *Agent) compose(ctx context.Context, peer, system string, queryContext []string, emit func(chunk string) error) (string, error) {
+	model := a.profile.Model
+	if a.tools == nil {
+		if emit == nil {
+			return ai.AIQuery(ctx, a.aiClient, system, queryContext, model)
+		}
+		return ai.AIQueryStream(ctx, a.aiClient, system, queryContext, model, emit)
+	}
+
+	loop := &ai.ToolLoop{
+		Tools:     a.tools,
+		MaxRounds: a.profile.Tools.MaxRounds,
+		Options:   a.profile.Options(),
+		OnCall: func(call ai.ToolCall, result ai.ToolResult) {
+			if a.hooks.OnToolCall != nil {
+				a.hooks.OnToolCall(peer, call, result)
+			}
+		},
+	}
+	response, err := loop.Query(ctx, a.aiClient, system, queryContext, model)
+	if err != nil || emit == nil || response == "" {
+		return response, err
+	}
+	return response, emit(response)
+}
+
+// reviewedReply drafts a reply to msg and sends it, less the end marker, once the
+// reviewer approves it, regenerating the draft as often as asked. An edit that does
+// not match the output schema is refused and the draft shown again with the problem.
+// It returns the approved reply, empty if the draft was discarded.
+func (a *Agent) reviewedReply(ctx context.Context, msg *client.Message, system string, queryContext []string) (string, error) {
+drafting:
+	for {
+		qctx, cancel := a.query(ctx)
+		draft, err := a.draft(qctx, msg.From, system, queryContext, nil)
+		cancel()
+		if err != nil {
+			return "", err
+		}
+
+		var problem error
+		for {
+			d := a.hooks.Review(ctx, msg.From, draft, problem)
+			switch d.Action {
+			case Regenerate:
+				continue drafting
+			case Discard:
+				return "", nil
+			case Edit:
+				if a.schema != nil {
+					if err := a.schema.Validate([]byte(d.Text)); err != nil {
+						problem = fmt.Errorf("edited reply does not match the schema: %w", err)
+						continue
+					}
+				}
+				draft = d.Text
+			}
+
+			// Send the approved text as a stream so long replies need not fit one frame
+			reply := a.c.NewStream(ctx, msg.From, a.replyAttrs(msg))
+			err = reply.Write(a.guard.StripMarker(draft))
+			if closeErr := reply.Close(err); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to send reply: %w", err)
+			}
+			return draft, nil
+		}
+	}
+}
+
+// replyAttrs returns the attributes of a reply to msg: JSON content when replies
+// follow a schema
+func (a *Agent) replyAttrs(msg *client.Message) *client.Message {
+	attrs := &client.Message{ReplyTo: msg.RequestID}
+	if a.schema != nil {
+		attrs.ContentType = client.ContentTypeJSON
+	}
+	return attrs
+}
+
+// ContextText returns the text a message contributes to the AI query context.
+func ContextText(msg *client.Message) string {
+	if !msg.IsAttachment() {
+		return msg.Content
+	}
+	if msg.Content == "" {
+		return DescribeAttachment(msg)
+	}
+	return msg.Content + "\n" + DescribeAttachment(msg)
+}
+
+// DescribeAttachment summarizes a message's data for display and the AI context.
+func DescribeAttachment(msg *client.Message) string {
+	name := msg.Filename
+	if name == "" {
+		name = "(unnamed)"
+	}
+	return fmt.Sprintf("[attachment %s, %s, %d bytes]", name, msg.ContentType, len(msg.Data))
+}
@@ -0,0 +1,314 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// Built-in tools a profile may enable.
+const (
+	ToolCalculate   = "calculate"
+	ToolReadFile    = "read_file"
+	ToolListFiles   = "list_files"
+	ToolListClients = "list_clients"
+)
+
+// BuiltinToolNames lists the built-in tools.
+var BuiltinToolNames = []string{ToolCalculate, ToolReadFile, ToolListFiles, ToolListClients}
+
+// RosterFunc returns the IDs of the clients connected to the server.
+type RosterFunc func(ctx context.Context) ([]string, error)
+
+// maxFileRead is the most a read_file call returns
+const maxFileRead = ai.MaxToolResult
+
+// BuiltinTools returns the built-in tools named by names. The file tools read
+// only within dir, and list_clients asks roster.
+func BuiltinTools(names []string, dir string, roster RosterFunc) (*ai.Tools, error) {
+	tools := ai.NewTools()
+	for _, name := range names {
+		var tool ai.Tool
+		switch name {
+		case ToolCalculate:
+			tool = calculateTool()
+		case ToolReadFile, ToolListFiles:
+			if dir == "" {
+				return nil, fmt.Errorf("tool %s needs a files directory", name)
+			}
+			if name == ToolReadFile {
+				tool = readFileTool(dir)
+			} else {
+				tool = listFilesTool(dir)
+			}
+		case ToolListClients:
+			if roster == nil {
+				return nil, fmt.Errorf("tool %s needs a connection to the server", name)
+			}
+			tool = listClientsTool(roster)
+		default:
+			return nil, fmt.Errorf("unknown tool %q (want one of %s)", name, strings.Join(BuiltinToolNames, ", "))
+		}
+		if err := tools.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return tools, nil
+}
+
+// calculateTool evaluates arithmetic
+func calculateTool() ai.Tool {
+	return ai.Tool{
+		Name:        ToolCalculate,
+		Description: "Evaluate an arithmetic expression with + - * / %, parentheses and the functions sqrt, pow, abs, floor, ceil, round, log, exp, sin, cos and tan.",
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {"expression": {"type": "string", "description": "expression to evaluate, e.g. (2 + 3) * sqrt(16)"}},
+			"required": ["expression"]
+		}`),
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var a struct {
+				Expression string `json:"expression"`
+			}
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			value, err := Calculate(a.Expression)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(value, 'g', -1, 64), nil
+		},
+	}
+}
+
+// Calculate evaluates an arithmetic expression as the calculate tool does.
+func Calculate(expression string) (float64, error) {
+	expr, err := parser.ParseExpr(expression)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expression: %w", err)
+	}
+	return evaluate(expr)
+}
+
+// functions are the functions calculate understands, by number of arguments
+var functions = map[string]any{
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"log":   math.Log,
+	"exp":   math.Exp,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"pow":   math.Pow,
+}
+
+// evaluate computes the value of an arithmetic expression
+func evaluate(expr ast.Expr) (float64, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return 0, fmt.Errorf("unexpected %s", e.Value)
+		}
+		return strconv.ParseFloat(e.Value, 64)
+
+	case *ast.ParenExpr:
+		return evaluate(e.X)
+
+	case *ast.UnaryExpr:
+		x, err := evaluate(e.X)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x, nil
+		case token.SUB:
+			return -x, nil
+		}
+		return 0, fmt.Errorf("unsupported operator %s", e.Op)
+
+	case *ast.BinaryExpr:
+		x, err := evaluate(e.X)
+		if err != nil {
+			return 0, err
+		}
+		y, err := evaluate(e.Y)
+		if err != nil {
+			return 0, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return x + y, nil
+		case token.SUB:
+			return x - y, nil
+		case token.MUL:
+			return x * y, nil
+		case token.QUO:
+			if y == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return x / y, nil
+		case token.REM:
+			if y == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return math.Mod(x, y), nil
+		}
+		return 0, fmt.Errorf("unsupported operator %s", e.Op)
+
+	case *ast.CallExpr:
+		name, ok := e.Fun.(*ast.Ident)
+		if !ok {
+			return 0, errors.New("unsupported function call")
+		}
+		args := make([]float64, len(e.Args))
+		for i, arg := range e.Args {
+			v, err := evaluate(arg)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = v
+		}
+		switch f := functions[name.Name].(type) {
+		case func(float64) float64:
+			if len(args) != 1 {
+				return 0, fmt.Errorf("%s takes 1 argument", name.Name)
+			}
+			return f(args[0]), nil
+		case func(float64, float64) float64:
+			if len(args) != 2 {
+				return 0, fmt.Errorf("%s takes 2 arguments", name.Name)
+			}
+			return f(args[0], args[1]), nil
+		}
+		return 0, fmt.Errorf("unknown function %s", name.Name)
+
+	case *ast.Ident:
+		switch e.Name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+		return 0, fmt.Errorf("unknown name %s", e.Name)
+	}
+	return 0, errors.New("unsupported expression")
+}
+
+// pathArgs are the arguments of the file tools
+type pathArgs struct {
+	Path string `json:"path"`
+}
+
+// readFileTool reads text files within dir
+func readFileTool(dir string) ai.Tool {
+	return ai.Tool{
+		Name:        ToolReadFile,
+		Description: "Read a text file from the shared files directory.",
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {"path": {"type": "string", "description": "file path relative to the files directory"}},
+			"required": ["path"]
+		}`),
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var a pathArgs
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			root, err := os.OpenRoot(dir)
+			if err != nil {
+				return "", err
+			}
+			defer root.Close()
+
+			f, err := root.Open(a.Path)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			data, err := io.ReadAll(io.LimitReader(f, maxFileRead+1))
+			if err != nil {
+				return "", err
+			}
+			if len(data) > maxFileRead {
+				return string(data[:maxFileRead]) + "\n[file truncated]", nil
+			}
+			return string(data), nil
+		},
+	}
+}
+
+// listFilesTool lists the files within dir
+func listFilesTool(dir string) ai.Tool {
+	return ai.Tool{
+		Name:        ToolListFiles,
+		Description: "List the entries of a directory in the shared files directory.",
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {"path": {"type": "string", "description": "directory path relative to the files directory; empty for the top"}}
+		}`),
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			var a pathArgs
+			if err := json.Unmarshal(args, &a); err != nil {
+				return "", err
+			}
+			if a.Path == "" {
+				a.Path = "."
+			}
+			root, err := os.OpenRoot(dir)
+			if err != nil {
+				return "", err
+			}
+			defer root.Close()
+
+			entries, err := fs.ReadDir(root.FS(), a.Path)
+			if err != nil {
+				return "", err
+			}
+			var b strings.Builder
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() {
+					name += "/"
+				}
+				fmt.Fprintln(&b, name)
+			}
+			if b.Len() == 0 {
+				return "(empty)", nil
+			}
+			return b.String(), nil
+		},
+	}
+}
+
+// listClientsTool lists the clients connected to the server
+func listClientsTool(roster RosterFunc) ai.Tool {
+	return ai.Tool{
+		Name:        ToolListClients,
+		Description: "List the IDs of the clients connected to the chat server, including your own.",
+		Schema:      json.RawMessage(`{"type": "object", "properties": {}}`),
+		Handler: func(ctx context.Context, args json.RawMessage) (string, error) {
+			ids, err := roster(ctx)
+			if err != nil {
+				return "", err
+			}
+			return strings.Join(ids, "\n"), nil
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+)
+
+// yieldGrace is how long an idle agent holds a turn it is handed before passing
+// it on, so that a message sent just before the turn can still arrive
+const yieldGrace = 250 * time.Millisecond
+
+// turnLoop gives up each turn the agent is handed while it has nothing to answer,
+// so that under floor control an idle agent does not hold the floor until the
+// turn times out. It runs until ctx ends or the connection closes.
+func (a *Agent) turnLoop(ctx context.Context) {
+	for {
+		changed := a.c.TurnChanged()
+		if a.idleTurn() {
+			timer := time.NewTimer(yieldGrace)
+			select {
+			case <-timer.C:
+				a.yieldIdle()
+			case <-changed:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		case <-a.c.Done():
+			return
+		}
+	}
+}
+
+// idleTurn reports whether the agent holds the turn with nothing to answer and
+// has not already replied on it
+func (a *Agent) idleTurn() bool {
+	turn := a.c.Turn()
+	return turn.Mode != "" && turn.Holder == a.c.ID() && !a.Busy() && turn.Number != a.repliedOn.Load()
+}
+
+// yieldIdle passes the turn on if the agent holds it with nothing to answer
+func (a *Agent) yieldIdle() {
+	if !a.idleTurn() {
+		return
+	}
+	if err := a.c.PassTurn(""); err != nil {
+		a.hooks.Logf("Warning: failed to pass the turn: %v", err)
+	}
+}
+
+// passTurn hands a token-passing turn to peer after replying to it, so the peer
+// can answer
+func (a *Agent) passTurn(peer string) {
+	turn := a.c.Turn()
+	if turn.Mode != client.FloorToken || turn.Holder != a.c.ID() {
+		return
+	}
+	if err := a.c.PassTurn(peer); err != nil {
+		a.hooks.Logf("Warning: failed to pass the turn to %s: %v", peer, err)
+	}
+}
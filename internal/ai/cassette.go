@@ -0,0 +1,271 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// ErrCassetteMismatch is returned by a strict Replayer when a query does not match
+// the next recorded interaction.
+var ErrCassetteMismatch = errors.New("query does not match the recording")
+
+// ErrCassetteExhausted is returned by a Replayer with no recorded interaction left
+// to answer a query.
+var ErrCassetteExhausted = errors.New("no recorded response left")
+
+// Interaction is one recorded query and its outcome. A cassette file holds one
+// Interaction per line, as JSON.
+type Interaction struct {
+	Time     time.Time `json:"time"`
+	Model    string    `json:"model"`
+	System   string    `json:"system"`
+	Prompts  []string  `json:"prompts"`
+	Response string    `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Latency  float64   `json:"latency_ms"`
+}
+
+// matches reports whether the interaction was recorded for the same query
+func (i *Interaction) matches(system string, prompts []string, model string) bool {
+	return i.Model == model && i.System == system && slices.Equal(i.Prompts, prompts)
+}
+
+// Recorder is a Client that passes queries to another Client and appends each
+// one, with its response and latency, to a cassette file.
+type Recorder struct {
+	client Client
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Ensure Recorder implements StreamingUsageClient, UsageClient and ToolClient
+var (
+	_ StreamingUsageClient = (*Recorder)(nil)
+	_ UsageClient          = (*Recorder)(nil)
+	_ ToolClient           = (*Recorder)(nil)
+)
+
+// NewRecorder records the queries made through client to the cassette at path,
+// replacing any earlier recording.
+func NewRecorder(client Client, path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cassette: %w", err)
+	}
+	return &Recorder{client: client, file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// QueryText implements Client.
+func (r *Recorder) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	start := time.Now()
+	response, err := r.client.QueryText(ctx, system, prompts, model, options)
+	r.record(start, system, prompts, model, response, err)
+	return response, err
+}
+
+// QueryTextUsage implements UsageClient with the usage the wrapped client reports,
+// or an estimate.
+func (r *Recorder) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, Usage, error) {
+	start := time.Now()
+	response, usage, err := queryUsage(ctx, r.client, system, prompts, model, options)
+	r.record(start, system, prompts, model, response, err)
+	return response, usage, err
+}
+
+// QueryTextStream implements StreamingClient. The response is streamed if the
+// wrapped client can stream.
+func (r *Recorder) QueryTextStream(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error) {
+	response, _, err := r.QueryTextStreamUsage(ctx, system, prompts, model, options, emit)
+	return response, err
+}
+
+// QueryTextStreamUsage implements StreamingUsageClient.
+func (r *Recorder) QueryTextStreamUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error) {
+	start := time.Now()
+	response, usage, err := queryStreamUsage(ctx, r.client, system, prompts, model, options, emit)
+	r.record(start, system, prompts, model, response, err)
+	return response, usage, err
+}
+
+// QueryTextTools implements ToolClient. A native tool query is recorded as the
+// text query a Replayer is given, with the calls written as tool_call blocks.
+func (r *Recorder) QueryTextTools(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error) {
+	if _, ok := r.client.(ToolClient); !ok {
+		return queryTools(ctx, clientFunc(r.QueryText), system, prompts, model, options, tools, rounds)
+	}
+	start := time.Now()
+	response, calls, err := queryTools(ctx, r.client, system, prompts, model, options, tools, rounds)
+	recorded := response
+	if len(calls) > 0 {
+		recorded = strings.TrimSpace(response + "\n" + toolCallText(calls))
+	}
+	textSystem, textPrompts := toolText(system, prompts, tools, rounds)
+	r.record(start, textSystem, textPrompts, model, recorded, err)
+	return response, calls, err
+}
+
+// record appends an interaction to the cassette. Recording is best effort; a
+// failed write does not fail the query.
+func (r *Recorder) record(start time.Time, system string, prompts []string, model, response string, queryErr error) {
+	interaction := &Interaction{
+		Time:     start,
+		Model:    model,
+		System:   system,
+		Prompts:  prompts,
+		Response: response,
+		Latency:  float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if queryErr != nil {
+		interaction.Response = ""
+		interaction.Error = queryErr.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.enc.Encode(interaction)
+}
+
+// Close closes the cassette and the wrapped client.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	err := r.file.Close()
+	r.mu.Unlock()
+	if clientErr := r.client.Close(); err == nil {
+		err = clientErr
+	}
+	return err
+}
+
+// Replayer is a Client that answers queries from a cassette instead of a provider.
+// A strict Replayer requires queries to arrive exactly as recorded, in order;
+// otherwise each query gets the first unused recording of the same query, or else
+// the next unused recording.
+type Replayer struct {
+	strict bool
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	next         int // first unused interaction
+}
+
+// Ensure Replayer implements Client
+var _ Client = (*Replayer)(nil)
+
+// LoadCassette reads the interactions recorded in the cassette at path.
+func LoadCassette(path string) ([]*Interaction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var interactions []*Interaction
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		interaction := &Interaction{}
+		if err := json.Unmarshal(scanner.Bytes(), interaction); err != nil {
+			return nil, fmt.Errorf("cassette %s line %d: %w", path, line, err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	return interactions, nil
+}
+
+// NewReplayer creates a Replayer for the cassette at path.
+func NewReplayer(path string, strict bool) (*Replayer, error) {
+	interactions, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{
+		strict:       strict,
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+	}, nil
+}
+
+// QueryText implements Client.
+func (r *Replayer) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	interaction, err := r.take(system, prompts, model)
+	if err != nil {
+		return "", err
+	}
+	if interaction.Error != "" {
+		return "", errors.New(interaction.Error)
+	}
+	return interaction.Response, nil
+}
+
+// take finds and uses up the recording that answers a query
+func (r *Replayer) take(system string, prompts []string, model string) (*Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for r.next < len(r.interactions) && r.used[r.next] {
+		r.next++
+	}
+	if r.next == len(r.interactions) {
+		return nil, ErrCassetteExhausted
+	}
+
+	found := -1
+	if r.strict {
+		if !r.interactions[r.next].matches(system, prompts, model) {
+			return nil, fmt.Errorf("%w: query %d (model %s, %d prompts)", ErrCassetteMismatch, r.next+1, model, len(prompts))
+		}
+		found = r.next
+	} else {
+		for i := r.next; i < len(r.interactions); i++ {
+			if !r.used[i] && r.interactions[i].matches(system, prompts, model) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			found = r.next
+		}
+	}
+
+	r.used[found] = true
+	return r.interactions[found], nil
+}
+
+// Remaining returns the number of recorded interactions not yet replayed.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	remaining := 0
+	for _, used := range r.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+// Close implements Client.
+func (r *Replayer) Close() error { return nil }
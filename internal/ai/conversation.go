@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Conversations holds a separate AI query context for each conversation, keyed by
+// the peer (or room) it is with, so a reply to one peer never draws on another's
+// history. Safe for concurrent use.
+type Conversations struct {
+	mu       sync.Mutex
+	contexts map[string][]string
+}
+
+// NewConversations creates an empty set of conversations.
+func NewConversations() *Conversations {
+	return &Conversations{
+		contexts: make(map[string][]string),
+	}
+}
+
+// Add appends content from id to the conversation with key, tagged as by AIAddContext.
+func (c *Conversations) Add(key, id, content string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.contexts[key] = AIAddContext(c.contexts[key], id, content)
+}
+
+// Context returns a copy of the query context for the conversation with key.
+func (c *Conversations) Context(key string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.contexts[key]...)
+}
+
+// Query returns the context to send for the conversation with key, brought within
+// the budget of m. Strategies that rewrite the history store the result, so older
+// entries are dropped or summarized once rather than on every query.
+func (c *Conversations) Query(ctx context.Context, key string, m *ContextManager, system string) ([]string, error) {
+	entries := c.Context(key)
+	query, history, err := m.Fit(ctx, system, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the entries that were fitted, keeping any added meanwhile. Skip the
+	// update if the conversation was cleared or rewritten concurrently.
+	if !slices.Equal(history, entries) {
+		c.mu.Lock()
+		current := c.contexts[key]
+		if len(current) >= len(entries) && len(entries) > 0 && current[len(entries)-1] == entries[len(entries)-1] {
+			c.contexts[key] = append(history, current[len(entries):]...)
+		}
+		c.mu.Unlock()
+	}
+	return query, nil
+}
+
+// Clear discards the conversation with key.
+func (c *Conversations) Clear(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.contexts, key)
+}
+
+// Keys returns the keys of all conversations, sorted.
+func (c *Conversations) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.contexts))
+	for key := range c.contexts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of entries in the conversation with key.
+func (c *Conversations) Len(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.contexts[key])
+}
@@ -0,0 +1,349 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// Defaults for FailoverConfig fields left zero.
+const (
+	DefaultMaxAttempts      = 3
+	DefaultBaseDelay        = 500 * time.Millisecond
+	DefaultMaxDelay         = 10 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned for a model whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// transientMarkers are fragments of provider error messages for failures worth retrying
+var transientMarkers = []string{
+	"429", "500", "502", "503", "504", "529",
+	"rate limit", "rate_limit", "overloaded", "timeout", "timed out",
+	"temporarily", "unavailable", "connection reset", "connection refused",
+}
+
+// IsTransient reports whether err is a failure, such as a rate limit or a timeout,
+// that may succeed if retried.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrFakeFailure) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range transientMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// FailoverConfig configures a Failover. Zero fields take the defaults above.
+type FailoverConfig struct {
+	// Fallbacks are the models tried in order when the requested model fails.
+	Fallbacks []string
+
+	// MaxAttempts is how many times each model is tried for a transient failure.
+	MaxAttempts int
+
+	// BaseDelay and MaxDelay bound the jittered exponential backoff between attempts.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// BreakerThreshold consecutive failures open a model's circuit breaker, which
+	// skips the model for BreakerCooldown before letting one query try it again.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Logf reports retries, failovers and the model that answered (default log.Printf).
+	Logf func(format string, args ...any)
+}
+
+// breaker is the circuit breaker state of one model
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Failover is a Client that retries transient failures with backoff and falls back
+// to other models, possibly from other providers, when a model keeps failing.
+// Clients for fallback models are created when first needed. Safe for concurrent use.
+type Failover struct {
+	cfg FailoverConfig
+
+	mu       sync.Mutex
+	clients  map[string]Client
+	breakers map[string]*breaker
+}
+
+// Ensure Failover implements StreamingUsageClient, UsageClient and ToolClient
+var (
+	_ StreamingUsageClient = (*Failover)(nil)
+	_ UsageClient          = (*Failover)(nil)
+	_ ToolClient           = (*Failover)(nil)
+)
+
+// NewFailover creates a Failover that uses primary for primaryModel and fails over
+// to cfg.Fallbacks. Each fallback must name a model of a known provider.
+func NewFailover(primary Client, primaryModel string, cfg FailoverConfig) (*Failover, error) {
+	for _, model := range cfg.Fallbacks {
+		if IsFake(model) {
+			continue
+		}
+		if _, err := llmclient.GetProviderName(model); err != nil {
+			return nil, fmt.Errorf("fallback model %s: %w", model, err)
+		}
+	}
+
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = DefaultBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = DefaultMaxDelay
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+
+	return &Failover{
+		cfg:      cfg,
+		clients:  map[string]Client{primaryModel: primary},
+		breakers: make(map[string]*breaker),
+	}, nil
+}
+
+// QueryText implements Client.
+func (f *Failover) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	return f.query(ctx, model, func(c Client, m string) (string, error) {
+		return c.QueryText(ctx, system, prompts, m, options)
+	})
+}
+
+// QueryTextUsage implements UsageClient with the usage of the attempt that answered.
+func (f *Failover) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, Usage, error) {
+	var usage Usage
+	response, err := f.query(ctx, model, func(c Client, m string) (string, error) {
+		response, attemptUsage, err := queryUsage(ctx, c, system, prompts, m, options)
+		usage = attemptUsage
+		return response, err
+	})
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return response, usage, nil
+}
+
+// QueryTextStream implements StreamingClient. Once part of a response has been
+// emitted the query is no longer retried, since the text cannot be taken back.
+func (f *Failover) QueryTextStream(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error) {
+	response, _, err := f.QueryTextStreamUsage(ctx, system, prompts, model, options, emit)
+	return response, err
+}
+
+// QueryTextStreamUsage implements StreamingUsageClient, retrying as QueryTextStream does.
+func (f *Failover) QueryTextStreamUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error) {
+	emitted := false
+	var usage Usage
+	response, err := f.query(ctx, model, func(c Client, m string) (string, error) {
+		if emitted {
+			return "", errStreamStarted
+		}
+		response, attemptUsage, err := queryStreamUsage(ctx, c, system, prompts, m, options, func(chunk string) error {
+			emitted = true
+			return emit(chunk)
+		})
+		usage = attemptUsage
+		return response, err
+	})
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return response, usage, nil
+}
+
+// QueryTextTools implements ToolClient. A fallback model is given the rounds
+// made so far, even if they were made with another model.
+func (f *Failover) QueryTextTools(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error) {
+	var calls []ToolCall
+	response, err := f.query(ctx, model, func(c Client, m string) (string, error) {
+		response, attemptCalls, err := queryTools(ctx, c, system, prompts, m, options, tools, rounds)
+		calls = attemptCalls
+		return response, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return response, calls, nil
+}
+
+// errStreamStarted stops retries once a streamed response has begun
+var errStreamStarted = errors.New("response already partly sent")
+
+// query runs attempt against model and then each fallback until one answers, and
+// reports the model that answered to a Meter above
+func (f *Failover) query(ctx context.Context, model string, attempt func(c Client, model string) (string, error)) (string, error) {
+	var errs []error
+	models := append([]string{model}, f.cfg.Fallbacks...)
+	for i, m := range models {
+		if i > 0 {
+			f.cfg.Logf("AI model %s failed, falling back to %s", models[i-1], m)
+		}
+		response, err := f.tryModel(ctx, m, attempt)
+		if err == nil {
+			if i > 0 {
+				f.cfg.Logf("AI reply answered by fallback model %s", m)
+			}
+			reportAnswered(ctx, m)
+			return response, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", m, err))
+		if ctx.Err() != nil || errors.Is(err, errStreamStarted) {
+			break
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+// tryModel queries model, retrying transient failures with backoff
+func (f *Failover) tryModel(ctx context.Context, model string, attempt func(c Client, model string) (string, error)) (string, error) {
+	c, err := f.client(model)
+	if err != nil {
+		return "", err
+	}
+
+	for n := 1; ; n++ {
+		if !f.allow(model) {
+			return "", ErrCircuitOpen
+		}
+
+		response, err := attempt(c, model)
+		if err == nil {
+			f.succeeded(model)
+			if n > 1 {
+				f.cfg.Logf("AI query to %s succeeded on attempt %d", model, n)
+			}
+			return response, nil
+		}
+		if errors.Is(err, errStreamStarted) || ctx.Err() != nil {
+			return "", err
+		}
+		f.failed(model)
+
+		if !IsTransient(err) || n >= f.cfg.MaxAttempts {
+			return "", err
+		}
+		delay := f.backoff(n)
+		f.cfg.Logf("AI query to %s failed (attempt %d of %d), retrying in %v: %v", model, n, f.cfg.MaxAttempts, delay.Round(time.Millisecond), err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		}
+	}
+}
+
+// backoff returns the delay before retry n: exponential in n, capped at MaxDelay,
+// with jitter over its upper half so clients do not retry in step
+func (f *Failover) backoff(n int) time.Duration {
+	delay := f.cfg.MaxDelay
+	if n < 32 {
+		delay = min(f.cfg.BaseDelay<<(n-1), f.cfg.MaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// client returns the client for model, creating it on first use
+func (f *Failover) client(model string) (Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if c, ok := f.clients[model]; ok {
+		return c, nil
+	}
+	c, err := AIClient(model)
+	if err != nil {
+		return nil, err
+	}
+	f.clients[model] = c
+	return c, nil
+}
+
+// allow reports whether model's circuit breaker lets a query through. After the
+// cooldown one query is let through; the breaker closes if it succeeds.
+func (f *Failover) allow(model string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.breakers[model]
+	if !ok || b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) {
+		return false
+	}
+	// Half open: a failure reopens the breaker at once
+	b.failures = f.cfg.BreakerThreshold - 1
+	b.openUntil = time.Time{}
+	return true
+}
+
+// succeeded closes model's circuit breaker
+func (f *Failover) succeeded(model string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.breakers, model)
+}
+
+// failed counts a failure of model, opening its breaker at the threshold
+func (f *Failover) failed(model string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, ok := f.breakers[model]
+	if !ok {
+		b = &breaker{}
+		f.breakers[model] = b
+	}
+	b.failures++
+	if b.failures >= f.cfg.BreakerThreshold {
+		b.openUntil = time.Now().Add(f.cfg.BreakerCooldown)
+		f.cfg.Logf("AI model %s failed %d times in a row, pausing it for %v", model, b.failures, f.cfg.BreakerCooldown)
+	}
+}
+
+// Close closes every client the Failover uses.
+func (f *Failover) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var errs []error
+	for _, c := range f.clients {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,297 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// FakePrefix marks a model name served by FakeClient instead of a real provider.
+const FakePrefix = "fake:"
+
+// ErrFakeFailure is returned by FakeClient for queries configured to fail.
+var ErrFakeFailure = errors.New("fake: scripted failure")
+
+// FakeClient is a deterministic, offline Client for tests. It is selected by a model
+// name of the form
+//
+//	fake:<mode>[?option=value&...]
+//
+// where mode is one of
+//
+//	echo            reply with the text of the last context entry
+//	script=<path>   reply with the responses in path in turn, repeating from the
+//	                start when they run out; responses are separated by lines of ---
+//	template=<text> reply with a text/template executed with FakeQuery
+//
+// and the options, which follow the last ?, are
+//
+//	latency=<duration>  wait this long before each response
+//	fail-first=<n>      fail the first n queries with ErrFakeFailure
+//	fail-every=<n>      fail every nth query with ErrFakeFailure
+//
+// Streamed responses are delivered a word at a time. Usage is reported as one
+// token per word, and a response is cut to options.MaxTokens words if set.
+type FakeClient struct {
+	model     string
+	mode      string
+	responses []string
+	tmpl      *template.Template
+	latency   time.Duration
+	failFirst int
+	failEvery int
+
+	mu      sync.Mutex
+	queries int
+}
+
+// FakeQuery is the data a FakeClient template is executed with.
+type FakeQuery struct {
+	Model  string
+	System string
+	Turn   int    // 1 for the first query
+	From   string // ID the last context entry is tagged with
+	Last   string // text of the last context entry
+}
+
+// Ensure FakeClient implements StreamingUsageClient and UsageClient
+var (
+	_ StreamingUsageClient = (*FakeClient)(nil)
+	_ UsageClient          = (*FakeClient)(nil)
+)
+
+// IsFake reports whether model names a FakeClient.
+func IsFake(model string) bool {
+	return strings.HasPrefix(model, FakePrefix)
+}
+
+// NewFakeClient creates a FakeClient from a model name of the form described on FakeClient.
+func NewFakeClient(model string) (*FakeClient, error) {
+	if !IsFake(model) {
+		return nil, fmt.Errorf("fake: model %q does not start with %q", model, FakePrefix)
+	}
+	spec, options := splitOptions(strings.TrimPrefix(model, FakePrefix))
+	mode, arg, _ := strings.Cut(spec, "=")
+
+	f := &FakeClient{model: model, mode: mode}
+	switch mode {
+	case "echo":
+	case "script":
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("fake: failed to read script: %w", err)
+		}
+		f.responses = parseScript(string(data))
+		if len(f.responses) == 0 {
+			return nil, fmt.Errorf("fake: script %s has no responses", arg)
+		}
+	case "template":
+		tmpl, err := template.New("fake").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("fake: invalid template: %w", err)
+		}
+		f.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("fake: unknown mode %q (want echo, script or template)", mode)
+	}
+
+	for name, values := range options {
+		var err error
+		value := values[len(values)-1]
+		switch name {
+		case "latency":
+			f.latency, err = time.ParseDuration(value)
+		case "fail-first":
+			f.failFirst, err = strconv.Atoi(value)
+		case "fail-every":
+			f.failEvery, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fake: option %s=%s: %w", name, value, err)
+		}
+	}
+	return f, nil
+}
+
+// fakeOptions are the option names NewFakeClient accepts
+var fakeOptions = []string{"latency", "fail-first", "fail-every"}
+
+// splitOptions separates the options after the last ? from spec. A ? that is not
+// followed by valid options is taken as part of spec, so templates may contain one.
+func splitOptions(spec string) (string, url.Values) {
+	i := strings.LastIndex(spec, "?")
+	if i < 0 {
+		return spec, nil
+	}
+	options, err := url.ParseQuery(spec[i+1:])
+	if err != nil || len(options) == 0 {
+		return spec, nil
+	}
+	for name := range options {
+		if !slices.Contains(fakeOptions, name) {
+			return spec, nil
+		}
+	}
+	return spec[:i], options
+}
+
+// parseScript splits a script into responses separated by lines of ---
+func parseScript(script string) []string {
+	var responses []string
+	var current []string
+	flush := func() {
+		if text := strings.TrimSpace(strings.Join(current, "\n")); text != "" {
+			responses = append(responses, text)
+		}
+		current = nil
+	}
+	for line := range strings.SplitSeq(script, "\n") {
+		if strings.TrimSpace(line) == "---" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return responses
+}
+
+// Queries returns the number of queries made so far, including failed ones.
+func (f *FakeClient) Queries() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.queries
+}
+
+// QueryText implements Client.
+func (f *FakeClient) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	turn := f.nextTurn()
+
+	if f.latency > 0 {
+		timer := time.NewTimer(f.latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	} else if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if turn <= f.failFirst || (f.failEvery > 0 && turn%f.failEvery == 0) {
+		return "", fmt.Errorf("%w (query %d)", ErrFakeFailure, turn)
+	}
+	response, err := f.respond(turn, system, prompts)
+	if err != nil || options.MaxTokens <= 0 {
+		return response, err
+	}
+	words := strings.SplitAfter(response, " ")
+	if int64(len(words)) > options.MaxTokens {
+		response = strings.TrimRight(strings.Join(words[:options.MaxTokens], ""), " ")
+	}
+	return response, nil
+}
+
+// QueryTextStream implements StreamingClient, emitting the response a word at a time.
+func (f *FakeClient) QueryTextStream(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error) {
+	response, err := f.QueryText(ctx, system, prompts, model, options)
+	if err != nil {
+		return "", err
+	}
+	for _, word := range strings.SplitAfter(response, " ") {
+		if word == "" {
+			continue
+		}
+		if err := emit(word); err != nil {
+			return "", err
+		}
+	}
+	return response, nil
+}
+
+// QueryTextUsage implements UsageClient, counting one token per word.
+func (f *FakeClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, Usage, error) {
+	response, err := f.QueryText(ctx, system, prompts, model, options)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return response, fakeUsage(system, prompts, response), nil
+}
+
+// QueryTextStreamUsage implements StreamingUsageClient, counting as QueryTextUsage does.
+func (f *FakeClient) QueryTextStreamUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error) {
+	response, err := f.QueryTextStream(ctx, system, prompts, model, options, emit)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return response, fakeUsage(system, prompts, response), nil
+}
+
+// fakeUsage counts one token per word of a query and its response
+func fakeUsage(system string, prompts []string, response string) Usage {
+	usage := Usage{
+		PromptTokens:     len(strings.Fields(system)),
+		CompletionTokens: len(strings.Fields(response)),
+	}
+	for _, p := range prompts {
+		usage.PromptTokens += len(strings.Fields(p))
+	}
+	return usage
+}
+
+// Close implements Client.
+func (f *FakeClient) Close() error { return nil }
+
+// nextTurn counts a query and returns its number
+func (f *FakeClient) nextTurn() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	return f.queries
+}
+
+// respond produces the response to query number turn
+func (f *FakeClient) respond(turn int, system string, prompts []string) (string, error) {
+	from, last := "", ""
+	if len(prompts) > 0 {
+		from, last = splitEntry(prompts[len(prompts)-1])
+	}
+
+	switch f.mode {
+	case "script":
+		return f.responses[(turn-1)%len(f.responses)], nil
+	case "template":
+		var buf bytes.Buffer
+		query := FakeQuery{Model: f.model, System: system, Turn: turn, From: from, Last: last}
+		if err := f.tmpl.Execute(&buf, query); err != nil {
+			return "", fmt.Errorf("fake: template failed: %w", err)
+		}
+		return buf.String(), nil
+	default:
+		return last, nil
+	}
+}
+
+// splitEntry returns the ID and text of a context entry made by AIAddContext
+func splitEntry(entry string) (id, text string) {
+	if !strings.HasPrefix(entry, "<") {
+		return "", entry
+	}
+	id, rest, found := strings.Cut(entry[1:], ">\n")
+	if !found {
+		return "", entry
+	}
+	return id, strings.TrimSuffix(rest, "\n</"+id+">")
+}
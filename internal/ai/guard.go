@@ -0,0 +1,245 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by Guard. All but ErrCooldown stop the conversation's
+// auto-replies until it is reset.
+var (
+	ErrMaxTurns    = errors.New("turn limit reached")
+	ErrTokenBudget = errors.New("token budget spent")
+	ErrRepetition  = errors.New("conversation is repeating itself")
+	ErrEndMarker   = errors.New("model ended the conversation")
+	ErrCooldown    = errors.New("cooling down")
+	ErrStopped     = errors.New("auto-replies stopped")
+)
+
+// DefaultEndMarker is the text a model emits to end a conversation.
+const DefaultEndMarker = "<<END>>"
+
+// MinRepeatLength is the length, in characters once case, punctuation and spacing
+// are folded, below which a reply is never taken for repetition: short replies
+// such as "ok" recur naturally.
+const MinRepeatLength = 20
+
+// GuardConfig sets the stop conditions for automatic replies. A zero field
+// disables its check.
+type GuardConfig struct {
+	// MaxTurns is the number of replies allowed per conversation.
+	MaxTurns int
+
+	// TokenBudget is the estimated number of tokens, queries and replies together,
+	// allowed per conversation.
+	TokenBudget int
+
+	// RepeatWindow is how many recent messages, from either side, a reply is
+	// compared with. A match means the conversation is going in circles. The
+	// peer's messages are never checked, so a person may repeat themselves.
+	RepeatWindow int
+
+	// EndMarker, if found in a reply, ends the conversation after that reply. It
+	// is removed from the reply before it is sent.
+	EndMarker string
+
+	// Cooldown is the minimum time between replies to the same peer. Messages
+	// arriving sooner are not answered but stay in the conversation.
+	Cooldown time.Duration
+}
+
+// guardState is what Guard tracks for one conversation
+type guardState struct {
+	turns   int
+	tokens  int
+	recent  []string // normalized recent messages, oldest first
+	last    time.Time
+	stopped error
+}
+
+// Guard stops runaway automatic conversations, such as two AI clients answering
+// each other forever. Check is called before replying and Record after. Safe for
+// concurrent use.
+type Guard struct {
+	cfg GuardConfig
+
+	mu     sync.Mutex
+	states map[string]*guardState
+}
+
+// NewGuard creates a Guard enforcing cfg.
+func NewGuard(cfg GuardConfig) *Guard {
+	return &Guard{
+		cfg:    cfg,
+		states: make(map[string]*guardState),
+	}
+}
+
+// state returns the state for key, creating it if needed. Callers hold g.mu.
+func (g *Guard) state(key string) *guardState {
+	s, ok := g.states[key]
+	if !ok {
+		s = &guardState{}
+		g.states[key] = s
+	}
+	return s
+}
+
+// Check reports whether the conversation with key may be answered after receiving
+// incoming. It returns nil to reply, ErrCooldown to skip this message, or an error
+// wrapping the condition that stopped the conversation. The error is only new,
+// and worth logging, the first time a condition triggers; later calls wrap ErrStopped.
+func (g *Guard) Check(key, incoming string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.state(key)
+	if s.stopped != nil {
+		return fmt.Errorf("%w: %w", ErrStopped, s.stopped)
+	}
+
+	g.remember(s, incoming)
+	if g.cfg.MaxTurns > 0 && s.turns >= g.cfg.MaxTurns {
+		return g.stop(s, fmt.Errorf("%w (%d)", ErrMaxTurns, g.cfg.MaxTurns))
+	}
+	if g.cfg.TokenBudget > 0 && s.tokens >= g.cfg.TokenBudget {
+		return g.stop(s, fmt.Errorf("%w (%d of %d)", ErrTokenBudget, s.tokens, g.cfg.TokenBudget))
+	}
+	if g.cfg.Cooldown > 0 && !s.last.IsZero() {
+		if wait := g.cfg.Cooldown - time.Since(s.last); wait > 0 {
+			return fmt.Errorf("%w (%v left)", ErrCooldown, wait.Round(time.Millisecond))
+		}
+	}
+	return nil
+}
+
+// Record counts a reply sent in the conversation with key, which used tokens
+// in total. It returns an error if the reply stopped the conversation.
+func (g *Guard) Record(key, reply string, tokens int) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := g.state(key)
+	s.turns++
+	s.tokens += tokens
+	s.last = time.Now()
+
+	if g.cfg.EndMarker != "" && strings.Contains(reply, g.cfg.EndMarker) {
+		return g.stop(s, ErrEndMarker)
+	}
+	if g.repeats(s, reply) {
+		return g.stop(s, ErrRepetition)
+	}
+	g.remember(s, reply)
+	return nil
+}
+
+// repeats reports whether reply matches one of the recent messages of s
+func (g *Guard) repeats(s *guardState, reply string) bool {
+	if g.cfg.RepeatWindow <= 0 {
+		return false
+	}
+	text := normalize(reply)
+	return len([]rune(text)) >= MinRepeatLength && slices.Contains(s.recent, text)
+}
+
+// remember adds text to the recent messages of s
+func (g *Guard) remember(s *guardState, text string) {
+	if g.cfg.RepeatWindow <= 0 {
+		return
+	}
+	if text = normalize(text); text == "" {
+		return
+	}
+	s.recent = append(s.recent, text)
+	if len(s.recent) > g.cfg.RepeatWindow {
+		s.recent = s.recent[len(s.recent)-g.cfg.RepeatWindow:]
+	}
+}
+
+// stop marks s stopped by err and returns err
+func (g *Guard) stop(s *guardState, err error) error {
+	s.stopped = err
+	return err
+}
+
+// Stopped returns why the conversation with key was stopped, or nil if it was not.
+func (g *Guard) Stopped(key string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if s, ok := g.states[key]; ok {
+		return s.stopped
+	}
+	return nil
+}
+
+// Reset clears the state of the conversation with key, resuming auto-replies.
+func (g *Guard) Reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.states, key)
+}
+
+// StripMarker returns reply without the end marker.
+func (g *Guard) StripMarker(reply string) string {
+	if g.cfg.EndMarker == "" {
+		return reply
+	}
+	return strings.TrimSpace(strings.ReplaceAll(reply, g.cfg.EndMarker, ""))
+}
+
+// MarkerFilter removes the end marker from a reply streamed in pieces, holding
+// back the end of a piece that may be the start of the marker until the next.
+type MarkerFilter struct {
+	marker  string
+	emit    func(chunk string) error
+	pending string
+}
+
+// NewMarkerFilter returns a filter passing the pieces written to it to emit
+// without the end marker.
+func (g *Guard) NewMarkerFilter(emit func(chunk string) error) *MarkerFilter {
+	return &MarkerFilter{marker: g.cfg.EndMarker, emit: emit}
+}
+
+// Write passes chunk on, less the marker and any held back piece of it.
+func (f *MarkerFilter) Write(chunk string) error {
+	if f.marker == "" {
+		return f.emit(chunk)
+	}
+	text := strings.ReplaceAll(f.pending+chunk, f.marker, "")
+	held := 0
+	for n := min(len(f.marker)-1, len(text)); n > 0; n-- {
+		if strings.HasSuffix(text, f.marker[:n]) {
+			held = n
+			break
+		}
+	}
+	text, f.pending = text[:len(text)-held], text[len(text)-held:]
+	if text == "" {
+		return nil
+	}
+	return f.emit(text)
+}
+
+// Flush passes on the text held back, which was not the marker after all.
+func (f *MarkerFilter) Flush() error {
+	text := f.pending
+	f.pending = ""
+	if text == "" {
+		return nil
+	}
+	return f.emit(text)
+}
+
+// normalize folds case, punctuation and spacing so near-identical messages compare equal
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || r > 127)
+	})
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,37 @@
+package ai
+
+import (
+	"context"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// optionsClient sends every query through client with fixed generation options
+type optionsClient struct {
+	client  Client
+	options llmclient.Options
+}
+
+// WithOptions returns a client that queries client with options, such as the
+// temperature and maximum response tokens, in place of the caller's.
+func WithOptions(client Client, options llmclient.Options) StreamingClient {
+	return &optionsClient{client: client, options: options}
+}
+
+// QueryText implements Client.
+func (o *optionsClient) QueryText(ctx context.Context, system string, prompts []string, model string, _ llmclient.Options) (string, error) {
+	return o.client.QueryText(ctx, system, prompts, model, o.options)
+}
+
+// QueryTextStream implements StreamingClient.
+func (o *optionsClient) QueryTextStream(ctx context.Context, system string, prompts []string, model string, _ llmclient.Options, emit func(chunk string) error) (string, error) {
+	return queryStream(ctx, o.client, system, prompts, model, o.options, emit)
+}
+
+// QueryTextTools implements ToolClient.
+func (o *optionsClient) QueryTextTools(ctx context.Context, system string, prompts []string, model string, _ llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error) {
+	return queryTools(ctx, o.client, system, prompts, model, o.options, tools, rounds)
+}
+
+// Close closes the wrapped client.
+func (o *optionsClient) Close() error { return o.client.Close() }
@@ -0,0 +1,59 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// PromptVars are the variables a system prompt template is rendered with.
+type PromptVars struct {
+	Self  string    // this client's ID
+	Peer  string    // ID of the conversation partner
+	Peers []string  // IDs of the other clients connected to the server, sorted
+	Room  string    // name of the room the server hosts, empty if unnamed
+	Model string    // model answering the query
+	Now   time.Time // time of the query
+	Date  string    // date of the query, as 2006-01-02
+}
+
+// promptFuncs are the functions available to system prompt templates
+var promptFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// SystemPrompt is a system prompt written as a text/template, rendered for each
+// query. A prompt without template actions renders as written.
+type SystemPrompt struct {
+	tmpl *template.Template
+}
+
+// ParseSystemPrompt parses text as a system prompt template and checks that it
+// renders. name identifies the prompt in errors.
+func ParseSystemPrompt(name, text string) (*SystemPrompt, error) {
+	tmpl, err := template.New(name).Funcs(promptFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system prompt: %w", err)
+	}
+	p := &SystemPrompt{tmpl: tmpl}
+
+	// Catch references to unknown variables now rather than on the first query
+	sample := PromptVars{Self: "self", Peer: "peer", Peers: []string{"peer"}, Room: "room", Model: "model", Now: time.Now()}
+	if _, err := p.Render(sample); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Render renders the prompt with vars. Date is filled in from Now if empty.
+func (p *SystemPrompt) Render(vars PromptVars) (string, error) {
+	if vars.Date == "" {
+		vars.Date = vars.Now.Format(time.DateOnly)
+	}
+	var b strings.Builder
+	if err := p.tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("failed to render system prompt: %w", err)
+	}
+	return b.String(), nil
+}
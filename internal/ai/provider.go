@@ -0,0 +1,248 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// ProviderClient queries Anthropic and OpenAI models through langchaingo, as
+// llmclient does, and also streams responses, reports the provider's token
+// counts and makes native tool calls. Other providers are served by llmclient.
+type ProviderClient struct {
+	llm      llms.Model
+	provider string
+
+	// temperatureScale maps the 0-1 temperature callers use to the provider's range
+	temperatureScale float32
+}
+
+// Ensure ProviderClient implements StreamingUsageClient, UsageClient and ToolClient
+var (
+	_ StreamingUsageClient = (*ProviderClient)(nil)
+	_ UsageClient          = (*ProviderClient)(nil)
+	_ ToolClient           = (*ProviderClient)(nil)
+)
+
+// HasProviderClient reports whether NewProviderClient supports provider.
+func HasProviderClient(provider string) bool {
+	return provider == llmclient.Anthropic || provider == llmclient.OpenAI
+}
+
+// NewProviderClient creates a client for provider, configured from the same
+// environment variables as llmclient: ANTHROPIC_API_KEY, or OPENAI_API_KEY and
+// OPENAI_BASE_URL.
+func NewProviderClient(provider string) (*ProviderClient, error) {
+	switch provider {
+	case llmclient.Anthropic:
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
+		}
+		llm, err := anthropic.New(anthropic.WithToken(apiKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Anthropic client: %w", err)
+		}
+		return &ProviderClient{llm: llm, provider: provider, temperatureScale: 1}, nil
+
+	case llmclient.OpenAI:
+		apiKey, baseURL := os.Getenv("OPENAI_API_KEY"), os.Getenv("OPENAI_BASE_URL")
+		if apiKey == "" || baseURL == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY and OPENAI_BASE_URL environment variables must be set")
+		}
+		llm, err := openai.New(openai.WithToken(apiKey), openai.WithBaseURL(baseURL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
+		}
+		return &ProviderClient{llm: llm, provider: provider, temperatureScale: 2}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+}
+
+// QueryText implements Client.
+func (c *ProviderClient) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	response, _, err := c.QueryTextUsage(ctx, system, prompts, model, options)
+	return response, err
+}
+
+// QueryTextUsage implements UsageClient.
+func (c *ProviderClient) QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, Usage, error) {
+	resp, err := c.generate(ctx, textMessages(system, prompts), model, options)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	text := responseText(resp)
+	return text, responseUsage(resp, model, system, prompts, text), nil
+}
+
+// QueryTextStream implements StreamingClient, passing each piece of text to
+// emit as the provider sends it.
+func (c *ProviderClient) QueryTextStream(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error) {
+	response, _, err := c.QueryTextStreamUsage(ctx, system, prompts, model, options, emit)
+	return response, err
+}
+
+// QueryTextStreamUsage implements StreamingUsageClient.
+func (c *ProviderClient) QueryTextStreamUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error) {
+	stream := llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		return emit(string(chunk))
+	})
+	resp, err := c.generate(ctx, textMessages(system, prompts), model, options, stream)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	text := responseText(resp)
+	return text, responseUsage(resp, model, system, prompts, text), nil
+}
+
+// QueryTextTools implements ToolClient with the provider's native tool calls.
+// Each call of a round is sent back as a message of its own followed by its
+// result, since langchaingo passes Anthropic only the first part of a message.
+// Once tools is nil the rounds are given as text, so that the request needs no
+// tool definitions.
+func (c *ProviderClient) QueryTextTools(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error) {
+	if len(tools) == 0 {
+		system, prompts := toolText(system, prompts, nil, rounds)
+		response, err := c.QueryText(ctx, system, prompts, model, options)
+		return response, nil, err
+	}
+
+	messages := textMessages(system, prompts)
+	for _, round := range rounds {
+		for i, call := range round.Calls {
+			args := string(call.Arguments)
+			if !json.Valid(call.Arguments) {
+				args = "{}"
+			}
+			result := round.Results[i]
+			content := result.Content
+			if result.IsError {
+				content = "error: " + content
+			}
+			messages = append(messages,
+				llms.MessageContent{
+					Role: llms.ChatMessageTypeAI,
+					Parts: []llms.ContentPart{llms.ToolCall{
+						ID:           call.ID,
+						Type:         "function",
+						FunctionCall: &llms.FunctionCall{Name: call.Name, Arguments: args},
+					}},
+				},
+				llms.MessageContent{
+					Role:  llms.ChatMessageTypeTool,
+					Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: call.ID, Name: call.Name, Content: content}},
+				},
+			)
+		}
+	}
+
+	definitions := make([]llms.Tool, len(tools))
+	for i, tool := range tools {
+		var parameters map[string]any
+		if err := json.Unmarshal(tool.Schema, &parameters); err != nil {
+			return "", nil, fmt.Errorf("tool %s: invalid schema: %w", tool.Name, err)
+		}
+		definitions[i] = llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
+		}
+	}
+
+	resp, err := c.generate(ctx, messages, model, options, llms.WithTools(definitions))
+	if err != nil {
+		return "", nil, err
+	}
+	var calls []ToolCall
+	for _, choice := range resp.Choices {
+		for _, call := range choice.ToolCalls {
+			if call.FunctionCall == nil {
+				continue
+			}
+			calls = append(calls, ToolCall{
+				ID:        call.ID,
+				Name:      call.FunctionCall.Name,
+				Arguments: json.RawMessage(call.FunctionCall.Arguments),
+			})
+		}
+	}
+	return responseText(resp), calls, nil
+}
+
+// Close implements Client. langchaingo clients hold nothing to release.
+func (c *ProviderClient) Close() error { return nil }
+
+// generate sends messages to model with options, as llmclient would: the
+// temperature is scaled to the provider's range and the response is limited to
+// options.MaxTokens, or the model's maximum when that is unset.
+func (c *ProviderClient) generate(ctx context.Context, messages []llms.MessageContent, model string, options llmclient.Options, extra ...llms.CallOption) (*llms.ContentResponse, error) {
+	if provider, err := llmclient.GetProviderName(model); err != nil || provider != c.provider {
+		return nil, fmt.Errorf("invalid or unsupported %s model: %s", c.provider, model)
+	}
+	maxTokens := options.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = llmclient.GetMaxTokens(model)
+	}
+
+	callOptions := append([]llms.CallOption{
+		llms.WithModel(model),
+		llms.WithTemperature(float64(options.Temperature * c.temperatureScale)),
+		llms.WithMaxTokens(int(maxTokens)),
+	}, extra...)
+	resp, err := c.llm.GenerateContent(ctx, messages, callOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate completion: %w", err)
+	}
+	return resp, nil
+}
+
+// textMessages converts a system prompt and query context to chat messages
+func textMessages(system string, prompts []string) []llms.MessageContent {
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, system)}
+	for _, prompt := range prompts {
+		messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, prompt))
+	}
+	return messages
+}
+
+// responseText joins the text of a response's choices
+func responseText(resp *llms.ContentResponse) string {
+	var text strings.Builder
+	for _, choice := range resp.Choices {
+		text.WriteString(choice.Content)
+	}
+	return text.String()
+}
+
+// responseUsage reads the token counts the provider reported with a response, or
+// estimates them from the query and text if it reported none. Anthropic and OpenAI
+// name them differently; every choice carries the same counts.
+func responseUsage(resp *llms.ContentResponse, model, system string, prompts []string, text string) Usage {
+	for _, choice := range resp.Choices {
+		info := choice.GenerationInfo
+		if prompt, ok := info["InputTokens"].(int); ok {
+			completion, _ := info["OutputTokens"].(int)
+			return Usage{PromptTokens: prompt, CompletionTokens: completion}
+		}
+		if prompt, ok := info["PromptTokens"].(int); ok {
+			completion, _ := info["CompletionTokens"].(int)
+			return Usage{PromptTokens: prompt, CompletionTokens: completion}
+		}
+	}
+	return EstimateUsage(model, system, prompts, text)
+}
@@ -11,18 +11,60 @@ import (
 type Client = llmclient.Client
 
 // AIClient creates a new LLM client for the given model name.
-// It resolves the model's provider and returns the configured client.
+// It resolves the model's provider and returns the configured client: a
+// ProviderClient, which streams, for Anthropic and OpenAI models, and an
+// llmclient client, which does not, for the others. Model names starting with
+// FakePrefix select a FakeClient.
 func AIClient(model string) (Client, error) {
+	if IsFake(model) {
+		return NewFakeClient(model)
+	}
 	provider, err := llmclient.GetProviderName(model)
 	if err != nil {
 		return nil, err
 	}
+	if HasProviderClient(provider) {
+		return NewProviderClient(provider)
+	}
 	return llmclient.NewClient(provider)
 }
 
-// AIQuery executes a text query against the given LLM client.
-func AIQuery(client Client, systemPrompt string, queryContext []string, model string) (string, error) {
-	return client.QueryText(context.Background(), systemPrompt, queryContext, model, llmclient.Options{})
+// AIQuery executes a text query against the given LLM client. The query is
+// abandoned when ctx ends.
+func AIQuery(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string) (string, error) {
+	return client.QueryText(ctx, systemPrompt, queryContext, model, llmclient.Options{})
+}
+
+// StreamingClient is implemented by clients that can deliver a response incrementally.
+// emit is called with each piece of text as the model produces it; the full response
+// is returned when the query completes.
+type StreamingClient interface {
+	Client
+	QueryTextStream(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error)
+}
+
+// AIQueryStream executes a text query and passes the response to emit as it is produced.
+// Clients that cannot stream deliver the whole response as a single chunk.
+func AIQueryStream(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string, emit func(chunk string) error) (string, error) {
+	return queryStream(ctx, client, systemPrompt, queryContext, model, llmclient.Options{}, emit)
+}
+
+// queryStream is AIQueryStream with options, for clients that wrap another client
+func queryStream(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error) {
+	if sc, ok := client.(StreamingClient); ok {
+		return sc.QueryTextStream(ctx, systemPrompt, queryContext, model, options, emit)
+	}
+
+	response, err := client.QueryText(ctx, systemPrompt, queryContext, model, options)
+	if err != nil {
+		return "", err
+	}
+	if len(response) > 0 {
+		if err := emit(response); err != nil {
+			return "", err
+		}
+	}
+	return response, nil
 }
 
 // AIAddContext wraps content with XML-style ID tags and appends it to the query context.
@@ -0,0 +1,423 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultSchemaRetries is how many times a reply that does not match its schema
+// is asked for again.
+const DefaultSchemaRetries = 2
+
+// ErrSchemaMismatch is returned by StructuredQuery when the model's replies never
+// matched the schema.
+var ErrSchemaMismatch = errors.New("reply does not match the schema")
+
+// Schema is a JSON Schema that replies must match. It supports the keywords type,
+// enum, const, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum and maximum; others are ignored.
+type Schema struct {
+	name string
+	text string // the schema as given, compacted
+	root *schemaNode
+}
+
+// schemaNode is one parsed schema or subschema
+type schemaNode struct {
+	types      []string
+	enum       []any
+	constant   any
+	hasConst   bool
+	properties map[string]*schemaNode
+	required   []string
+	noExtra    bool        // additionalProperties is false
+	additional *schemaNode // schema of properties not listed
+	items      *schemaNode
+	minItems   *int
+	maxItems   *int
+	minLength  *int
+	maxLength  *int
+	pattern    *regexp.Regexp
+	minimum    *float64
+	maximum    *float64
+}
+
+// schemaTypes are the JSON Schema type names
+var schemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// ParseSchema parses the JSON Schema in data. name identifies it in errors.
+func ParseSchema(name string, data []byte) (*Schema, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	root, err := parseNode(raw, "$")
+	if err != nil {
+		return nil, fmt.Errorf("schema %s: %w", name, err)
+	}
+	return &Schema{name: name, text: compactJSON(data), root: root}, nil
+}
+
+// Name returns the name the schema was parsed with.
+func (s *Schema) Name() string { return s.name }
+
+// String returns the schema as JSON.
+func (s *Schema) String() string { return s.text }
+
+// parseNode parses the schema raw found at path
+func parseNode(raw any, path string) (*schemaNode, error) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object", path)
+	}
+	n := &schemaNode{}
+	var err error
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		n.types = []string{t}
+	case []any:
+		for _, v := range t {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: type must be a string or a list of strings", path)
+			}
+			n.types = append(n.types, s)
+		}
+	default:
+		return nil, fmt.Errorf("%s: type must be a string or a list of strings", path)
+	}
+	for _, t := range n.types {
+		if !slices.Contains(schemaTypes, t) {
+			return nil, fmt.Errorf("%s: unknown type %q", path, t)
+		}
+	}
+
+	if v, ok := m["enum"]; ok {
+		if n.enum, ok = v.([]any); !ok {
+			return nil, fmt.Errorf("%s: enum must be a list", path)
+		}
+	}
+	n.constant, n.hasConst = m["const"]
+
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: properties must be an object", path)
+		}
+		n.properties = make(map[string]*schemaNode, len(props))
+		for name, prop := range props {
+			if n.properties[name], err = parseNode(prop, path+"."+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if v, ok := m["required"]; ok {
+		list, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s: required must be a list of names", path)
+		}
+		for _, name := range list {
+			s, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: required must be a list of names", path)
+			}
+			n.required = append(n.required, s)
+		}
+	}
+	switch v := m["additionalProperties"].(type) {
+	case nil:
+	case bool:
+		n.noExtra = !v
+	default:
+		if n.additional, err = parseNode(v, path+".*"); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := m["items"]; ok {
+		if n.items, err = parseNode(v, path+"[]"); err != nil {
+			return nil, err
+		}
+	}
+
+	for key, field := range map[string]**int{"minItems": &n.minItems, "maxItems": &n.maxItems, "minLength": &n.minLength, "maxLength": &n.maxLength} {
+		if v, ok := m[key]; ok {
+			f, ok := v.(float64)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return nil, fmt.Errorf("%s: %s must be a non-negative integer", path, key)
+			}
+			i := int(f)
+			*field = &i
+		}
+	}
+	for key, field := range map[string]**float64{"minimum": &n.minimum, "maximum": &n.maximum} {
+		if v, ok := m[key]; ok {
+			f, ok := v.(float64)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s must be a number", path, key)
+			}
+			*field = &f
+		}
+	}
+	if v, ok := m["pattern"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: pattern must be a string", path)
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %w", path, err)
+		}
+	}
+	return n, nil
+}
+
+// Validate checks that data is JSON matching the schema.
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return errors.New("invalid JSON: more than one value")
+	}
+	return s.root.validate(value, "$")
+}
+
+// validate checks value, found at path, against the schema
+func (n *schemaNode) validate(value any, path string) error {
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return hasType(value, t) }) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(n.types, " or "), typeOf(value))
+	}
+	if n.hasConst && !equalJSON(value, n.constant) {
+		return fmt.Errorf("%s: expected %s", path, formatJSON(n.constant))
+	}
+	if n.enum != nil && !slices.ContainsFunc(n.enum, func(e any) bool { return equalJSON(value, e) }) {
+		return fmt.Errorf("%s: %s is not one of %s", path, formatJSON(value), formatJSON(n.enum))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, listed := n.properties[name]
+			switch {
+			case listed:
+			case n.additional != nil:
+				prop = n.additional
+			case n.noExtra:
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			default:
+				continue
+			}
+			if err := prop.validate(v[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+
+	case []any:
+		if n.minItems != nil && len(v) < *n.minItems {
+			return fmt.Errorf("%s: expected at least %d items, got %d", path, *n.minItems, len(v))
+		}
+		if n.maxItems != nil && len(v) > *n.maxItems {
+			return fmt.Errorf("%s: expected at most %d items, got %d", path, *n.maxItems, len(v))
+		}
+		if n.items != nil {
+			for i, item := range v {
+				if err := n.items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength != nil && length < *n.minLength {
+			return fmt.Errorf("%s: expected at least %d characters, got %d", path, *n.minLength, length)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			return fmt.Errorf("%s: expected at most %d characters, got %d", path, *n.maxLength, length)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			return fmt.Errorf("%s: %q does not match pattern %s", path, v, n.pattern)
+		}
+
+	case json.Number:
+		f, _ := v.Float64()
+		if n.minimum != nil && f < *n.minimum {
+			return fmt.Errorf("%s: %s is less than the minimum %g", path, v, *n.minimum)
+		}
+		if n.maximum != nil && f > *n.maximum {
+			return fmt.Errorf("%s: %s is greater than the maximum %g", path, v, *n.maximum)
+		}
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of the schema type t
+func hasType(value any, t string) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	case string:
+		return t == "string"
+	case bool:
+		return t == "boolean"
+	case nil:
+		return t == "null"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		f, err := v.Float64()
+		return t == "integer" && err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+// typeOf names the JSON type of a decoded value
+func typeOf(value any) string {
+	for _, t := range schemaTypes {
+		if t != "integer" && hasType(value, t) {
+			return t
+		}
+	}
+	return "unknown"
+}
+
+// equalJSON reports whether two decoded JSON values are equal. Numbers compare by
+// value, whether decoded as json.Number or float64.
+func equalJSON(a, b any) bool {
+	return formatJSON(normalizeNumbers(a)) == formatJSON(normalizeNumbers(b))
+}
+
+// normalizeNumbers converts json.Numbers in a decoded value to float64
+func normalizeNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k] = normalizeNumbers(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, e := range v {
+			l[i] = normalizeNumbers(e)
+		}
+		return l
+	}
+	return value
+}
+
+// formatJSON returns a decoded value as JSON
+func formatJSON(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// SchemaPrompt tells the model to reply with JSON matching schema. It is appended
+// to the system prompt.
+func SchemaPrompt(schema *Schema) string {
+	return "Reply with a single JSON value that matches this JSON Schema, and nothing else: " +
+		"no explanation and no code fences.\n" + schema.String()
+}
+
+// fencePattern matches a reply wrapped in a Markdown code fence
+var fencePattern = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*\n(.*?)\n?```$")
+
+// ExtractJSON returns the JSON in a model's reply, removing a code fence or text
+// around a single object or array.
+func ExtractJSON(response string) string {
+	text := strings.TrimSpace(response)
+	if m := fencePattern.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+	if json.Valid([]byte(text)) {
+		return text
+	}
+	for _, pair := range []string{"{}", "[]"} {
+		start, end := strings.IndexByte(text, pair[0]), strings.LastIndexByte(text, pair[1])
+		if start >= 0 && end > start && json.Valid([]byte(text[start:end+1])) {
+			return text[start : end+1]
+		}
+	}
+	return text
+}
+
+// StructuredQuery asks a model for a reply matching Schema, asking again with the
+// problem when a reply does not match.
+type StructuredQuery struct {
+	Schema *Schema
+
+	// Retries is how many times a reply that does not match is asked for again.
+	Retries int
+
+	// OnInvalid, if set, is called with each reply that does not match.
+	OnInvalid func(response string, err error)
+}
+
+// AIQueryJSON executes a text query whose reply must be JSON matching schema,
+// retrying DefaultSchemaRetries times.
+func AIQueryJSON(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string, schema *Schema) (string, error) {
+	q := &StructuredQuery{Schema: schema, Retries: DefaultSchemaRetries}
+	return q.Query(ctx, systemPrompt, queryContext, func(ctx context.Context, system string, prompts []string) (string, error) {
+		return AIQuery(ctx, client, system, prompts, model)
+	})
+}
+
+// Query asks for a reply with ask, which queries the model with the system prompt
+// and query context it is given. The schema is added to the system prompt, and the
+// reply's JSON is returned compacted. After a reply that does not match, the reply
+// and the problem are added to the context and ask is called again.
+func (q *StructuredQuery) Query(ctx context.Context, systemPrompt string, queryContext []string, ask func(ctx context.Context, system string, prompts []string) (string, error)) (string, error) {
+	system := systemPrompt + "\n\n" + SchemaPrompt(q.Schema)
+	prompts := append([]string(nil), queryContext...)
+	for attempt := 0; ; attempt++ {
+		response, err := ask(ctx, system, prompts)
+		if err != nil {
+			return "", err
+		}
+		text := ExtractJSON(response)
+		err = q.Schema.Validate([]byte(text))
+		if err == nil {
+			return compactJSON(json.RawMessage(text)), nil
+		}
+		if q.OnInvalid != nil {
+			q.OnInvalid(response, err)
+		}
+		if attempt >= q.Retries {
+			return "", fmt.Errorf("%w %s: %v", ErrSchemaMismatch, q.Schema.Name(), err)
+		}
+		prompts = AIAddContext(prompts, "invalid_reply", response)
+		prompts = AIAddContext(prompts, "schema_error", fmt.Sprintf("Your reply does not match the schema: %v. Reply again with JSON that matches it.", err))
+	}
+}
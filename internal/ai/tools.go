@@ -0,0 +1,366 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// DefaultMaxToolRounds is how many rounds of tool calls ToolLoop allows when
+// MaxRounds is unset.
+const DefaultMaxToolRounds = 5
+
+// MaxToolResult is the length at which a tool's result is cut before it is
+// returned to the model.
+const MaxToolResult = 16000
+
+// Tool is a function the model may call while writing a reply.
+type Tool struct {
+	Name        string
+	Description string
+
+	// Schema is the JSON Schema of the arguments object.
+	Schema json.RawMessage
+
+	// Handler runs the tool with the arguments the model gave and returns the
+	// result passed back to it. An error is passed back as a failed call.
+	Handler func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+// ToolCall is a call the model asked for.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments json.RawMessage
+
+	// err is set when the call could not be parsed
+	err error
+}
+
+// ToolResult is the outcome of a ToolCall.
+type ToolResult struct {
+	CallID  string
+	Name    string
+	Content string
+	IsError bool
+}
+
+// ToolRound is one round of calls and their results.
+type ToolRound struct {
+	Calls   []ToolCall
+	Results []ToolResult
+}
+
+// ToolClient is implemented by clients whose provider supports tool calls. Given
+// the rounds so far, it returns either the model's reply or the next calls to make.
+// tools is nil when the model must reply without calling more. Clients that wrap
+// another client implement it too, passing the query on as text when the wrapped
+// client has no tool calls.
+type ToolClient interface {
+	Client
+	QueryTextTools(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error)
+}
+
+// toolNamePattern is what a tool name may look like
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Tools is a set of tools by name. It is safe for concurrent use.
+type Tools struct {
+	mu      sync.RWMutex
+	tools   map[string]Tool
+	schemas map[string]*Schema // each tool's parsed Schema, by name
+	order   []string
+}
+
+// NewTools returns an empty set of tools.
+func NewTools() *Tools {
+	return &Tools{tools: make(map[string]Tool), schemas: make(map[string]*Schema)}
+}
+
+// Register adds tool to the set, replacing one with the same name. Its Schema
+// must be one Schema.Validate can check arguments against.
+func (t *Tools) Register(tool Tool) error {
+	if !toolNamePattern.MatchString(tool.Name) {
+		return fmt.Errorf("invalid tool name %q", tool.Name)
+	}
+	if tool.Handler == nil {
+		return fmt.Errorf("tool %s has no handler", tool.Name)
+	}
+	if len(tool.Schema) == 0 {
+		tool.Schema = json.RawMessage(`{"type": "object"}`)
+	}
+	schema, err := ParseSchema(tool.Name, tool.Schema)
+	if err != nil {
+		return fmt.Errorf("tool %s: %w", tool.Name, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.tools[tool.Name]; !exists {
+		t.order = append(t.order, tool.Name)
+	}
+	t.tools[tool.Name] = tool
+	t.schemas[tool.Name] = schema
+	return nil
+}
+
+// List returns the tools in the order they were registered.
+func (t *Tools) List() []Tool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	tools := make([]Tool, 0, len(t.order))
+	for _, name := range t.order {
+		tools = append(tools, t.tools[name])
+	}
+	return tools
+}
+
+// Len returns the number of tools.
+func (t *Tools) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.order)
+}
+
+// Call runs call and returns its result. Unknown tools, arguments that do not
+// match the schema and handler errors give a failed result.
+func (t *Tools) Call(ctx context.Context, call ToolCall) ToolResult {
+	result := ToolResult{CallID: call.ID, Name: call.Name}
+	fail := func(err error) ToolResult {
+		result.Content, result.IsError = err.Error(), true
+		return result
+	}
+	if call.err != nil {
+		return fail(call.err)
+	}
+
+	t.mu.RLock()
+	tool, ok := t.tools[call.Name]
+	schema := t.schemas[call.Name]
+	t.mu.RUnlock()
+	if !ok {
+		return fail(fmt.Errorf("unknown tool %q", call.Name))
+	}
+	args := call.Arguments
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if err := checkArguments(schema, args); err != nil {
+		return fail(err)
+	}
+
+	content, err := tool.Handler(ctx, args)
+	if err != nil {
+		return fail(err)
+	}
+	if len(content) > MaxToolResult {
+		content = content[:MaxToolResult] + "\n[truncated]"
+	}
+	result.Content = content
+	return result
+}
+
+// checkArguments checks that args is an object matching schema
+func checkArguments(schema *Schema, args json.RawMessage) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(args, &values); err != nil {
+		return fmt.Errorf("arguments must be a JSON object: %w", err)
+	}
+	if err := schema.Validate(args); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// ErrToolRounds is returned by ToolLoop.Query when the model keeps calling tools
+// after being told to reply.
+var ErrToolRounds = errors.New("model kept calling tools past the round limit")
+
+// ToolLoop answers queries with a model that may call tools. Each round the
+// model's calls are run and their results fed back, until it replies with text.
+type ToolLoop struct {
+	Tools *Tools
+
+	// MaxRounds is how many rounds of calls are run before the model is asked
+	// to reply without tools (0 = DefaultMaxToolRounds).
+	MaxRounds int
+
+	// Options are the generation options each query is made with.
+	Options llmclient.Options
+
+	// OnCall, if set, is called with each call and its result.
+	OnCall func(call ToolCall, result ToolResult)
+}
+
+// AIQueryTools executes a text query in which the model may call tools.
+func AIQueryTools(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string, tools *Tools) (string, error) {
+	loop := &ToolLoop{Tools: tools}
+	return loop.Query(ctx, client, systemPrompt, queryContext, model)
+}
+
+// Query asks client's model for a reply, running the tool calls it makes first.
+func (l *ToolLoop) Query(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string) (string, error) {
+	maxRounds := l.MaxRounds
+	if maxRounds <= 0 {
+		maxRounds = DefaultMaxToolRounds
+	}
+	tools := l.Tools.List()
+
+	var rounds []ToolRound
+	for {
+		offered := tools
+		if len(rounds) >= maxRounds {
+			offered = nil
+		}
+
+		response, calls, err := queryTools(ctx, client, systemPrompt, queryContext, model, l.Options, offered, rounds)
+		if err != nil {
+			return "", err
+		}
+		if len(calls) == 0 {
+			return response, nil
+		}
+		if offered == nil {
+			return "", ErrToolRounds
+		}
+
+		round := ToolRound{Calls: calls}
+		for _, call := range calls {
+			result := l.Tools.Call(ctx, call)
+			if l.OnCall != nil {
+				l.OnCall(call, result)
+			}
+			round.Results = append(round.Results, result)
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		rounds = append(rounds, round)
+	}
+}
+
+// queryTools makes one query of a tool loop, offering tools. A ToolClient is
+// given the tools directly; any other client is taught to call them in its text,
+// as described by the system prompt addition from toolPrompt.
+func queryTools(ctx context.Context, client Client, systemPrompt string, queryContext []string, model string, options llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error) {
+	if tc, ok := client.(ToolClient); ok {
+		return tc.QueryTextTools(ctx, systemPrompt, queryContext, model, options, tools, rounds)
+	}
+
+	system, prompts := toolText(systemPrompt, queryContext, tools, rounds)
+	response, err := client.QueryText(ctx, system, prompts, model, options)
+	if err != nil {
+		return "", nil, err
+	}
+	calls := ParseToolCalls(response)
+	for i := range calls {
+		calls[i].ID = fmt.Sprintf("call-%d-%d", len(rounds)+1, i+1)
+	}
+	return response, calls, nil
+}
+
+// toolText returns the system prompt and query context for a tool query made as
+// text: the tools are described in the system prompt and the rounds so far are
+// appended to the query context
+func toolText(systemPrompt string, queryContext []string, tools []Tool, rounds []ToolRound) (string, []string) {
+	system := systemPrompt
+	if len(tools) > 0 {
+		system += "\n\n" + toolPrompt(tools)
+	} else if len(rounds) > 0 {
+		system += "\n\nYou cannot call any more tools. Reply now using the results you have."
+	}
+	prompts := append([]string(nil), queryContext...)
+	for _, round := range rounds {
+		prompts = addRound(prompts, round)
+	}
+	return system, prompts
+}
+
+// toolPrompt tells a model without native tool support how to call tools
+func toolPrompt(tools []Tool) string {
+	var b strings.Builder
+	b.WriteString("You can call tools to help you reply. The tools are:\n")
+	for _, tool := range tools {
+		fmt.Fprintf(&b, "\n%s: %s\nArguments (JSON Schema): %s\n", tool.Name, tool.Description, compactJSON(tool.Schema))
+	}
+	b.WriteString(`
+To call tools, reply with nothing but tool_call blocks, one per call, such as
+<tool_call>{"name": "tool_name", "arguments": {"argument": "value"}}</tool_call>
+Each result comes back as a tool_result entry. When you have what you need, write
+your reply without any tool_call blocks.`)
+	return b.String()
+}
+
+// compactJSON returns data without insignificant space
+func compactJSON(data json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
+
+// toolCallPattern matches a tool_call block in a model's response
+var toolCallPattern = regexp.MustCompile(`(?s)<tool_call>\s*(.*?)\s*</tool_call>`)
+
+// ParseToolCalls returns the calls in the tool_call blocks of a response. A block
+// that cannot be parsed gives a call whose result reports the problem, so the
+// model can correct it.
+func ParseToolCalls(response string) []ToolCall {
+	var calls []ToolCall
+	for _, match := range toolCallPattern.FindAllStringSubmatch(response, -1) {
+		var body struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		call := ToolCall{}
+		if err := json.Unmarshal([]byte(match[1]), &body); err != nil {
+			call.err = fmt.Errorf("invalid tool call %s: %w", match[1], err)
+		} else {
+			call.Name, call.Arguments = body.Name, body.Arguments
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// callJSON returns call as the JSON of a tool_call block
+func callJSON(call ToolCall) string {
+	args := compactJSON(call.Arguments)
+	if args == "" {
+		args = "{}"
+	}
+	return fmt.Sprintf(`{"name": %q, "arguments": %s}`, call.Name, args)
+}
+
+// toolCallText writes calls as the tool_call blocks a model calling tools in its
+// text would have replied with
+func toolCallText(calls []ToolCall) string {
+	blocks := make([]string, len(calls))
+	for i, call := range calls {
+		blocks[i] = "<tool_call>" + callJSON(call) + "</tool_call>"
+	}
+	return strings.Join(blocks, "\n")
+}
+
+// addRound appends a round of calls and results to the query context
+func addRound(prompts []string, round ToolRound) []string {
+	for i, call := range round.Calls {
+		prompts = AIAddContext(prompts, "tool_call", callJSON(call))
+
+		result := round.Results[i]
+		status := "result"
+		if result.IsError {
+			status = "error"
+		}
+		prompts = AIAddContext(prompts, "tool_result", fmt.Sprintf("%s %s:\n%s", result.Name, status, result.Content))
+	}
+	return prompts
+}
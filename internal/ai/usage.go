@@ -0,0 +1,331 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"sync"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// Usage is the number of tokens a query used.
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+
+	// Estimated is set when the counts come from CountTokens rather than the provider
+	Estimated bool
+}
+
+// UsageClient is implemented by clients that report the tokens used by a query.
+type UsageClient interface {
+	Client
+	QueryTextUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, Usage, error)
+}
+
+// StreamingUsageClient is implemented by streaming clients that report the tokens
+// used by a streamed query.
+type StreamingUsageClient interface {
+	StreamingClient
+	QueryTextStreamUsage(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error)
+}
+
+// queryUsage queries client, returning the usage it reports or else an estimate
+func queryUsage(ctx context.Context, client Client, system string, prompts []string, model string, options llmclient.Options) (string, Usage, error) {
+	if uc, ok := client.(UsageClient); ok {
+		return uc.QueryTextUsage(ctx, system, prompts, model, options)
+	}
+	response, err := client.QueryText(ctx, system, prompts, model, options)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return response, EstimateUsage(model, system, prompts, response), nil
+}
+
+// queryStreamUsage streams a query through client as queryStream does, returning
+// the usage it reports or else an estimate
+func queryStreamUsage(ctx context.Context, client Client, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error) {
+	if sc, ok := client.(StreamingUsageClient); ok {
+		return sc.QueryTextStreamUsage(ctx, system, prompts, model, options, emit)
+	}
+	if _, ok := client.(StreamingClient); !ok {
+		return queryUsageEmit(ctx, client, system, prompts, model, options, emit)
+	}
+	response, err := queryStream(ctx, client, system, prompts, model, options, emit)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	return response, EstimateUsage(model, system, prompts, response), nil
+}
+
+// queryUsageEmit queries a client that cannot stream, passing the whole response
+// to emit
+func queryUsageEmit(ctx context.Context, client Client, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, Usage, error) {
+	response, usage, err := queryUsage(ctx, client, system, prompts, model, options)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if len(response) > 0 {
+		if err := emit(response); err != nil {
+			return "", Usage{}, err
+		}
+	}
+	return response, usage, nil
+}
+
+// EstimateUsage estimates the usage of a query and its response with CountTokens.
+func EstimateUsage(model, system string, prompts []string, response string) Usage {
+	prompt := CountTokens(model, system)
+	for _, p := range prompts {
+		prompt += CountTokens(model, p) + entryOverhead
+	}
+	return Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: CountTokens(model, response),
+		Estimated:        true,
+	}
+}
+
+// Price is the cost of a model's tokens in dollars per million.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns the cost of u in dollars.
+func (p Price) Cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6
+}
+
+// DefaultPrices holds list prices of known models, in dollars per million tokens.
+var DefaultPrices = map[string]Price{
+	"claude-sonnet-4":            {Input: 3, Output: 15},
+	"claude-sonnet-4-5-20250929": {Input: 3, Output: 15},
+	"claude-opus-4-1":            {Input: 15, Output: 75},
+	"claude-opus-4-1-20250805":   {Input: 15, Output: 75},
+	"claude-3-5-haiku":           {Input: 0.8, Output: 4},
+	"claude-3-5-haiku-20241022":  {Input: 0.8, Output: 4},
+	"gemini-2.5-pro":             {Input: 1.25, Output: 10},
+	"gemini-2.5-flash":           {Input: 0.3, Output: 2.5},
+	"gpt-5":                      {Input: 1.25, Output: 10},
+	"gpt-5-mini":                 {Input: 0.25, Output: 2},
+}
+
+// LoadPrices reads a JSON object mapping model names to prices and returns it
+// merged over DefaultPrices.
+func LoadPrices(path string) (map[string]Price, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	var table map[string]Price
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("invalid price table %s: %w", path, err)
+	}
+	prices := maps.Clone(DefaultPrices)
+	maps.Copy(prices, table)
+	return prices, nil
+}
+
+// Spend is the running total of queries, tokens and cost.
+type Spend struct {
+	Queries int
+	Usage
+	Cost float64
+}
+
+// add counts one query
+func (s *Spend) add(u Usage, cost float64) {
+	s.Queries++
+	s.PromptTokens += u.PromptTokens
+	s.CompletionTokens += u.CompletionTokens
+	s.Estimated = s.Estimated || u.Estimated
+	s.Cost += cost
+}
+
+// Ledger totals the usage and cost of queries, overall and per conversation, and
+// enforces an optional spend ceiling. Safe for concurrent use.
+type Ledger struct {
+	prices  map[string]Price
+	ceiling float64
+
+	mu    sync.Mutex
+	total Spend
+	byKey map[string]*Spend
+}
+
+// NewLedger creates a Ledger pricing queries with prices (nil = DefaultPrices).
+// A ceiling above zero is the spend, in dollars, at which OverBudget turns true.
+func NewLedger(prices map[string]Price, ceiling float64) *Ledger {
+	if prices == nil {
+		prices = DefaultPrices
+	}
+	return &Ledger{
+		prices:  prices,
+		ceiling: ceiling,
+		byKey:   make(map[string]*Spend),
+	}
+}
+
+// Add records a query by model in the conversation with key. Models without a
+// price count tokens but no cost.
+func (l *Ledger) Add(key, model string, u Usage) {
+	cost := l.prices[model].Cost(u)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total.add(u, cost)
+	s, ok := l.byKey[key]
+	if !ok {
+		s = &Spend{}
+		l.byKey[key] = s
+	}
+	s.add(u, cost)
+}
+
+// Total returns the spend across all conversations.
+func (l *Ledger) Total() Spend {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// Conversation returns the spend of the conversation with key.
+func (l *Ledger) Conversation(key string) Spend {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s, ok := l.byKey[key]; ok {
+		return *s
+	}
+	return Spend{}
+}
+
+// Keys returns the keys of conversations with recorded spend, sorted.
+func (l *Ledger) Keys() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.byKey))
+	for key := range l.byKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Ceiling returns the spend ceiling in dollars, or 0 if there is none.
+func (l *Ledger) Ceiling() float64 { return l.ceiling }
+
+// OverBudget reports whether the total spend has reached the ceiling.
+func (l *Ledger) OverBudget() bool {
+	if l.ceiling <= 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total.Cost >= l.ceiling
+}
+
+// conversationKey is the context key under which WithConversation stores a key
+type conversationKey struct{}
+
+// WithConversation returns a context whose queries a Meter charges to the
+// conversation with key.
+func WithConversation(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, key)
+}
+
+// conversationFrom returns the conversation key stored in ctx, if any
+func conversationFrom(ctx context.Context) string {
+	key, _ := ctx.Value(conversationKey{}).(string)
+	return key
+}
+
+// answeredKey is the context key under which a Meter stores the function a
+// Failover tells which model answered a query
+type answeredKey struct{}
+
+// reportAnswered tells the Meter above a query, if any, that model answered it
+func reportAnswered(ctx context.Context, model string) {
+	if answered, ok := ctx.Value(answeredKey{}).(func(string)); ok {
+		answered(model)
+	}
+}
+
+// Meter is a Client that records the usage of each successful query in a Ledger,
+// charged to the conversation set on the query's context with WithConversation.
+// Usage reported by the wrapped client is used when available, otherwise it is
+// estimated. Queries are priced by the model that answered them, which a Failover
+// below the Meter reports, and otherwise by the model they name.
+type Meter struct {
+	client Client
+	ledger *Ledger
+}
+
+// Ensure Meter implements StreamingClient and ToolClient
+var (
+	_ StreamingClient = (*Meter)(nil)
+	_ ToolClient      = (*Meter)(nil)
+)
+
+// NewMeter creates a Meter recording the queries made through client in ledger.
+func NewMeter(client Client, ledger *Ledger) *Meter {
+	return &Meter{client: client, ledger: ledger}
+}
+
+// QueryText implements Client.
+func (m *Meter) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	ctx, answered := m.answered(ctx, model)
+	response, usage, err := queryUsage(ctx, m.client, system, prompts, model, options)
+	if err == nil {
+		m.ledger.Add(conversationFrom(ctx), *answered, usage)
+	}
+	return response, err
+}
+
+// QueryTextStream implements StreamingClient.
+func (m *Meter) QueryTextStream(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, emit func(chunk string) error) (string, error) {
+	ctx, answered := m.answered(ctx, model)
+	response, usage, err := queryStreamUsage(ctx, m.client, system, prompts, model, options, emit)
+	if err == nil {
+		m.ledger.Add(conversationFrom(ctx), *answered, usage)
+	}
+	return response, err
+}
+
+// QueryTextTools implements ToolClient. The usage of a native tool query is
+// estimated from the query and the calls as they would be written in text.
+func (m *Meter) QueryTextTools(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, tools []Tool, rounds []ToolRound) (string, []ToolCall, error) {
+	if _, ok := m.client.(ToolClient); !ok {
+		return queryTools(ctx, clientFunc(m.QueryText), system, prompts, model, options, tools, rounds)
+	}
+	ctx, answered := m.answered(ctx, model)
+	response, calls, err := queryTools(ctx, m.client, system, prompts, model, options, tools, rounds)
+	if err == nil {
+		system, prompts := toolText(system, prompts, tools, rounds)
+		m.ledger.Add(conversationFrom(ctx), *answered, EstimateUsage(*answered, system, prompts, response+toolCallText(calls)))
+	}
+	return response, calls, err
+}
+
+// answered returns a context on which a Failover reports the model that answers a
+// query for model, and where that model is stored
+func (m *Meter) answered(ctx context.Context, model string) (context.Context, *string) {
+	answered := model
+	return context.WithValue(ctx, answeredKey{}, func(model string) { answered = model }), &answered
+}
+
+// Close closes the wrapped client.
+func (m *Meter) Close() error { return m.client.Close() }
+
+// clientFunc adapts a query function to Client
+type clientFunc func(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error)
+
+func (f clientFunc) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	return f(ctx, system, prompts, model, options)
+}
+
+func (f clientFunc) Close() error { return nil }
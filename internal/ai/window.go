@@ -0,0 +1,202 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+)
+
+// Strategy selects how a query context is brought back within its token budget.
+type Strategy string
+
+const (
+	// StrategyWindow sends only the most recent entries that fit; the stored
+	// history is kept in full.
+	StrategyWindow Strategy = "window"
+
+	// StrategyDropOldest permanently removes the oldest entries until the
+	// conversation fits.
+	StrategyDropOldest Strategy = "drop"
+
+	// StrategySummarize replaces the oldest entries with a summary written by the
+	// model, keeping the most recent entries verbatim.
+	StrategySummarize Strategy = "summarize"
+)
+
+// Strategies lists the available strategies.
+var Strategies = []Strategy{StrategyWindow, StrategyDropOldest, StrategySummarize}
+
+// ParseStrategy returns the strategy named name.
+func ParseStrategy(name string) (Strategy, error) {
+	for _, s := range Strategies {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown context strategy %q (want window, drop or summarize)", name)
+}
+
+// DefaultContextWindow is the context window assumed for models not in contextWindows.
+const DefaultContextWindow = 128000
+
+// DefaultKeepRecent is how many recent entries StrategySummarize keeps verbatim.
+const DefaultKeepRecent = 4
+
+// entryOverhead approximates the tokens added per context entry by message framing
+const entryOverhead = 4
+
+// contextWindows holds the input context window, in tokens, of known models
+var contextWindows = map[string]int{
+	"claude-sonnet-4":            200000,
+	"claude-sonnet-4-5-20250929": 200000,
+	"claude-opus-4-1":            200000,
+	"claude-opus-4-1-20250805":   200000,
+	"claude-3-5-haiku":           200000,
+	"claude-3-5-haiku-20241022":  200000,
+	"gemini-2.5-pro":             1048576,
+	"gemini-2.5-flash":           1048576,
+	"gpt-5":                      272000,
+	"gpt-5-mini":                 272000,
+}
+
+// charsPerToken approximates each provider's tokenizer density for English text
+var charsPerToken = map[string]float64{
+	llmclient.Anthropic: 3.5,
+	llmclient.Gemini:    4.0,
+	llmclient.OpenAI:    4.0,
+}
+
+// ContextWindow returns the input context window of model in tokens.
+func ContextWindow(model string) int {
+	if window, ok := contextWindows[model]; ok {
+		return window
+	}
+	return DefaultContextWindow
+}
+
+// CountTokens estimates the number of tokens text occupies for model's tokenizer.
+// The estimate errs on the high side so budgets are not overrun.
+func CountTokens(model, text string) int {
+	ratio := 3.5
+	if provider, err := llmclient.GetProviderName(model); err == nil {
+		if r, ok := charsPerToken[provider]; ok {
+			ratio = r
+		}
+	}
+	return int(float64(len(text))/ratio) + 1
+}
+
+// ContextManager keeps query contexts within a token budget.
+type ContextManager struct {
+	Model    string
+	Strategy Strategy
+
+	// Budget is the number of tokens the system prompt and context may use.
+	// If zero, the model's context window less its maximum output is used.
+	Budget int
+
+	// KeepRecent is how many recent entries StrategySummarize keeps verbatim
+	// (0 = DefaultKeepRecent).
+	KeepRecent int
+
+	// Summarize condenses entries into a single summary for StrategySummarize.
+	Summarize func(ctx context.Context, entries []string) (string, error)
+}
+
+// budget returns the token budget for the context alone, after system
+func (m *ContextManager) budget(system string) int {
+	budget := m.Budget
+	if budget <= 0 {
+		budget = ContextWindow(m.Model) - int(llmclient.GetMaxTokens(m.Model))
+	}
+	return budget - CountTokens(m.Model, system)
+}
+
+// tokens estimates the tokens used by entries
+func (m *ContextManager) tokens(entries []string) int {
+	total := 0
+	for _, entry := range entries {
+		total += CountTokens(m.Model, entry) + entryOverhead
+	}
+	return total
+}
+
+// Tokens estimates the tokens a query with system and entries would use.
+func (m *ContextManager) Tokens(system string, entries []string) int {
+	return CountTokens(m.Model, system) + m.tokens(entries)
+}
+
+// Window returns the longest suffix of entries that fits the budget. The most
+// recent entry is always included so there is something to answer.
+func (m *ContextManager) Window(system string, entries []string) []string {
+	return entries[m.cut(system, entries):]
+}
+
+// cut returns the index of the first entry kept by Window
+func (m *ContextManager) cut(system string, entries []string) int {
+	remaining := m.budget(system)
+	for i := len(entries) - 1; i >= 0; i-- {
+		remaining -= CountTokens(m.Model, entries[i]) + entryOverhead
+		if remaining < 0 {
+			return min(i+1, len(entries)-1)
+		}
+	}
+	return 0
+}
+
+// Fit applies the strategy to entries. It returns the context to query with and
+// the history to store in place of entries, which is entries itself unless the
+// strategy drops or summarizes old entries. ctx bounds the summarizing query.
+func (m *ContextManager) Fit(ctx context.Context, system string, entries []string) (query, history []string, err error) {
+	if len(entries) == 0 || m.tokens(entries) <= m.budget(system) {
+		return entries, entries, nil
+	}
+
+	switch m.Strategy {
+	case StrategyDropOldest:
+		kept := m.Window(system, entries)
+		return kept, kept, nil
+
+	case StrategySummarize:
+		if m.Summarize == nil {
+			return nil, nil, fmt.Errorf("context strategy %s needs a summarizer", m.Strategy)
+		}
+		keep := m.KeepRecent
+		if keep <= 0 {
+			keep = DefaultKeepRecent
+		}
+		split := max(len(entries)-keep, 0)
+		if split == 0 {
+			// Nothing old enough to summarize; fall back to the window
+			return m.Window(system, entries), entries, nil
+		}
+		summary, err := m.Summarize(ctx, entries[:split])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to summarize conversation: %w", err)
+		}
+		history = append(AIAddContext(nil, "summary", summary), entries[split:]...)
+		return m.Window(system, history), history, nil
+
+	default:
+		return m.Window(system, entries), entries, nil
+	}
+}
+
+// summaryPrompt instructs the model to condense older conversation turns
+const summaryPrompt = `You condense conversation history. Summarize the conversation below in a
+few short paragraphs, keeping names, facts, decisions, open questions and anything a
+participant asked to remember. Reply with the summary only.`
+
+// NewSummarizer returns a summarizer for ContextManager that asks client's model
+// to condense entries.
+func NewSummarizer(client Client, model string) func(ctx context.Context, entries []string) (string, error) {
+	return func(ctx context.Context, entries []string) (string, error) {
+		response, err := AIQuery(ctx, client, summaryPrompt, []string{strings.Join(entries, "\n")}, model)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(response), nil
+	}
+}
@@ -3,10 +3,18 @@ package errors
 // Error constants shared between client and server
 const (
 	ErrContentTooLarge       = "content exceeds 250000 character limit"
+	ErrAttachmentTooLarge    = "attachment data exceeds 16 MB limit"
 	ErrClientNotRegistered   = "destination client is not registered"
 	ErrDuplicateClientID     = "client ID is already registered"
 	ErrMaxClientsReached     = "maximum number of clients (16) reached"
 	ErrClientDisconnected    = "destination client is disconnected"
 	ErrUnexpectedMessage     = "unexpected message type after registration"
 	ErrInvalidFirstMessage   = "first message must be REGISTER"
+	ErrRequestTimeout        = "request timed out waiting for a reply"
+	ErrPeerUnreachable       = "peer disconnected before replying"
+	ErrInvalidStream         = "streamed message must be StreamStart, StreamChunk... StreamEnd with a single stream ID"
+	ErrNotYourTurn           = "sender does not hold the turn"
+	ErrCannotPassTurn        = "turn cannot be passed to that client"
+	ErrNoFloorControl        = "server does not run floor control"
+	ErrStreamStalled         = "streamed message sent nothing for too long"
 )
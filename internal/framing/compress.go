@@ -0,0 +1,164 @@
+package framing
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the algorithm used to compress a frame payload.
+// The value is carried in the flags byte of the frame header.
+type Compression uint8
+
+const (
+	CompressionNone Compression = 0
+	CompressionGzip Compression = 1
+	CompressionZstd Compression = 2
+)
+
+// CompressionThreshold is the smallest payload that is compressed. Smaller
+// envelopes are sent as-is since compression would not pay for its overhead.
+const CompressionThreshold = 1024
+
+// MaxDecompressedSize bounds the size of a decompressed payload so a small frame
+// cannot expand without limit (a decompression bomb).
+const MaxDecompressedSize = 4 * 1024 * 1024
+
+// SupportedCompressions lists the algorithm names this implementation accepts,
+// in order of preference. Clients offer these at registration.
+var SupportedCompressions = []string{"zstd", "gzip"}
+
+// String returns the negotiation name of the algorithm
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// ParseCompression converts a negotiation name into a Compression.
+// Unknown names return CompressionNone and false.
+func ParseCompression(name string) (Compression, bool) {
+	switch name {
+	case "gzip":
+		return CompressionGzip, true
+	case "zstd":
+		return CompressionZstd, true
+	case "", "none":
+		return CompressionNone, true
+	default:
+		return CompressionNone, false
+	}
+}
+
+// NegotiateCompression returns the first algorithm in offered that is supported,
+// or CompressionNone if there is none.
+func NegotiateCompression(offered []string) Compression {
+	for _, name := range offered {
+		if c, ok := ParseCompression(name); ok && c != CompressionNone {
+			return c
+		}
+	}
+	return CompressionNone
+}
+
+var (
+	zstdEncoderOnce sync.Once
+	zstdEncoder     *zstd.Encoder
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+
+	gzipWriterPool sync.Pool
+	gzipReaderPool sync.Pool
+)
+
+// appendWriter is an io.Writer that appends to a byte slice
+type appendWriter struct {
+	b []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+// appendCompressed appends data compressed with c to dst
+func appendCompressed(dst []byte, c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		aw := &appendWriter{b: dst}
+		zw, _ := gzipWriterPool.Get().(*gzip.Writer)
+		if zw == nil {
+			zw = gzip.NewWriter(aw)
+		} else {
+			zw.Reset(aw)
+		}
+		defer gzipWriterPool.Put(zw)
+		if _, err := zw.Write(data); err != nil {
+			return dst, err
+		}
+		if err := zw.Close(); err != nil {
+			return dst, err
+		}
+		return aw.b, nil
+	case CompressionZstd:
+		zstdEncoderOnce.Do(func() {
+			zstdEncoder, _ = zstd.NewWriter(nil)
+		})
+		return zstdEncoder.EncodeAll(data, dst), nil
+	default:
+		return dst, fmt.Errorf("unsupported compression %d", c)
+	}
+}
+
+// appendDecompressed appends data decompressed with c to dst, failing if the
+// result would exceed MaxDecompressedSize
+func appendDecompressed(dst []byte, c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		zr, _ := gzipReaderPool.Get().(*gzip.Reader)
+		var err error
+		if zr == nil {
+			zr, err = gzip.NewReader(bytes.NewReader(data))
+		} else {
+			err = zr.Reset(bytes.NewReader(data))
+		}
+		if err != nil {
+			return dst, err
+		}
+		defer gzipReaderPool.Put(zr)
+
+		// Read at most one byte past the limit to detect oversized payloads
+		buf := bytes.NewBuffer(dst)
+		n, err := buf.ReadFrom(io.LimitReader(zr, MaxDecompressedSize+1))
+		if err != nil {
+			return dst, err
+		}
+		if n > MaxDecompressedSize {
+			return dst, fmt.Errorf("decompressed size exceeds MaxDecompressedSize %d", MaxDecompressedSize)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		zstdDecoderOnce.Do(func() {
+			zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(MaxDecompressedSize))
+		})
+		out, err := zstdDecoder.DecodeAll(data, dst)
+		if err != nil {
+			return dst, err
+		}
+		if len(out)-len(dst) > MaxDecompressedSize {
+			return dst, fmt.Errorf("decompressed size exceeds MaxDecompressedSize %d", MaxDecompressedSize)
+		}
+		return out, nil
+	default:
+		return dst, fmt.Errorf("unsupported compression flag %d", c)
+	}
+}
@@ -0,0 +1,87 @@
+package framing
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	pb "github.com/dmh2000/talkers/internal/proto"
+)
+
+// maxPooledBuffer is the largest buffer returned to the pool. Rare oversized
+// buffers are left to the garbage collector rather than pinned in the pool.
+const maxPooledBuffer = MaxFrameSize + headerSize
+
+// bufferPool holds byte slices shared by WriteEnvelope and ReadEnvelope
+var bufferPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// getBuffer takes a buffer from the pool
+func getBuffer() *[]byte {
+	return bufferPool.Get().(*[]byte)
+}
+
+// putBuffer returns a buffer to the pool unless it has grown too large
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	*b = (*b)[:0]
+	bufferPool.Put(b)
+}
+
+// FrameWriter writes framed envelopes to an underlying writer, keeping its
+// buffers across calls so steady-state writes do not allocate. Each frame is
+// sent with a single Write. A FrameWriter is not safe for concurrent use.
+type FrameWriter struct {
+	w           io.Writer
+	compression Compression
+	buf         []byte
+	scratch     []byte
+}
+
+// NewFrameWriter returns a FrameWriter that writes to w, compressing payloads with c
+func NewFrameWriter(w io.Writer, c Compression) *FrameWriter {
+	return &FrameWriter{w: w, compression: c}
+}
+
+// SetCompression changes the compression applied to subsequent frames
+func (fw *FrameWriter) SetCompression(c Compression) {
+	fw.compression = c
+}
+
+// WriteEnvelope serializes, frames and writes env
+func (fw *FrameWriter) WriteEnvelope(env *pb.Envelope) error {
+	frame, err := appendFrame(fw.buf[:0], &fw.scratch, env, fw.compression)
+	fw.buf = frame[:0]
+	if err != nil {
+		return err
+	}
+	if _, err := fw.w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// FrameReader reads framed envelopes from an underlying reader, keeping its
+// buffers across calls. A FrameReader is not safe for concurrent use.
+type FrameReader struct {
+	r       io.Reader
+	header  [headerSize]byte
+	buf     []byte
+	scratch []byte
+}
+
+// NewFrameReader returns a FrameReader that reads from r
+func NewFrameReader(r io.Reader) *FrameReader {
+	return &FrameReader{r: r}
+}
+
+// ReadEnvelope reads and decodes the next envelope
+func (fr *FrameReader) ReadEnvelope() (*pb.Envelope, error) {
+	return readFrame(fr.r, fr.header[:], &fr.buf, &fr.scratch)
+}
@@ -14,49 +14,123 @@ import (
 // 512 KB accommodates 250K character content (up to 750KB in UTF-8) plus protobuf overhead.
 const MaxFrameSize = 512 * 1024
 
-// MaxIdleTimeout is the QUIC connection idle timeout used by both client and server.
+// MaxAttachmentSize is the maximum total size of a message's binary data.
+// Data larger than a single frame is sent as a streamed message.
+const MaxAttachmentSize = 16 * 1024 * 1024
+
+// AttachmentChunkSize is the amount of binary data carried by each StreamChunk
+// of a streamed attachment, leaving room for envelope overhead within MaxFrameSize.
+const AttachmentChunkSize = 256 * 1024
+
+// MaxIdleTimeout is the connection idle timeout used by both client and server.
 const MaxIdleTimeout = 6000 * time.Second
 
-// WriteEnvelope serializes the envelope using protobuf, writes a 4-byte big-endian
-// length prefix, then writes the payload bytes to the stream.
+// The 4-byte big-endian frame header holds a flags byte followed by a 24-bit
+// payload length. The flags byte carries the Compression applied to the payload;
+// zero means the payload is an uncompressed protobuf Envelope.
+const (
+	headerSize       = 4
+	headerFlagsShift = 24
+	headerLengthMask = 1<<headerFlagsShift - 1
+)
+
+// WriteEnvelope serializes the envelope using protobuf and writes it to the stream
+// behind a 4-byte big-endian length prefix, as a single Write.
 func WriteEnvelope(stream io.Writer, env *pb.Envelope) error {
-	// Serialize the envelope to protobuf format
-	data, err := proto.Marshal(env)
+	return WriteEnvelopeCompressed(stream, env, CompressionNone)
+}
+
+// WriteEnvelopeCompressed is like WriteEnvelope but compresses payloads of at least
+// CompressionThreshold bytes with c, setting the frame's compression flag. The payload
+// is sent uncompressed when compression does not make it smaller.
+//
+// Buffers come from a shared pool; use a FrameWriter to keep them across calls.
+func WriteEnvelopeCompressed(stream io.Writer, env *pb.Envelope, c Compression) error {
+	buf, scratch := getBuffer(), getBuffer()
+	defer putBuffer(buf)
+	defer putBuffer(scratch)
+
+	frame, err := appendFrame((*buf)[:0], scratch, env, c)
+	*buf = frame[:0]
 	if err != nil {
-		return fmt.Errorf("failed to marshal envelope: %w", err)
+		return err
 	}
-
-	// Check if the serialized data exceeds MaxFrameSize
-	if len(data) > MaxFrameSize {
-		return fmt.Errorf("envelope size %d exceeds MaxFrameSize %d", len(data), MaxFrameSize)
+	if _, err := stream.Write(frame); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
 	}
+	return nil
+}
+
+// ReadEnvelope reads a 4-byte frame header, validates the length against MaxFrameSize,
+// reads the payload into a pooled buffer, decompresses it if the header says so, and
+// unmarshals the protobuf envelope.
+//
+// Use a FrameReader to keep the buffers across calls.
+func ReadEnvelope(stream io.Reader) (*pb.Envelope, error) {
+	var header [headerSize]byte
+	buf, scratch := getBuffer(), getBuffer()
+	defer putBuffer(buf)
+	defer putBuffer(scratch)
 
-	// Write the 4-byte big-endian length prefix
-	lengthPrefix := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthPrefix, uint32(len(data)))
-	if _, err := stream.Write(lengthPrefix); err != nil {
-		return fmt.Errorf("failed to write length prefix: %w", err)
+	return readFrame(stream, header[:], buf, scratch)
+}
+
+// appendFrame appends the framed envelope to dst and returns the extended slice.
+// scratch holds the uncompressed payload when c applies; both buffers may be grown.
+func appendFrame(dst []byte, scratch *[]byte, env *pb.Envelope, c Compression) ([]byte, error) {
+	var err error
+	start := len(dst)
+
+	// Reserve the header, then serialize the envelope directly after it
+	dst = append(dst, 0, 0, 0, 0)
+	dst, err = proto.MarshalOptions{}.MarshalAppend(dst, env)
+	if err != nil {
+		return dst[:start], fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	size := len(dst) - start - headerSize
+
+	flags := CompressionNone
+	if c != CompressionNone && size >= CompressionThreshold {
+		if size > MaxDecompressedSize {
+			return dst[:start], fmt.Errorf("envelope size %d exceeds MaxDecompressedSize %d", size, MaxDecompressedSize)
+		}
+
+		// Move the payload aside and compress it back into place
+		*scratch = append((*scratch)[:0], dst[start+headerSize:]...)
+		compressed, err := appendCompressed(dst[:start+headerSize], c, *scratch)
+		if err != nil {
+			return dst[:start], fmt.Errorf("failed to compress envelope: %w", err)
+		}
+		if len(compressed)-start-headerSize < size {
+			dst = compressed
+			size = len(dst) - start - headerSize
+			flags = c
+		} else {
+			dst = append(compressed[:start+headerSize], *scratch...)
+		}
 	}
 
-	// Write the payload bytes
-	if _, err := stream.Write(data); err != nil {
-		return fmt.Errorf("failed to write payload: %w", err)
+	// Check if the serialized data exceeds MaxFrameSize
+	if size > MaxFrameSize {
+		return dst[:start], fmt.Errorf("envelope size %d exceeds MaxFrameSize %d", size, MaxFrameSize)
 	}
 
-	return nil
+	binary.BigEndian.PutUint32(dst[start:], uint32(flags)<<headerFlagsShift|uint32(size))
+	return dst, nil
 }
 
-// ReadEnvelope reads a 4-byte length prefix, validates it against MaxFrameSize,
-// allocates a buffer, reads the payload, and unmarshals the protobuf envelope.
-func ReadEnvelope(stream io.Reader) (*pb.Envelope, error) {
+// readFrame reads one frame from stream using header for the prefix, buf for the
+// payload and scratch for decompression, and unmarshals the envelope.
+func readFrame(stream io.Reader, header []byte, buf, scratch *[]byte) (*pb.Envelope, error) {
 	// Read the 4-byte length prefix
-	lengthPrefix := make([]byte, 4)
-	if _, err := io.ReadFull(stream, lengthPrefix); err != nil {
+	if _, err := io.ReadFull(stream, header); err != nil {
 		return nil, fmt.Errorf("failed to read length prefix: %w", err)
 	}
 
-	// Parse the length
-	length := binary.BigEndian.Uint32(lengthPrefix)
+	// Parse the flags and length
+	prefix := binary.BigEndian.Uint32(header)
+	flags := Compression(prefix >> headerFlagsShift)
+	length := int(prefix & headerLengthMask)
 
 	// Validate the length against MaxFrameSize
 	if length > MaxFrameSize {
@@ -68,15 +142,28 @@ func ReadEnvelope(stream io.Reader) (*pb.Envelope, error) {
 		return nil, fmt.Errorf("frame size cannot be zero")
 	}
 
-	// Allocate buffer for the payload
-	payload := make([]byte, length)
+	// Size the buffer for the payload
+	if cap(*buf) < length {
+		*buf = make([]byte, length)
+	}
+	payload := (*buf)[:length]
 
 	// Read the payload
 	if _, err := io.ReadFull(stream, payload); err != nil {
 		return nil, fmt.Errorf("failed to read payload: %w", err)
 	}
 
-	// Unmarshal the protobuf envelope
+	// Decompress the payload if flagged
+	if flags != CompressionNone {
+		var err error
+		*scratch, err = appendDecompressed((*scratch)[:0], flags, payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress payload: %w", err)
+		}
+		payload = *scratch
+	}
+
+	// Unmarshal the protobuf envelope; strings and bytes are copied out of the buffer
 	env := &pb.Envelope{}
 	if err := proto.Unmarshal(payload, env); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
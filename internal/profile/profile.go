@@ -0,0 +1,228 @@
+// Package profile loads agent profiles: YAML files describing a talkers client,
+// its model, system prompt, generation options, reply policy and limits.
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/ai"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxIDLength is the longest client ID the server accepts.
+const MaxIDLength = 32
+
+// Defaults for fields a profile leaves out.
+const (
+	DefaultAttachments  = "attachments"
+	DefaultAITimeout    = 2 * time.Minute
+	DefaultMaxTurns     = 20
+	DefaultRepeatWindow = 4
+)
+
+// Profile describes one agent. Durations are written as Go durations ("30s").
+type Profile struct {
+	ID          string `yaml:"id"`
+	Server      string `yaml:"server"`
+	Model       string `yaml:"model"`
+	NoAI        bool   `yaml:"no_ai"`
+	System      string `yaml:"system"`      // system prompt template, inline
+	SystemFile  string `yaml:"system_file"` // or read from a file
+	Attachments string `yaml:"attachments"` // directory for received attachments
+
+	Generation Generation `yaml:"generation"`
+	Context    Context    `yaml:"context"`
+	Reply      Reply      `yaml:"reply"`
+	Limits     Limits     `yaml:"limits"`
+	AI         AIConfig   `yaml:"ai"`
+	Tools      Tools      `yaml:"tools"`
+	Output     Output     `yaml:"output"`
+}
+
+// Generation holds the options passed to the model with every query.
+type Generation struct {
+	Temperature float32 `yaml:"temperature"`
+	MaxTokens   int64   `yaml:"max_tokens"` // 0 = the model's default
+}
+
+// Context controls how a long conversation is fitted into each query.
+type Context struct {
+	Budget   int    `yaml:"budget"` // tokens; 0 = model window less output
+	Strategy string `yaml:"strategy"`
+}
+
+// Reply is the reply policy: which messages the AI answers and how.
+type Reply struct {
+	To             []string      `yaml:"to"`     // peer patterns answered; empty = all
+	Ignore         []string      `yaml:"ignore"` // peer patterns never answered
+	MentionOnly    bool          `yaml:"mention_only"`
+	Approve        bool          `yaml:"approve"`
+	ApproveTimeout time.Duration `yaml:"approve_timeout"`
+}
+
+// Limits are the stop conditions and spend ceiling for AI replies.
+type Limits struct {
+	MaxTurns     int           `yaml:"max_turns"`
+	TokenBudget  int           `yaml:"token_budget"`
+	RepeatWindow int           `yaml:"repeat_window"`
+	EndMarker    string        `yaml:"end_marker"`
+	Cooldown     time.Duration `yaml:"cooldown"`
+	MaxSpend     float64       `yaml:"max_spend"`
+	AITimeout    time.Duration `yaml:"ai_timeout"`
+}
+
+// AIConfig configures the AI client: failover, pricing and cassettes.
+type AIConfig struct {
+	Fallback     []string `yaml:"fallback"`
+	Retries      int      `yaml:"retries"`
+	Prices       string   `yaml:"prices"`
+	Record       string   `yaml:"record"`
+	Replay       string   `yaml:"replay"`
+	ReplayStrict bool     `yaml:"replay_strict"`
+}
+
+// Tools selects the built-in tools the model may call while writing a reply.
+type Tools struct {
+	Use       []string `yaml:"use"`        // tool names, such as calculate or read_file
+	Files     string   `yaml:"files"`      // directory the file tools may read
+	MaxRounds int      `yaml:"max_rounds"` // rounds of calls per reply; 0 = ai.DefaultMaxToolRounds
+}
+
+// Output makes the model reply with JSON matching a schema, given inline or in a
+// file like the system prompt.
+type Output struct {
+	Schema     string `yaml:"schema"`      // JSON Schema, inline
+	SchemaFile string `yaml:"schema_file"` // or read from a file
+	Retries    int    `yaml:"retries"`     // queries again after a reply that does not match
+}
+
+// Default returns a profile with every default set and no identity.
+func Default() Profile {
+	return Profile{
+		Attachments: DefaultAttachments,
+		Context:     Context{Strategy: string(ai.StrategyWindow)},
+		Limits: Limits{
+			MaxTurns:     DefaultMaxTurns,
+			RepeatWindow: DefaultRepeatWindow,
+			EndMarker:    ai.DefaultEndMarker,
+			AITimeout:    DefaultAITimeout,
+		},
+		AI:     AIConfig{Retries: ai.DefaultMaxAttempts},
+		Output: Output{Retries: ai.DefaultSchemaRetries},
+	}
+}
+
+// Load reads the profile at path over the defaults. Unknown fields are errors.
+// Relative file paths in the profile are taken relative to its directory.
+func Load(path string) (Profile, error) {
+	p := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, fmt.Errorf("failed to read profile: %w", err)
+	}
+	if err := Parse(data, filepath.Dir(path), &p); err != nil {
+		return p, fmt.Errorf("invalid profile %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes YAML profile fields from data over p, leaving fields the data does
+// not set unchanged. Unknown fields are errors, and relative file paths are taken
+// relative to dir.
+func Parse(data []byte, dir string, p *Profile) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	for _, file := range []*string{&p.SystemFile, &p.AI.Prices, &p.AI.Record, &p.AI.Replay, &p.Tools.Files, &p.Output.SchemaFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(dir, *file)
+		}
+	}
+	return nil
+}
+
+// Validate checks that p describes a usable agent.
+func (p *Profile) Validate() error {
+	switch {
+	case p.ID == "":
+		return errors.New("client ID cannot be empty")
+	case len(p.ID) > MaxIDLength:
+		return fmt.Errorf("client ID %s exceeds maximum length of %d characters", p.ID, MaxIDLength)
+	case p.Server == "":
+		return fmt.Errorf("%s: server address cannot be empty", p.ID)
+	}
+	if p.NoAI {
+		return nil
+	}
+
+	switch {
+	case p.Model == "":
+		return fmt.Errorf("%s: model cannot be empty", p.ID)
+	case p.System == "" && p.SystemFile == "":
+		return fmt.Errorf("%s: a system prompt or system file is required", p.ID)
+	case p.System != "" && p.SystemFile != "":
+		return fmt.Errorf("%s: system and system_file cannot be used together", p.ID)
+	case p.AI.Record != "" && p.AI.Replay != "":
+		return fmt.Errorf("%s: record and replay cannot be used together", p.ID)
+	case p.Generation.Temperature < 0:
+		return fmt.Errorf("%s: temperature cannot be negative", p.ID)
+	case p.Generation.MaxTokens < 0:
+		return fmt.Errorf("%s: max tokens cannot be negative", p.ID)
+	case p.Tools.MaxRounds < 0:
+		return fmt.Errorf("%s: tool rounds cannot be negative", p.ID)
+	case p.Output.Schema != "" && p.Output.SchemaFile != "":
+		return fmt.Errorf("%s: schema and schema_file cannot be used together", p.ID)
+	case p.Output.Retries < 0:
+		return fmt.Errorf("%s: schema retries cannot be negative", p.ID)
+	}
+	if _, err := ai.ParseStrategy(p.Context.Strategy); err != nil {
+		return fmt.Errorf("%s: %w", p.ID, err)
+	}
+	return nil
+}
+
+// SystemPrompt parses the profile's system prompt template.
+func (p *Profile) SystemPrompt() (*ai.SystemPrompt, error) {
+	if p.SystemFile == "" {
+		return ai.ParseSystemPrompt(p.ID, p.System)
+	}
+	text, err := os.ReadFile(p.SystemFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system file: %w", err)
+	}
+	return ai.ParseSystemPrompt(p.SystemFile, string(text))
+}
+
+// OutputSchema parses the schema replies must match, or returns nil if the
+// profile has none.
+func (p *Profile) OutputSchema() (*ai.Schema, error) {
+	if p.Output.SchemaFile == "" {
+		if p.Output.Schema == "" {
+			return nil, nil
+		}
+		return ai.ParseSchema(p.ID, []byte(p.Output.Schema))
+	}
+	data, err := os.ReadFile(p.Output.SchemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+	return ai.ParseSchema(p.Output.SchemaFile, data)
+}
+
+// Options returns the generation options for the profile's queries.
+func (p *Profile) Options() llmclient.Options {
+	return llmclient.Options{
+		Temperature: p.Generation.Temperature,
+		MaxTokens:   p.Generation.MaxTokens,
+	}
+}
@@ -23,7 +23,8 @@ const (
 
 type Register struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	From          string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"` // client ID, max 32 characters
+	From          string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`               // client ID, max 32 characters
+	Compression   []string               `protobuf:"bytes,2,rep,name=compression,proto3" json:"compression,omitempty"` // payload compressions the client accepts, in preference order
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,28 +66,671 @@ func (x *Register) GetFrom() string {
 	return ""
 }
 
+func (x *Register) GetCompression() []string {
+	if x != nil {
+		return x.Compression
+	}
+	return nil
+}
+
+// Sent by the server on the control stream once registration succeeds.
+type Registered struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Compression   string                 `protobuf:"bytes,1,opt,name=compression,proto3" json:"compression,omitempty"` // compression both sides use for payloads; empty means none
+	Turn          *Turn                  `protobuf:"bytes,2,opt,name=turn,proto3" json:"turn,omitempty"`               // current turn, when the server runs floor control
+	Room          string                 `protobuf:"bytes,3,opt,name=room,proto3" json:"room,omitempty"`               // name of the room the server hosts; empty if unnamed
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Registered) Reset() {
+	*x = Registered{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Registered) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Registered) ProtoMessage() {}
+
+func (x *Registered) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Registered.ProtoReflect.Descriptor instead.
+func (*Registered) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Registered) GetCompression() string {
+	if x != nil {
+		return x.Compression
+	}
+	return ""
+}
+
+func (x *Registered) GetTurn() *Turn {
+	if x != nil {
+		return x.Turn
+	}
+	return nil
+}
+
+func (x *Registered) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+// Floor control. The server sends a Turn on every client's control stream when
+// the turn changes; a client sends one on its control stream to pass the turn,
+// naming the client it passes to (empty for the next one) and the number of the
+// turn it is passing.
+type Turn struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Holder        string                 `protobuf:"bytes,1,opt,name=holder,proto3" json:"holder,omitempty"`       // client that holds the turn; empty when the floor is free or with the moderator
+	Mode          string                 `protobuf:"bytes,2,opt,name=mode,proto3" json:"mode,omitempty"`           // round-robin, token or moderated
+	Number        uint64                 `protobuf:"varint,3,opt,name=number,proto3" json:"number,omitempty"`      // increases with every change of turn; clients ignore a Turn whose number is not above the last one seen
+	Moderator     string                 `protobuf:"bytes,4,opt,name=moderator,proto3" json:"moderator,omitempty"` // moderator's client ID in moderated mode
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Turn) Reset() {
+	*x = Turn{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Turn) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Turn) ProtoMessage() {}
+
+func (x *Turn) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Turn.ProtoReflect.Descriptor instead.
+func (*Turn) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Turn) GetHolder() string {
+	if x != nil {
+		return x.Holder
+	}
+	return ""
+}
+
+func (x *Turn) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *Turn) GetNumber() uint64 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Turn) GetModerator() string {
+	if x != nil {
+		return x.Moderator
+	}
+	return ""
+}
+
 type Error struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"` // human-readable error description
+	Error         string                 `protobuf:"bytes,1,opt,name=error,proto3" json:"error,omitempty"`                          // human-readable error description
+	RequestId     string                 `protobuf:"bytes,2,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // request the error answers, when it concerns a request
+	AckId         string                 `protobuf:"bytes,3,opt,name=ack_id,json=ackId,proto3" json:"ack_id,omitempty"`             // message that could not be delivered, when it asked for an Ack
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Error) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Error) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Error) GetAckId() string {
+	if x != nil {
+		return x.AckId
+	}
+	return ""
+}
+
+// Control stream keep-alive. A client sends a Ping; the server answers with a
+// Pong carrying the same id.
+type Ping struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ping) Reset() {
+	*x = Ping{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ping) ProtoMessage() {}
+
+func (x *Ping) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ping.ProtoReflect.Descriptor instead.
+func (*Ping) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Ping) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Pong struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Pong) Reset() {
+	*x = Pong{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pong) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pong) ProtoMessage() {}
+
+func (x *Pong) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pong.ProtoReflect.Descriptor instead.
+func (*Pong) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Pong) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// Sent by the server on every other client's control stream when a client
+// registers or disconnects.
+type Presence struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ClientId      string                 `protobuf:"bytes,1,opt,name=client_id,json=clientId,proto3" json:"client_id,omitempty"`
+	Online        bool                   `protobuf:"varint,2,opt,name=online,proto3" json:"online,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Presence) Reset() {
+	*x = Presence{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Presence) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Presence) ProtoMessage() {}
+
+func (x *Presence) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Presence.ProtoReflect.Descriptor instead.
+func (*Presence) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Presence) GetClientId() string {
+	if x != nil {
+		return x.ClientId
+	}
+	return ""
+}
+
+func (x *Presence) GetOnline() bool {
+	if x != nil {
+		return x.Online
+	}
+	return false
+}
+
+// Sent by the server on the sender's control stream once a message with an
+// ack_id has been delivered to its recipient. A message that cannot be
+// delivered is answered by an Error with the ack_id instead.
+type Ack struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AckId         string                 `protobuf:"bytes,1,opt,name=ack_id,json=ackId,proto3" json:"ack_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Ack) GetAckId() string {
+	if x != nil {
+		return x.AckId
+	}
+	return ""
+}
+
+// Sent by a client on its control stream to ask which clients are connected;
+// the server answers with a Roster carrying the same id.
+type RosterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RosterRequest) Reset() {
+	*x = RosterRequest{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RosterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RosterRequest) ProtoMessage() {}
+
+func (x *RosterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RosterRequest.ProtoReflect.Descriptor instead.
+func (*RosterRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RosterRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type Roster struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Clients       []string               `protobuf:"bytes,2,rep,name=clients,proto3" json:"clients,omitempty"` // IDs of every registered client, sorted, including the asker
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Roster) Reset() {
+	*x = Roster{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Roster) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Roster) ProtoMessage() {}
+
+func (x *Roster) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Roster.ProtoReflect.Descriptor instead.
+func (*Roster) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Roster) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Roster) GetClients() []string {
+	if x != nil {
+		return x.Clients
+	}
+	return nil
+}
+
+type Message struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	FromId      string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`                                                                 // sending client's ID
+	ToId        string                 `protobuf:"bytes,2,opt,name=to_id,json=toId,proto3" json:"to_id,omitempty"`                                                                       // destination client's ID
+	Content     string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`                                                                             // message body, max 250,000 characters
+	ContentType string                 `protobuf:"bytes,4,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`                                                  // MIME type of data, or of content without data; empty means plain text
+	Data        []byte                 `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`                                                                                   // binary payload (attachment, JSON, image, ...)
+	Filename    string                 `protobuf:"bytes,6,opt,name=filename,proto3" json:"filename,omitempty"`                                                                           // optional file name for data
+	Metadata    map[string]string      `protobuf:"bytes,7,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"` // optional application-defined attributes
+	// Request/reply correlation. A request carries a sender-chosen request_id; the
+	// answer carries it back in reply_to. The server tells the requester if no
+	// reply arrives within timeout_ms or the peer disconnects first.
+	RequestId string `protobuf:"bytes,8,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	ReplyTo   string `protobuf:"bytes,9,opt,name=reply_to,json=replyTo,proto3" json:"reply_to,omitempty"`
+	TimeoutMs uint32 `protobuf:"varint,10,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"` // how long the server waits for a reply (0 = server default)
+	// Set by the server on delivery: the message's place, counting from 1, among
+	// those from from_id to to_id over the recipient's connection, streamed ones
+	// included. Recipients deliver each sender's messages in this order.
+	Seq           uint64 `protobuf:"varint,11,opt,name=seq,proto3" json:"seq,omitempty"`
+	AckId         string `protobuf:"bytes,12,opt,name=ack_id,json=ackId,proto3" json:"ack_id,omitempty"` // sender-chosen ID; the server answers with an Ack once delivered
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Message) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *Message) GetToId() string {
+	if x != nil {
+		return x.ToId
+	}
+	return ""
+}
+
+func (x *Message) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *Message) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Message) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *Message) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *Message) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *Message) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Message) GetReplyTo() string {
+	if x != nil {
+		return x.ReplyTo
+	}
+	return ""
+}
+
+func (x *Message) GetTimeoutMs() uint32 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *Message) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Message) GetAckId() string {
+	if x != nil {
+		return x.AckId
+	}
+	return ""
+}
+
+// A streamed message is sent on a single message stream as one StreamStart,
+// any number of StreamChunks and a final StreamEnd. The server forwards each
+// frame to the recipient as it arrives.
+// Attachments larger than a single frame are sent the same way, with the
+// content type, file name and metadata carried on StreamStart and the bytes
+// split across StreamChunk.data.
+type StreamStart struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreamId      string                 `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`          // sender-chosen ID, unique per sender
+	FromId        string                 `protobuf:"bytes,2,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`                // sending client's ID
+	ToId          string                 `protobuf:"bytes,3,opt,name=to_id,json=toId,proto3" json:"to_id,omitempty"`                      // destination client's ID
+	ContentType   string                 `protobuf:"bytes,4,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"` // MIME type of the chunk data, as in Message
+	Filename      string                 `protobuf:"bytes,5,opt,name=filename,proto3" json:"filename,omitempty"`
+	Metadata      map[string]string      `protobuf:"bytes,6,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	RequestId     string                 `protobuf:"bytes,7,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"` // request/reply correlation, as in Message
+	ReplyTo       string                 `protobuf:"bytes,8,opt,name=reply_to,json=replyTo,proto3" json:"reply_to,omitempty"`
+	TimeoutMs     uint32                 `protobuf:"varint,9,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	Seq           uint64                 `protobuf:"varint,10,opt,name=seq,proto3" json:"seq,omitempty"`                 // set by the server, as in Message
+	AckId         string                 `protobuf:"bytes,11,opt,name=ack_id,json=ackId,proto3" json:"ack_id,omitempty"` // as in Message; the Ack follows StreamEnd's delivery
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Error) Reset() {
-	*x = Error{}
-	mi := &file_internal_proto_talkers_proto_msgTypes[1]
+func (x *StreamStart) Reset() {
+	*x = StreamStart{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Error) String() string {
+func (x *StreamStart) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Error) ProtoMessage() {}
+func (*StreamStart) ProtoMessage() {}
 
-func (x *Error) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_talkers_proto_msgTypes[1]
+func (x *StreamStart) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -97,42 +741,112 @@ func (x *Error) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Error.ProtoReflect.Descriptor instead.
-func (*Error) Descriptor() ([]byte, []int) {
-	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{1}
+// Deprecated: Use StreamStart.ProtoReflect.Descriptor instead.
+func (*StreamStart) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{11}
 }
 
-func (x *Error) GetError() string {
+func (x *StreamStart) GetStreamId() string {
 	if x != nil {
-		return x.Error
+		return x.StreamId
 	}
 	return ""
 }
 
-type Message struct {
+func (x *StreamStart) GetFromId() string {
+	if x != nil {
+		return x.FromId
+	}
+	return ""
+}
+
+func (x *StreamStart) GetToId() string {
+	if x != nil {
+		return x.ToId
+	}
+	return ""
+}
+
+func (x *StreamStart) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *StreamStart) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *StreamStart) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *StreamStart) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *StreamStart) GetReplyTo() string {
+	if x != nil {
+		return x.ReplyTo
+	}
+	return ""
+}
+
+func (x *StreamStart) GetTimeoutMs() uint32 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *StreamStart) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *StreamStart) GetAckId() string {
+	if x != nil {
+		return x.AckId
+	}
+	return ""
+}
+
+type StreamChunk struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	FromId        string                 `protobuf:"bytes,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"` // sending client's ID
-	ToId          string                 `protobuf:"bytes,2,opt,name=to_id,json=toId,proto3" json:"to_id,omitempty"`       // destination client's ID
-	Content       string                 `protobuf:"bytes,3,opt,name=content,proto3" json:"content,omitempty"`             // message body, max 250,000 characters
+	StreamId      string                 `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	Content       string                 `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"` // next piece of the message body
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`       // next piece of the binary payload
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Message) Reset() {
-	*x = Message{}
-	mi := &file_internal_proto_talkers_proto_msgTypes[2]
+func (x *StreamChunk) Reset() {
+	*x = StreamChunk{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Message) String() string {
+func (x *StreamChunk) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Message) ProtoMessage() {}
+func (*StreamChunk) ProtoMessage() {}
 
-func (x *Message) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_talkers_proto_msgTypes[2]
+func (x *StreamChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -143,28 +857,72 @@ func (x *Message) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Message.ProtoReflect.Descriptor instead.
-func (*Message) Descriptor() ([]byte, []int) {
-	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{2}
+// Deprecated: Use StreamChunk.ProtoReflect.Descriptor instead.
+func (*StreamChunk) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{12}
 }
 
-func (x *Message) GetFromId() string {
+func (x *StreamChunk) GetStreamId() string {
 	if x != nil {
-		return x.FromId
+		return x.StreamId
 	}
 	return ""
 }
 
-func (x *Message) GetToId() string {
+func (x *StreamChunk) GetContent() string {
 	if x != nil {
-		return x.ToId
+		return x.Content
 	}
 	return ""
 }
 
-func (x *Message) GetContent() string {
+func (x *StreamChunk) GetData() []byte {
 	if x != nil {
-		return x.Content
+		return x.Data
+	}
+	return nil
+}
+
+type StreamEnd struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreamId      string                 `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamEnd) Reset() {
+	*x = StreamEnd{}
+	mi := &file_internal_proto_talkers_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamEnd) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamEnd) ProtoMessage() {}
+
+func (x *StreamEnd) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_talkers_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamEnd.ProtoReflect.Descriptor instead.
+func (*StreamEnd) Descriptor() ([]byte, []int) {
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *StreamEnd) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
 	}
 	return ""
 }
@@ -176,6 +934,17 @@ type Envelope struct {
 	//	*Envelope_Register
 	//	*Envelope_Error
 	//	*Envelope_Message
+	//	*Envelope_StreamStart
+	//	*Envelope_StreamChunk
+	//	*Envelope_StreamEnd
+	//	*Envelope_Registered
+	//	*Envelope_Turn
+	//	*Envelope_Ping
+	//	*Envelope_Pong
+	//	*Envelope_Presence
+	//	*Envelope_Ack
+	//	*Envelope_RosterRequest
+	//	*Envelope_Roster
 	Payload       isEnvelope_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -183,7 +952,7 @@ type Envelope struct {
 
 func (x *Envelope) Reset() {
 	*x = Envelope{}
-	mi := &file_internal_proto_talkers_proto_msgTypes[3]
+	mi := &file_internal_proto_talkers_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -195,7 +964,7 @@ func (x *Envelope) String() string {
 func (*Envelope) ProtoMessage() {}
 
 func (x *Envelope) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_talkers_proto_msgTypes[3]
+	mi := &file_internal_proto_talkers_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -208,7 +977,7 @@ func (x *Envelope) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Envelope.ProtoReflect.Descriptor instead.
 func (*Envelope) Descriptor() ([]byte, []int) {
-	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{3}
+	return file_internal_proto_talkers_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *Envelope) GetPayload() isEnvelope_Payload {
@@ -245,6 +1014,105 @@ func (x *Envelope) GetMessage() *Message {
 	return nil
 }
 
+func (x *Envelope) GetStreamStart() *StreamStart {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_StreamStart); ok {
+			return x.StreamStart
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetStreamChunk() *StreamChunk {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_StreamChunk); ok {
+			return x.StreamChunk
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetStreamEnd() *StreamEnd {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_StreamEnd); ok {
+			return x.StreamEnd
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetRegistered() *Registered {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Registered); ok {
+			return x.Registered
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetTurn() *Turn {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Turn); ok {
+			return x.Turn
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetPing() *Ping {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Ping); ok {
+			return x.Ping
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetPong() *Pong {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Pong); ok {
+			return x.Pong
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetPresence() *Presence {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Presence); ok {
+			return x.Presence
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetAck() *Ack {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetRosterRequest() *RosterRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_RosterRequest); ok {
+			return x.RosterRequest
+		}
+	}
+	return nil
+}
+
+func (x *Envelope) GetRoster() *Roster {
+	if x != nil {
+		if x, ok := x.Payload.(*Envelope_Roster); ok {
+			return x.Roster
+		}
+	}
+	return nil
+}
+
 type isEnvelope_Payload interface {
 	isEnvelope_Payload()
 }
@@ -261,29 +1129,177 @@ type Envelope_Message struct {
 	Message *Message `protobuf:"bytes,3,opt,name=message,proto3,oneof"`
 }
 
+type Envelope_StreamStart struct {
+	StreamStart *StreamStart `protobuf:"bytes,4,opt,name=stream_start,json=streamStart,proto3,oneof"`
+}
+
+type Envelope_StreamChunk struct {
+	StreamChunk *StreamChunk `protobuf:"bytes,5,opt,name=stream_chunk,json=streamChunk,proto3,oneof"`
+}
+
+type Envelope_StreamEnd struct {
+	StreamEnd *StreamEnd `protobuf:"bytes,6,opt,name=stream_end,json=streamEnd,proto3,oneof"`
+}
+
+type Envelope_Registered struct {
+	Registered *Registered `protobuf:"bytes,7,opt,name=registered,proto3,oneof"`
+}
+
+type Envelope_Turn struct {
+	Turn *Turn `protobuf:"bytes,8,opt,name=turn,proto3,oneof"`
+}
+
+type Envelope_Ping struct {
+	Ping *Ping `protobuf:"bytes,9,opt,name=ping,proto3,oneof"`
+}
+
+type Envelope_Pong struct {
+	Pong *Pong `protobuf:"bytes,10,opt,name=pong,proto3,oneof"`
+}
+
+type Envelope_Presence struct {
+	Presence *Presence `protobuf:"bytes,11,opt,name=presence,proto3,oneof"`
+}
+
+type Envelope_Ack struct {
+	Ack *Ack `protobuf:"bytes,12,opt,name=ack,proto3,oneof"`
+}
+
+type Envelope_RosterRequest struct {
+	RosterRequest *RosterRequest `protobuf:"bytes,13,opt,name=roster_request,json=rosterRequest,proto3,oneof"`
+}
+
+type Envelope_Roster struct {
+	Roster *Roster `protobuf:"bytes,14,opt,name=roster,proto3,oneof"`
+}
+
 func (*Envelope_Register) isEnvelope_Payload() {}
 
 func (*Envelope_Error) isEnvelope_Payload() {}
 
 func (*Envelope_Message) isEnvelope_Payload() {}
 
+func (*Envelope_StreamStart) isEnvelope_Payload() {}
+
+func (*Envelope_StreamChunk) isEnvelope_Payload() {}
+
+func (*Envelope_StreamEnd) isEnvelope_Payload() {}
+
+func (*Envelope_Registered) isEnvelope_Payload() {}
+
+func (*Envelope_Turn) isEnvelope_Payload() {}
+
+func (*Envelope_Ping) isEnvelope_Payload() {}
+
+func (*Envelope_Pong) isEnvelope_Payload() {}
+
+func (*Envelope_Presence) isEnvelope_Payload() {}
+
+func (*Envelope_Ack) isEnvelope_Payload() {}
+
+func (*Envelope_RosterRequest) isEnvelope_Payload() {}
+
+func (*Envelope_Roster) isEnvelope_Payload() {}
+
 var File_internal_proto_talkers_proto protoreflect.FileDescriptor
 
 const file_internal_proto_talkers_proto_rawDesc = "" +
 	"\n" +
-	"\x1cinternal/proto/talkers.proto\x12\atalkers\"\x1e\n" +
+	"\x1cinternal/proto/talkers.proto\x12\atalkers\"@\n" +
 	"\bRegister\x12\x12\n" +
-	"\x04from\x18\x01 \x01(\tR\x04from\"\x1d\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12 \n" +
+	"\vcompression\x18\x02 \x03(\tR\vcompression\"e\n" +
+	"\n" +
+	"Registered\x12 \n" +
+	"\vcompression\x18\x01 \x01(\tR\vcompression\x12!\n" +
+	"\x04turn\x18\x02 \x01(\v2\r.talkers.TurnR\x04turn\x12\x12\n" +
+	"\x04room\x18\x03 \x01(\tR\x04room\"h\n" +
+	"\x04Turn\x12\x16\n" +
+	"\x06holder\x18\x01 \x01(\tR\x06holder\x12\x12\n" +
+	"\x04mode\x18\x02 \x01(\tR\x04mode\x12\x16\n" +
+	"\x06number\x18\x03 \x01(\x04R\x06number\x12\x1c\n" +
+	"\tmoderator\x18\x04 \x01(\tR\tmoderator\"S\n" +
 	"\x05Error\x12\x14\n" +
-	"\x05error\x18\x01 \x01(\tR\x05error\"Q\n" +
+	"\x05error\x18\x01 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x02 \x01(\tR\trequestId\x12\x15\n" +
+	"\x06ack_id\x18\x03 \x01(\tR\x05ackId\"\x16\n" +
+	"\x04Ping\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x16\n" +
+	"\x04Pong\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"?\n" +
+	"\bPresence\x12\x1b\n" +
+	"\tclient_id\x18\x01 \x01(\tR\bclientId\x12\x16\n" +
+	"\x06online\x18\x02 \x01(\bR\x06online\"\x1c\n" +
+	"\x03Ack\x12\x15\n" +
+	"\x06ack_id\x18\x01 \x01(\tR\x05ackId\"\x1f\n" +
+	"\rRosterRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"2\n" +
+	"\x06Roster\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aclients\x18\x02 \x03(\tR\aclients\"\x9f\x03\n" +
 	"\aMessage\x12\x17\n" +
 	"\afrom_id\x18\x01 \x01(\tR\x06fromId\x12\x13\n" +
 	"\x05to_id\x18\x02 \x01(\tR\x04toId\x12\x18\n" +
-	"\acontent\x18\x03 \x01(\tR\acontent\"\x9c\x01\n" +
+	"\acontent\x18\x03 \x01(\tR\acontent\x12!\n" +
+	"\fcontent_type\x18\x04 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\fR\x04data\x12\x1a\n" +
+	"\bfilename\x18\x06 \x01(\tR\bfilename\x12:\n" +
+	"\bmetadata\x18\a \x03(\v2\x1e.talkers.Message.MetadataEntryR\bmetadata\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\b \x01(\tR\trequestId\x12\x19\n" +
+	"\breply_to\x18\t \x01(\tR\areplyTo\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\n" +
+	" \x01(\rR\ttimeoutMs\x12\x10\n" +
+	"\x03seq\x18\v \x01(\x04R\x03seq\x12\x15\n" +
+	"\x06ack_id\x18\f \x01(\tR\x05ackId\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x96\x03\n" +
+	"\vStreamStart\x12\x1b\n" +
+	"\tstream_id\x18\x01 \x01(\tR\bstreamId\x12\x17\n" +
+	"\afrom_id\x18\x02 \x01(\tR\x06fromId\x12\x13\n" +
+	"\x05to_id\x18\x03 \x01(\tR\x04toId\x12!\n" +
+	"\fcontent_type\x18\x04 \x01(\tR\vcontentType\x12\x1a\n" +
+	"\bfilename\x18\x05 \x01(\tR\bfilename\x12>\n" +
+	"\bmetadata\x18\x06 \x03(\v2\".talkers.StreamStart.MetadataEntryR\bmetadata\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\a \x01(\tR\trequestId\x12\x19\n" +
+	"\breply_to\x18\b \x01(\tR\areplyTo\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\t \x01(\rR\ttimeoutMs\x12\x10\n" +
+	"\x03seq\x18\n" +
+	" \x01(\x04R\x03seq\x12\x15\n" +
+	"\x06ack_id\x18\v \x01(\tR\x05ackId\x1a;\n" +
+	"\rMetadataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"X\n" +
+	"\vStreamChunk\x12\x1b\n" +
+	"\tstream_id\x18\x01 \x01(\tR\bstreamId\x12\x18\n" +
+	"\acontent\x18\x02 \x01(\tR\acontent\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"(\n" +
+	"\tStreamEnd\x12\x1b\n" +
+	"\tstream_id\x18\x01 \x01(\tR\bstreamId\"\xac\x05\n" +
 	"\bEnvelope\x12/\n" +
 	"\bregister\x18\x01 \x01(\v2\x11.talkers.RegisterH\x00R\bregister\x12&\n" +
 	"\x05error\x18\x02 \x01(\v2\x0e.talkers.ErrorH\x00R\x05error\x12,\n" +
-	"\amessage\x18\x03 \x01(\v2\x10.talkers.MessageH\x00R\amessageB\t\n" +
+	"\amessage\x18\x03 \x01(\v2\x10.talkers.MessageH\x00R\amessage\x129\n" +
+	"\fstream_start\x18\x04 \x01(\v2\x14.talkers.StreamStartH\x00R\vstreamStart\x129\n" +
+	"\fstream_chunk\x18\x05 \x01(\v2\x14.talkers.StreamChunkH\x00R\vstreamChunk\x123\n" +
+	"\n" +
+	"stream_end\x18\x06 \x01(\v2\x12.talkers.StreamEndH\x00R\tstreamEnd\x125\n" +
+	"\n" +
+	"registered\x18\a \x01(\v2\x13.talkers.RegisteredH\x00R\n" +
+	"registered\x12#\n" +
+	"\x04turn\x18\b \x01(\v2\r.talkers.TurnH\x00R\x04turn\x12#\n" +
+	"\x04ping\x18\t \x01(\v2\r.talkers.PingH\x00R\x04ping\x12#\n" +
+	"\x04pong\x18\n" +
+	" \x01(\v2\r.talkers.PongH\x00R\x04pong\x12/\n" +
+	"\bpresence\x18\v \x01(\v2\x11.talkers.PresenceH\x00R\bpresence\x12 \n" +
+	"\x03ack\x18\f \x01(\v2\f.talkers.AckH\x00R\x03ack\x12?\n" +
+	"\x0eroster_request\x18\r \x01(\v2\x16.talkers.RosterRequestH\x00R\rrosterRequest\x12)\n" +
+	"\x06roster\x18\x0e \x01(\v2\x0f.talkers.RosterH\x00R\x06rosterB\t\n" +
 	"\apayloadB\x10Z\x0einternal/protob\x06proto3"
 
 var (
@@ -298,22 +1314,49 @@ func file_internal_proto_talkers_proto_rawDescGZIP() []byte {
 	return file_internal_proto_talkers_proto_rawDescData
 }
 
-var file_internal_proto_talkers_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_internal_proto_talkers_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_internal_proto_talkers_proto_goTypes = []any{
-	(*Register)(nil), // 0: talkers.Register
-	(*Error)(nil),    // 1: talkers.Error
-	(*Message)(nil),  // 2: talkers.Message
-	(*Envelope)(nil), // 3: talkers.Envelope
+	(*Register)(nil),      // 0: talkers.Register
+	(*Registered)(nil),    // 1: talkers.Registered
+	(*Turn)(nil),          // 2: talkers.Turn
+	(*Error)(nil),         // 3: talkers.Error
+	(*Ping)(nil),          // 4: talkers.Ping
+	(*Pong)(nil),          // 5: talkers.Pong
+	(*Presence)(nil),      // 6: talkers.Presence
+	(*Ack)(nil),           // 7: talkers.Ack
+	(*RosterRequest)(nil), // 8: talkers.RosterRequest
+	(*Roster)(nil),        // 9: talkers.Roster
+	(*Message)(nil),       // 10: talkers.Message
+	(*StreamStart)(nil),   // 11: talkers.StreamStart
+	(*StreamChunk)(nil),   // 12: talkers.StreamChunk
+	(*StreamEnd)(nil),     // 13: talkers.StreamEnd
+	(*Envelope)(nil),      // 14: talkers.Envelope
+	nil,                   // 15: talkers.Message.MetadataEntry
+	nil,                   // 16: talkers.StreamStart.MetadataEntry
 }
 var file_internal_proto_talkers_proto_depIdxs = []int32{
-	0, // 0: talkers.Envelope.register:type_name -> talkers.Register
-	1, // 1: talkers.Envelope.error:type_name -> talkers.Error
-	2, // 2: talkers.Envelope.message:type_name -> talkers.Message
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	2,  // 0: talkers.Registered.turn:type_name -> talkers.Turn
+	15, // 1: talkers.Message.metadata:type_name -> talkers.Message.MetadataEntry
+	16, // 2: talkers.StreamStart.metadata:type_name -> talkers.StreamStart.MetadataEntry
+	0,  // 3: talkers.Envelope.register:type_name -> talkers.Register
+	3,  // 4: talkers.Envelope.error:type_name -> talkers.Error
+	10, // 5: talkers.Envelope.message:type_name -> talkers.Message
+	11, // 6: talkers.Envelope.stream_start:type_name -> talkers.StreamStart
+	12, // 7: talkers.Envelope.stream_chunk:type_name -> talkers.StreamChunk
+	13, // 8: talkers.Envelope.stream_end:type_name -> talkers.StreamEnd
+	1,  // 9: talkers.Envelope.registered:type_name -> talkers.Registered
+	2,  // 10: talkers.Envelope.turn:type_name -> talkers.Turn
+	4,  // 11: talkers.Envelope.ping:type_name -> talkers.Ping
+	5,  // 12: talkers.Envelope.pong:type_name -> talkers.Pong
+	6,  // 13: talkers.Envelope.presence:type_name -> talkers.Presence
+	7,  // 14: talkers.Envelope.ack:type_name -> talkers.Ack
+	8,  // 15: talkers.Envelope.roster_request:type_name -> talkers.RosterRequest
+	9,  // 16: talkers.Envelope.roster:type_name -> talkers.Roster
+	17, // [17:17] is the sub-list for method output_type
+	17, // [17:17] is the sub-list for method input_type
+	17, // [17:17] is the sub-list for extension type_name
+	17, // [17:17] is the sub-list for extension extendee
+	0,  // [0:17] is the sub-list for field type_name
 }
 
 func init() { file_internal_proto_talkers_proto_init() }
@@ -321,10 +1364,21 @@ func file_internal_proto_talkers_proto_init() {
 	if File_internal_proto_talkers_proto != nil {
 		return
 	}
-	file_internal_proto_talkers_proto_msgTypes[3].OneofWrappers = []any{
+	file_internal_proto_talkers_proto_msgTypes[14].OneofWrappers = []any{
 		(*Envelope_Register)(nil),
 		(*Envelope_Error)(nil),
 		(*Envelope_Message)(nil),
+		(*Envelope_StreamStart)(nil),
+		(*Envelope_StreamChunk)(nil),
+		(*Envelope_StreamEnd)(nil),
+		(*Envelope_Registered)(nil),
+		(*Envelope_Turn)(nil),
+		(*Envelope_Ping)(nil),
+		(*Envelope_Pong)(nil),
+		(*Envelope_Presence)(nil),
+		(*Envelope_Ack)(nil),
+		(*Envelope_RosterRequest)(nil),
+		(*Envelope_Roster)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -332,7 +1386,7 @@ func file_internal_proto_talkers_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_proto_talkers_proto_rawDesc), len(file_internal_proto_talkers_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   4,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,194 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/server"
+)
+
+// pollInterval is how often Run checks the stop conditions
+const pollInterval = 50 * time.Millisecond
+
+// RunOptions let the caller of Run follow it. Any field may be nil.
+type RunOptions struct {
+	// Logf reports warnings and errors, prefixed with the agent ID (default log.Printf).
+	Logf func(format string, args ...any)
+
+	// OnEntry is called with each message as it is added to the transcript.
+	OnEntry func(Entry)
+}
+
+// Run starts the scenario's server, if embedded, and its agents, sends the opening
+// message, and runs until a stop condition is met or ctx ends. The transcript is
+// returned with the reason the run ended; it is partial if an error is returned
+// after the agents started.
+func Run(ctx context.Context, s *Scenario, opts *RunOptions) (*Transcript, error) {
+	var o RunOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Logf == nil {
+		o.Logf = log.Printf
+	}
+
+	addr := s.Server
+	if addr == "" {
+		listen := s.Listen
+		if len(listen) == 0 {
+			listen = []string{"mem://"}
+		}
+		floor, err := s.Floor.config()
+		if err != nil {
+			return nil, err
+		}
+		srv := server.New(server.Config{Addrs: listen, Floor: floor})
+		if err := srv.Start(); err != nil {
+			return nil, err
+		}
+		defer srv.Stop()
+		addr = srv.Addr()
+	}
+
+	t := newTranscript(s.Name, s.Stop.MaxMessages)
+	record := func(from, to, text string) {
+		if e, ok := t.add(from, to, text); ok && o.OnEntry != nil {
+			o.OnEntry(e)
+		}
+	}
+
+	// Agents stop answering when the run ends
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	agents := make(map[string]*agent.Agent, len(s.Agents))
+	defer func() {
+		cancel()
+		for _, a := range agents {
+			_ = a.Close()
+		}
+	}()
+
+	for _, p := range s.Agents {
+		if p.Server == "" {
+			p.Server = addr
+		}
+		id := p.ID
+		a, err := agent.New(p, agent.Hooks{
+			// Messages between the scenario's agents are recorded once, on receipt
+			OnMessage: func(msg *client.Message) { record(msg.From, id, agent.ContextText(msg)) },
+			OnReply: func(peer, reply string) {
+				if _, ok := agents[peer]; !ok {
+					record(id, peer, reply)
+				} else {
+					// Keep the run from going idle before the peer receives the reply
+					t.touch()
+				}
+			},
+			Logf: func(format string, args ...any) { o.Logf("%s: "+format, append([]any{id}, args...)...) },
+		})
+		if err != nil {
+			return nil, fmt.Errorf("agent %s: %w", id, err)
+		}
+		agents[id] = a
+	}
+	for _, a := range agents {
+		if err := a.Start(runCtx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sendOpening(runCtx, s, addr, agents, record); err != nil {
+		t.Reason, t.Ended = "failed to start", time.Now()
+		return t, err
+	}
+
+	t.Reason = wait(ctx, s.Stop, t, agents)
+	t.Ended = time.Now()
+	return t, nil
+}
+
+// sendOpening sends the opening message from its agent, or from a plain client
+// connected for it
+func sendOpening(ctx context.Context, s *Scenario, addr string, agents map[string]*agent.Agent, record func(from, to, text string)) error {
+	m := s.Opening
+	if a, ok := agents[m.From]; ok {
+		if err := a.Send(ctx, m.To, m.Text); err != nil {
+			return fmt.Errorf("failed to send the opening message: %w", err)
+		}
+	} else {
+		c, err := client.Dial(ctx, addr, m.From, nil)
+		if err != nil {
+			return fmt.Errorf("failed to connect %s: %w", m.From, err)
+		}
+		if err = c.WaitTurn(ctx); err == nil {
+			err = c.Send(ctx, m.To, m.Text)
+		}
+		if err != nil {
+			_ = c.Close()
+			return fmt.Errorf("failed to send the opening message: %w", err)
+		}
+		// Stay connected so replies to the sender can be delivered
+		go func() {
+			<-ctx.Done()
+			_ = c.Close()
+		}()
+		go func() {
+			for range c.Messages() {
+				// Replies are recorded by the agents that send them
+			}
+		}()
+	}
+
+	// A message to one of the agents is recorded when it arrives
+	if _, ok := agents[m.To]; !ok {
+		record(m.From, m.To, m.Text)
+	}
+	return nil
+}
+
+// wait returns once a stop condition is met or ctx ends, with the reason
+func wait(ctx context.Context, stop Stop, t *Transcript, agents map[string]*agent.Agent) string {
+	if stop.Timeout == 0 && stop.Idle == 0 && stop.MaxMessages == 0 {
+		stop.Idle = DefaultIdle
+	}
+
+	var deadline <-chan time.Time
+	if stop.Timeout > 0 {
+		timer := time.NewTimer(stop.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "interrupted"
+		case <-deadline:
+			return fmt.Sprintf("timed out after %v", stop.Timeout)
+		case <-t.full:
+			return fmt.Sprintf("reached %d messages", stop.MaxMessages)
+		case <-ticker.C:
+		}
+
+		if stop.Idle > 0 && t.since() >= stop.Idle && !busy(agents) {
+			return fmt.Sprintf("idle for %v", stop.Idle)
+		}
+	}
+}
+
+// busy reports whether any agent is handling a message
+func busy(agents map[string]*agent.Agent) bool {
+	for _, a := range agents {
+		if a.Busy() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+// Package scenario runs scripted multi-agent experiments: several agents started in
+// one process against an embedded or remote server, a seed message to open the
+// conversation, and stop conditions that end the run and close its transcript.
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dmh2000/talkers/internal/profile"
+	"github.com/dmh2000/talkers/server"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultIdle is how long a run may go without messages before it ends, when a
+// scenario sets no stop condition of its own.
+const DefaultIdle = 30 * time.Second
+
+// Scenario describes one run.
+type Scenario struct {
+	Name string
+
+	// Server is the address of a remote server. If empty, an embedded server is
+	// started on Listen, or in memory if Listen is empty.
+	Server string
+	Listen []string
+
+	// Floor is the floor control of the embedded server.
+	Floor Floor
+
+	// Agents are the profiles of the agents to start. An agent without a server
+	// uses the scenario's.
+	Agents []profile.Profile
+
+	Opening Opening
+	Stop    Stop
+
+	// Transcript is the file the transcript is written to, if any.
+	Transcript string
+}
+
+// Opening is the seed message that starts the conversation. If From is not one of
+// the scenario's agents, a plain client with that ID is connected to send it.
+type Opening struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	Text string `yaml:"text"`
+}
+
+// Floor selects floor control on an embedded server: round-robin or token turns.
+// Moderated turns need a moderator to grant them, which a scenario does not have.
+type Floor struct {
+	Mode        string        `yaml:"mode"`
+	TurnTimeout time.Duration `yaml:"turn_timeout"`
+}
+
+// config returns the server configuration for f
+func (f Floor) config() (server.FloorConfig, error) {
+	mode, err := server.ParseFloorMode(f.Mode)
+	if err != nil {
+		return server.FloorConfig{}, err
+	}
+	if mode == server.FloorModerated {
+		return server.FloorConfig{}, fmt.Errorf("floor mode %s needs a moderator to grant turns", mode)
+	}
+	return server.FloorConfig{Mode: mode, TurnTimeout: f.TurnTimeout}, nil
+}
+
+// Stop holds the conditions that end a run; the first one met ends it.
+type Stop struct {
+	Timeout     time.Duration `yaml:"timeout"`      // total run time
+	Idle        time.Duration `yaml:"idle"`         // time without messages while no agent is busy
+	MaxMessages int           `yaml:"max_messages"` // messages in the transcript
+}
+
+// file is the YAML form of a scenario
+type file struct {
+	Name       string      `yaml:"name"`
+	Server     string      `yaml:"server"`
+	Listen     []string    `yaml:"listen"`
+	Floor      Floor       `yaml:"floor"`
+	Agents     []yaml.Node `yaml:"agents"`
+	Opening    Opening     `yaml:"opening"`
+	Stop       Stop        `yaml:"stop"`
+	Transcript string      `yaml:"transcript"`
+}
+
+// Load reads the scenario at path. Each agent is either a profile written inline
+// or a profile file named by a profile field, whose other fields override the
+// file's. Relative paths are taken relative to the scenario's directory.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	var f file
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	s := &Scenario{
+		Name:       f.Name,
+		Server:     f.Server,
+		Listen:     f.Listen,
+		Floor:      f.Floor,
+		Opening:    f.Opening,
+		Stop:       f.Stop,
+		Transcript: f.Transcript,
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(path)
+	}
+	if s.Transcript != "" && !filepath.IsAbs(s.Transcript) {
+		s.Transcript = filepath.Join(dir, s.Transcript)
+	}
+
+	for i := range f.Agents {
+		p, err := loadAgent(&f.Agents[i], dir)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %s: agent %d: %w", path, i+1, err)
+		}
+		s.Agents = append(s.Agents, p)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// loadAgent builds the profile of one agent entry
+func loadAgent(node *yaml.Node, dir string) (profile.Profile, error) {
+	p := profile.Default()
+	if node.Kind != yaml.MappingNode {
+		return p, errors.New("expected a profile")
+	}
+
+	// Start from the profile file, if one is named
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "profile" {
+			continue
+		}
+		path := node.Content[i+1].Value
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		var err error
+		if p, err = profile.Load(path); err != nil {
+			return p, err
+		}
+		node.Content = append(node.Content[:i], node.Content[i+2:]...)
+		break
+	}
+
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return p, err
+	}
+	if err := profile.Parse(data, dir, &p); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// Validate checks that s can be run.
+func (s *Scenario) Validate() error {
+	if len(s.Agents) == 0 {
+		return errors.New("no agents")
+	}
+	if s.Server != "" && len(s.Listen) > 0 {
+		return errors.New("server and listen cannot be used together")
+	}
+	if s.Server != "" && s.Floor.Mode != "" {
+		return errors.New("floor control needs an embedded server")
+	}
+	if _, err := s.Floor.config(); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range s.Agents {
+		// The address of an embedded server is known only once it starts
+		if p.Server == "" {
+			p.Server = s.Server
+			if p.Server == "" {
+				p.Server = "embedded"
+			}
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if seen[p.ID] {
+			return fmt.Errorf("client ID %s is used by more than one agent", p.ID)
+		}
+		seen[p.ID] = true
+	}
+
+	switch {
+	case s.Opening.To == "" || s.Opening.Text == "":
+		return errors.New("the opening message needs to and text")
+	case s.Opening.From == "":
+		return errors.New("the opening message needs a sender")
+	case s.Opening.From == s.Opening.To:
+		return errors.New("the opening message is addressed to its sender")
+	case len(s.Opening.From) > profile.MaxIDLength:
+		return fmt.Errorf("opening sender %s exceeds maximum length of %d characters", s.Opening.From, profile.MaxIDLength)
+	case s.Stop.Timeout < 0 || s.Stop.Idle < 0 || s.Stop.MaxMessages < 0:
+		return errors.New("stop conditions cannot be negative")
+	}
+	return nil
+}
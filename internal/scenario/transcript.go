@@ -0,0 +1,142 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is one message of a run.
+type Entry struct {
+	Time time.Time `json:"time"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Text string    `json:"text"`
+}
+
+// Transcript is the record of a run: every message sent to or by its agents, in
+// the order they were received. Safe for concurrent use.
+type Transcript struct {
+	Scenario string
+	Started  time.Time
+	Ended    time.Time
+	Reason   string // why the run ended
+
+	limit int           // most entries kept; 0 = no limit
+	full  chan struct{} // closed when the limit is reached
+
+	mu      sync.Mutex
+	entries []Entry
+	last    time.Time // time of the last entry, or of the start
+}
+
+// newTranscript starts the transcript of the scenario named name, keeping at most
+// limit entries if limit is above zero
+func newTranscript(name string, limit int) *Transcript {
+	now := time.Now()
+	return &Transcript{Scenario: name, Started: now, last: now, limit: limit, full: make(chan struct{})}
+}
+
+// add records a message and returns its entry. It reports false, recording
+// nothing, once the transcript is full.
+func (t *Transcript) add(from, to, text string) (Entry, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.limit > 0 && len(t.entries) >= t.limit {
+		return Entry{}, false
+	}
+	e := Entry{Time: time.Now(), From: from, To: to, Text: text}
+	t.entries = append(t.entries, e)
+	t.last = e.Time
+	if len(t.entries) == t.limit {
+		close(t.full)
+	}
+	return e, true
+}
+
+// Entries returns the messages recorded so far.
+func (t *Transcript) Entries() []Entry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Entry(nil), t.entries...)
+}
+
+// Len returns the number of messages recorded so far.
+func (t *Transcript) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.entries)
+}
+
+// touch marks activity that is not a message, postponing the idle stop
+func (t *Transcript) touch() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last = time.Now()
+}
+
+// since returns the time since the last message, or since the start if none
+func (t *Transcript) since() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(t.last)
+}
+
+// String formats e as a line of a text transcript.
+func (e Entry) String() string {
+	text := strings.ReplaceAll(e.Text, "\n", "\n    ")
+	return fmt.Sprintf("[%s] %s -> %s: %s", e.Time.Format(time.TimeOnly), e.From, e.To, text)
+}
+
+// WriteText writes the transcript as text: a header, then one message per line.
+// Lines of a multi-line message after the first are indented.
+func (t *Transcript) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# %s: %s to %s, %s\n", t.Scenario,
+		t.Started.Format(time.DateTime), t.Ended.Format(time.TimeOnly), t.Reason); err != nil {
+		return err
+	}
+	for _, e := range t.Entries() {
+		if _, err := fmt.Fprintln(w, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the transcript's messages as JSON, one per line.
+func (t *Transcript) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, e := range t.Entries() {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes the transcript to path, as JSON lines if the name ends in .jsonl or
+// .json and as text otherwise.
+func (t *Transcript) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create transcript: %w", err)
+	}
+	switch filepath.Ext(path) {
+	case ".jsonl", ".json":
+		err = t.WriteJSON(f)
+	default:
+		err = t.WriteText(f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Mem connects clients and servers in the same process over net.Pipe, with no
+// sockets or TLS. Addresses are names in a process-wide table; listening on an
+// empty name picks a unique one, available from the listener's Addr.
+type Mem struct{}
+
+var (
+	memMu        sync.Mutex
+	memListeners = make(map[string]*muxListener)
+	memNext      int
+)
+
+// memAddr is the net.Addr of an in-memory endpoint
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+// Listen registers an in-memory listener under name
+func (Mem) Listen(name string, cfg *Config) (Listener, error) {
+	memMu.Lock()
+	defer memMu.Unlock()
+
+	if name == "" {
+		memNext++
+		name = "mem-" + strconv.Itoa(memNext)
+	}
+	if _, exists := memListeners[name]; exists {
+		return nil, fmt.Errorf("transport: mem address %q already in use", name)
+	}
+
+	l := &muxListener{
+		cfg:   cfg,
+		addr:  memAddr(name),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+	l.close = func() error {
+		memMu.Lock()
+		defer memMu.Unlock()
+		delete(memListeners, name)
+		return nil
+	}
+	memListeners[name] = l
+	return l, nil
+}
+
+// Dial connects to the in-memory listener registered under name
+func (Mem) Dial(ctx context.Context, name string, cfg *Config) (Conn, error) {
+	memMu.Lock()
+	l, ok := memListeners[name]
+	memMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("transport: no mem listener at %q", name)
+	}
+
+	client, server := net.Pipe()
+	go l.deliver(server)
+	return newMuxConn(client, cfg, true)
+}
@@ -0,0 +1,355 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+// Stream kinds, sent as the first byte of every multiplexed stream so the
+// accepting side can tell control streams from message streams.
+const (
+	kindBidi byte = 'B'
+	kindUni  byte = 'U'
+)
+
+// kindTimeout bounds how long an accepted stream may take to announce its kind.
+const kindTimeout = 10 * time.Second
+
+// acceptBacklog is how many streams of each kind may wait for an Accept call,
+// matching yamux's own backlog.
+const acceptBacklog = 256
+
+// muxConfig returns the yamux configuration for cfg. yamux has no idle timeout;
+// it notices a dead peer by sending keep-alive pings and closing the session
+// when one goes unanswered for ConnectionWriteTimeout. Both are kept to at most
+// half of cfg.IdleTimeout, so a peer that stops responding is dropped within
+// the idle timeout as with QUIC, while a quiet but live connection stays open.
+func muxConfig(cfg *Config) *yamux.Config {
+	mc := yamux.DefaultConfig()
+	mc.LogOutput = io.Discard
+	if cfg != nil && cfg.IdleTimeout > 0 {
+		half := cfg.IdleTimeout / 2
+		mc.KeepAliveInterval = min(mc.KeepAliveInterval, half)
+		mc.ConnectionWriteTimeout = min(mc.ConnectionWriteTimeout, half)
+	}
+	return mc
+}
+
+// newMuxConn runs a yamux session over nc. The dialing side is the yamux client.
+func newMuxConn(nc net.Conn, cfg *Config, client bool) (*muxConn, error) {
+	var sess *yamux.Session
+	var err error
+	if client {
+		sess, err = yamux.Client(nc, muxConfig(cfg))
+	} else {
+		sess, err = yamux.Server(nc, muxConfig(cfg))
+	}
+	if err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+
+	c := &muxConn{
+		sess: sess,
+		bidi: make(chan *yamux.Stream, acceptBacklog),
+		uni:  make(chan *yamux.Stream, acceptBacklog),
+	}
+	go c.acceptLoop()
+	return c, nil
+}
+
+// muxConn provides Conn semantics over a yamux session. Unidirectional streams
+// are yamux streams whose receiving side never writes.
+type muxConn struct {
+	sess *yamux.Session
+	bidi chan *yamux.Stream
+	uni  chan *yamux.Stream
+}
+
+// acceptLoop accepts yamux streams and sorts them by their kind byte. Streams
+// are dispatched one at a time so each kind is accepted in the order the peer
+// opened it, as with QUIC; open writes the kind byte at once, so this is quick.
+func (c *muxConn) acceptLoop() {
+	for {
+		s, err := c.sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		c.dispatch(s)
+	}
+}
+
+// dispatch reads the kind byte of s and hands it to the matching Accept call
+func (c *muxConn) dispatch(s *yamux.Stream) {
+	var kind [1]byte
+	_ = s.SetReadDeadline(time.Now().Add(kindTimeout))
+	if _, err := io.ReadFull(s, kind[:]); err != nil {
+		_ = s.Close()
+		return
+	}
+	_ = s.SetReadDeadline(time.Time{})
+
+	ch := c.bidi
+	switch kind[0] {
+	case kindBidi:
+	case kindUni:
+		ch = c.uni
+	default:
+		_ = s.Close()
+		return
+	}
+
+	select {
+	case ch <- s:
+	case <-c.sess.CloseChan():
+		_ = s.Close()
+	}
+}
+
+// open starts a new yamux stream and announces its kind
+func (c *muxConn) open(ctx context.Context, kind byte) (*yamux.Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s, err := c.sess.OpenStream()
+	if err != nil {
+		return nil, c.wrap(err)
+	}
+	if _, err := s.Write([]byte{kind}); err != nil {
+		_ = s.Close()
+		return nil, c.wrap(err)
+	}
+	return s, nil
+}
+
+// accept waits for the next stream of the given kind
+func (c *muxConn) accept(ctx context.Context, ch chan *yamux.Stream) (*yamux.Stream, error) {
+	select {
+	case s := <-ch:
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.sess.CloseChan():
+		return nil, ErrClosed
+	}
+}
+
+// wrap converts session shutdown errors to ErrClosed
+func (c *muxConn) wrap(err error) error {
+	if c.sess.IsClosed() {
+		return ErrClosed
+	}
+	return fmt.Errorf("transport: %w", err)
+}
+
+func (c *muxConn) OpenStream(ctx context.Context) (Stream, error) {
+	return c.open(ctx, kindBidi)
+}
+
+func (c *muxConn) AcceptStream(ctx context.Context) (Stream, error) {
+	return c.accept(ctx, c.bidi)
+}
+
+func (c *muxConn) OpenUniStream(ctx context.Context) (SendStream, error) {
+	s, err := c.open(ctx, kindUni)
+	if err != nil {
+		return nil, err
+	}
+	return &muxSendStream{s: s}, nil
+}
+
+func (c *muxConn) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
+	s, err := c.accept(ctx, c.uni)
+	if err != nil {
+		return nil, err
+	}
+	return &muxReceiveStream{s: s}, nil
+}
+
+func (c *muxConn) RemoteAddr() net.Addr { return c.sess.RemoteAddr() }
+
+// Close shuts down the session. yamux has no close reason, so reason is dropped.
+func (c *muxConn) Close(reason string) error {
+	return c.sess.Close()
+}
+
+// Unidirectional mux streams carry their data as records, each a 4-byte
+// big-endian length followed by that many bytes. yamux cannot reset a stream,
+// so the sender ends it with a record marking how: recordEnd for Close and
+// recordCancel for Cancel. A stream that ends without either was cut off.
+const (
+	recordEnd    uint32 = 0
+	recordCancel uint32 = math.MaxUint32
+
+	// maxRecord bounds the data in one record
+	maxRecord = 1 << 20
+)
+
+// muxSendStream is the writing end of a unidirectional mux stream
+type muxSendStream struct {
+	s      *yamux.Stream
+	buf    []byte
+	closed bool
+}
+
+// Write sends p as one or more records
+func (w *muxSendStream) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, ErrClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), maxRecord)
+		w.buf = binary.BigEndian.AppendUint32(w.buf[:0], uint32(n))
+		w.buf = append(w.buf, p[:n]...)
+		if _, err := w.s.Write(w.buf); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close finishes the stream normally
+func (w *muxSendStream) Close() error {
+	return w.finish(recordEnd)
+}
+
+// Cancel abandons the stream; the receiver's next Read fails with ErrStreamCanceled
+func (w *muxSendStream) Cancel() {
+	_ = w.finish(recordCancel)
+}
+
+// finish writes the closing record and closes the yamux stream
+func (w *muxSendStream) finish(record uint32) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	_, err := w.s.Write(binary.BigEndian.AppendUint32(nil, record))
+	if closeErr := w.s.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// muxReceiveStream is the reading end of a unidirectional mux stream
+type muxReceiveStream struct {
+	s *yamux.Stream
+
+	// header collects the length of the next record, which may arrive in pieces
+	header  [4]byte
+	headerN int
+
+	// remaining is the unread data in the current record
+	remaining uint32
+
+	// err is returned once the stream has ended
+	err error
+}
+
+// Read returns data from the stream's records, io.EOF once the sender closed
+// it, and ErrStreamCanceled if the sender cancelled it or it was cut off.
+func (r *muxReceiveStream) Read(p []byte) (int, error) {
+	for r.remaining == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		n, err := r.s.Read(r.header[r.headerN:])
+		r.headerN += n
+		if r.headerN == len(r.header) {
+			r.headerN = 0
+			switch length := binary.BigEndian.Uint32(r.header[:]); length {
+			case recordEnd:
+				r.err = io.EOF
+			case recordCancel:
+				r.err = ErrStreamCanceled
+			default:
+				r.remaining = length
+			}
+			continue
+		}
+		if err != nil {
+			return 0, r.interrupted(err)
+		}
+	}
+
+	if uint32(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.s.Read(p)
+	r.remaining -= uint32(n)
+	if err != nil && n == 0 {
+		return 0, r.interrupted(err)
+	}
+	return n, nil
+}
+
+// interrupted records the end of a stream cut off by err; other errors, such
+// as a read deadline, are returned as they are
+func (r *muxReceiveStream) interrupted(err error) error {
+	if errors.Is(err, io.EOF) {
+		r.err = ErrStreamCanceled
+		return r.err
+	}
+	return err
+}
+
+func (r *muxReceiveStream) SetReadDeadline(t time.Time) error {
+	return r.s.SetReadDeadline(t)
+}
+
+// Cancel stops reading. yamux cannot tell the sender, whose writes are discarded.
+func (r *muxReceiveStream) Cancel() {
+	_ = r.s.Close()
+}
+
+// muxListener turns accepted net.Conns into multiplexed Conns
+type muxListener struct {
+	cfg   *Config
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	close func() error
+}
+
+func (l *muxListener) Accept(ctx context.Context) (Conn, error) {
+	select {
+	case nc := <-l.conns:
+		return newMuxConn(nc, l.cfg, false)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, ErrClosed
+	}
+}
+
+func (l *muxListener) Addr() net.Addr { return l.addr }
+
+func (l *muxListener) Close() error {
+	select {
+	case <-l.done:
+		return nil
+	default:
+		close(l.done)
+	}
+	return l.close()
+}
+
+// deliver hands an incoming net.Conn to Accept, closing it if the listener is closed
+func (l *muxListener) deliver(nc net.Conn) {
+	select {
+	case l.conns <- nc:
+	case <-l.done:
+		_ = nc.Close()
+	}
+}
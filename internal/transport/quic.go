@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"context"
+	"net"
+
+	"github.com/quic-go/quic-go"
+)
+
+// QUIC is the native transport: streams map directly onto QUIC streams.
+type QUIC struct{}
+
+// quicConfig builds the quic-go configuration for cfg
+func quicConfig(cfg *Config) *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout: cfg.IdleTimeout,
+	}
+}
+
+// Listen starts a QUIC listener on addr
+func (QUIC) Listen(addr string, cfg *Config) (Listener, error) {
+	l, err := quic.ListenAddr(addr, cfg.TLS, quicConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return &quicListener{l: l}, nil
+}
+
+// Dial opens a QUIC connection to addr
+func (QUIC) Dial(ctx context.Context, addr string, cfg *Config) (Conn, error) {
+	conn, err := quic.DialAddr(ctx, addr, cfg.TLS, quicConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	return &quicConn{conn: conn}, nil
+}
+
+type quicListener struct {
+	l *quic.Listener
+}
+
+func (l *quicListener) Accept(ctx context.Context) (Conn, error) {
+	conn, err := l.l.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &quicConn{conn: conn}, nil
+}
+
+func (l *quicListener) Addr() net.Addr { return l.l.Addr() }
+func (l *quicListener) Close() error   { return l.l.Close() }
+
+type quicConn struct {
+	conn *quic.Conn
+}
+
+func (c *quicConn) OpenStream(ctx context.Context) (Stream, error) {
+	return c.conn.OpenStreamSync(ctx)
+}
+
+func (c *quicConn) AcceptStream(ctx context.Context) (Stream, error) {
+	return c.conn.AcceptStream(ctx)
+}
+
+func (c *quicConn) OpenUniStream(ctx context.Context) (SendStream, error) {
+	s, err := c.conn.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicSendStream{s}, nil
+}
+
+func (c *quicConn) AcceptUniStream(ctx context.Context) (ReceiveStream, error) {
+	s, err := c.conn.AcceptUniStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicReceiveStream{s}, nil
+}
+
+func (c *quicConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+func (c *quicConn) Close(reason string) error {
+	return c.conn.CloseWithError(0, reason)
+}
+
+type quicSendStream struct {
+	*quic.SendStream
+}
+
+func (s quicSendStream) Cancel() { s.CancelWrite(0) }
+
+type quicReceiveStream struct {
+	*quic.ReceiveStream
+}
+
+func (s quicReceiveStream) Cancel() { s.CancelRead(0) }
@@ -0,0 +1,47 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// TCP carries connections over TLS on TCP for networks that block UDP.
+// Streams are multiplexed over the single TLS connection.
+type TCP struct{}
+
+// Listen starts a TLS listener on addr
+func (TCP) Listen(addr string, cfg *Config) (Listener, error) {
+	nl, err := tls.Listen("tcp", addr, cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &muxListener{
+		cfg:   cfg,
+		addr:  nl.Addr(),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+		close: nl.Close,
+	}
+	go func() {
+		for {
+			nc, err := nl.Accept()
+			if err != nil {
+				return
+			}
+			go l.deliver(nc)
+		}
+	}()
+	return l, nil
+}
+
+// Dial opens a TLS connection to addr
+func (TCP) Dial(ctx context.Context, addr string, cfg *Config) (Conn, error) {
+	d := &tls.Dialer{Config: cfg.TLS}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newMuxConn(nc, cfg, true)
+}
@@ -0,0 +1,145 @@
+// Package transport abstracts the connection layer used between clients and the
+// server. A connection carries one bidirectional control stream and any number
+// of unidirectional message streams; QUIC provides these natively, while the TCP
+// and WebSocket transports multiplex them over a single byte stream. The mem
+// transport does the same over an in-process pipe for tests and embedding.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Accept and Open calls once a connection or listener is closed.
+var ErrClosed = errors.New("transport: connection closed")
+
+// ErrStreamCanceled is returned by Read on a multiplexed unidirectional stream
+// that the sender cancelled, or that ended without being closed. QUIC streams
+// report a cancelled stream with quic-go's own StreamError instead.
+var ErrStreamCanceled = errors.New("transport: stream canceled by peer")
+
+// Stream is a bidirectional stream. Close ends the write side.
+type Stream interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+}
+
+// SendStream is the writing end of a unidirectional stream.
+// Close finishes the stream normally; Cancel abandons it so the peer sees it interrupted.
+type SendStream interface {
+	io.WriteCloser
+	Cancel()
+}
+
+// ReceiveStream is the reading end of a unidirectional stream.
+// Cancel tells the peer no more data will be read.
+type ReceiveStream interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+	Cancel()
+}
+
+// Conn is an established connection between a client and the server.
+type Conn interface {
+	OpenStream(ctx context.Context) (Stream, error)
+	AcceptStream(ctx context.Context) (Stream, error)
+	OpenUniStream(ctx context.Context) (SendStream, error)
+	AcceptUniStream(ctx context.Context) (ReceiveStream, error)
+	RemoteAddr() net.Addr
+	Close(reason string) error
+}
+
+// Listener accepts incoming connections.
+type Listener interface {
+	Accept(ctx context.Context) (Conn, error)
+	Addr() net.Addr
+	Close() error
+}
+
+// Config holds settings shared by all transports.
+type Config struct {
+	TLS         *tls.Config   // server certificate, or client verification settings
+	IdleTimeout time.Duration // close connections idle for this long (0 = transport default)
+}
+
+// Transport listens for and dials connections of one kind. The address passed
+// to Listen and Dial has the scheme already removed.
+type Transport interface {
+	Listen(addr string, cfg *Config) (Listener, error)
+	Dial(ctx context.Context, addr string, cfg *Config) (Conn, error)
+}
+
+// DefaultScheme is used for addresses given without a scheme.
+const DefaultScheme = "quic"
+
+var (
+	// transportsMu guards transports, which maps schemes to their transports
+	transportsMu sync.RWMutex
+	transports   = map[string]Transport{
+		"quic": QUIC{},
+		"tcp":  TCP{},
+		"ws":   WebSocket{},
+		"wss":  WebSocket{TLS: true},
+		"mem":  Mem{},
+	}
+)
+
+// Register makes a transport available under scheme, replacing any existing one.
+func Register(scheme string, t Transport) {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	transports[scheme] = t
+}
+
+// Schemes returns the registered scheme names.
+func Schemes() []string {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+	names := make([]string, 0, len(transports))
+	for name := range transports {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Resolve splits an address of the form [scheme://]rest and returns the transport
+// for its scheme along with rest. Addresses without a scheme use DefaultScheme.
+func Resolve(addr string) (Transport, string, error) {
+	scheme, rest, found := strings.Cut(addr, "://")
+	if !found {
+		scheme, rest = DefaultScheme, addr
+	}
+
+	transportsMu.RLock()
+	t, ok := transports[scheme]
+	transportsMu.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unknown transport %q in address %q", scheme, addr)
+	}
+	return t, rest, nil
+}
+
+// Listen listens on addr using the transport named by its scheme.
+func Listen(addr string, cfg *Config) (Listener, error) {
+	t, rest, err := Resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.Listen(rest, cfg)
+}
+
+// Dial connects to addr using the transport named by its scheme.
+func Dial(ctx context.Context, addr string, cfg *Config) (Conn, error) {
+	t, rest, err := Resolve(addr)
+	if err != nil {
+		return nil, err
+	}
+	return t.Dial(ctx, rest, cfg)
+}
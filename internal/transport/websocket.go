@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/coder/websocket"
+)
+
+// DefaultWebSocketPath is used when a WebSocket address has no path.
+const DefaultWebSocketPath = "/talkers"
+
+// maxWebSocketMessage bounds a single WebSocket message. The multiplexer never
+// writes more than its stream window (256 KB) plus a header at once.
+const maxWebSocketMessage = 1 << 20
+
+// WebSocket carries connections over a WebSocket, for networks that only pass
+// HTTP(S). Addresses have the form host:port[/path]. With TLS set (the "wss"
+// scheme) the server uses the configured certificate; otherwise the WebSocket
+// runs in the clear and is expected to sit behind a TLS-terminating proxy, and a
+// warning is logged unless it is on the loopback interface.
+type WebSocket struct {
+	TLS bool
+}
+
+// splitPath separates host:port from an optional /path
+func splitPath(addr string) (string, string) {
+	host, path, found := strings.Cut(addr, "/")
+	if !found || path == "" {
+		return host, DefaultWebSocketPath
+	}
+	return host, "/" + path
+}
+
+// warnCleartext logs a warning when a WebSocket without TLS is used with a host
+// other than the loopback interface, where anyone on the path can read the traffic
+func warnCleartext(hostport string) {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		return
+	}
+	log.Printf("Warning: ws://%s sends messages unencrypted; use wss:// unless a TLS-terminating proxy sits in front of it", hostport)
+}
+
+// httpTLS returns a copy of c for use with HTTP, which negotiates its own ALPN protocol
+func httpTLS(c *tls.Config) *tls.Config {
+	c = c.Clone()
+	c.NextProtos = []string{"http/1.1"}
+	return c
+}
+
+// Listen starts an HTTP server on addr that upgrades requests on the path to WebSockets
+func (t WebSocket) Listen(addr string, cfg *Config) (Listener, error) {
+	hostport, path := splitPath(addr)
+	if !t.TLS {
+		warnCleartext(hostport)
+	}
+
+	nl, err := net.Listen("tcp", hostport)
+	if err != nil {
+		return nil, err
+	}
+	if t.TLS {
+		nl = tls.NewListener(nl, httpTLS(cfg.TLS))
+	}
+
+	l := &muxListener{
+		cfg:   cfg,
+		addr:  nl.Addr(),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.SetReadLimit(maxWebSocketMessage)
+		l.deliver(websocket.NetConn(context.Background(), c, websocket.MessageBinary))
+	})
+
+	srv := &http.Server{Handler: mux}
+	l.close = srv.Close
+	go func() {
+		if err := srv.Serve(nl); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			_ = l.Close()
+		}
+	}()
+	return l, nil
+}
+
+// Dial opens a WebSocket to addr
+func (t WebSocket) Dial(ctx context.Context, addr string, cfg *Config) (Conn, error) {
+	hostport, path := splitPath(addr)
+
+	scheme := "ws"
+	opts := &websocket.DialOptions{}
+	if t.TLS {
+		scheme = "wss"
+		opts.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: httpTLS(cfg.TLS)},
+		}
+	} else {
+		warnCleartext(hostport)
+	}
+
+	c, _, err := websocket.Dial(ctx, scheme+"://"+hostport+path, opts)
+	if err != nil {
+		return nil, err
+	}
+	c.SetReadLimit(maxWebSocketMessage)
+	return newMuxConn(websocket.NetConn(context.Background(), c, websocket.MessageBinary), cfg, true)
+}
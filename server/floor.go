@@ -0,0 +1,330 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	errs "github.com/dmh2000/talkers/internal/errors"
+	"github.com/dmh2000/talkers/internal/proto"
+)
+
+// FloorMode selects how the server decides which client may send.
+type FloorMode string
+
+const (
+	// FloorOpen lets every client send at any time.
+	FloorOpen FloorMode = ""
+
+	// FloorRoundRobin gives the turn to each client in registration order. The
+	// holder sends one message, after which the turn moves on, or passes it.
+	FloorRoundRobin FloorMode = "round-robin"
+
+	// FloorToken lets the holder send any number of messages until it passes the
+	// turn to a client of its choice.
+	FloorToken FloorMode = "token"
+
+	// FloorModerated lets the moderator send at any time and grant the turn to
+	// another client for one message.
+	FloorModerated FloorMode = "moderated"
+)
+
+// FloorModes lists the floor control modes.
+var FloorModes = []FloorMode{FloorRoundRobin, FloorToken, FloorModerated}
+
+// ParseFloorMode returns the mode named name; "" and "open" mean FloorOpen.
+func ParseFloorMode(name string) (FloorMode, error) {
+	if name == "" || name == "open" {
+		return FloorOpen, nil
+	}
+	for _, mode := range FloorModes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown floor mode %q (want open, round-robin, token or moderated)", name)
+}
+
+// DefaultTurnTimeout is how long a client may hold the turn without sending
+// when FloorConfig leaves it unset.
+const DefaultTurnTimeout = time.Minute
+
+// FloorConfig configures floor control. The zero value leaves the floor open.
+type FloorConfig struct {
+	Mode FloorMode
+
+	// Moderator is the client ID of the moderator in FloorModerated.
+	Moderator string
+
+	// TurnTimeout is how long the holder keeps the turn without sending before
+	// it moves on (0 = DefaultTurnTimeout, negative = no limit).
+	TurnTimeout time.Duration
+}
+
+// Validate checks that the configuration is usable.
+func (c FloorConfig) Validate() error {
+	if _, err := ParseFloorMode(string(c.Mode)); err != nil {
+		return err
+	}
+	if c.Mode == FloorModerated && c.Moderator == "" {
+		return errors.New("moderated floor needs a moderator")
+	}
+	if c.Mode != FloorModerated && c.Moderator != "" {
+		return fmt.Errorf("a moderator needs the %s floor mode", FloorModerated)
+	}
+	return nil
+}
+
+// floor tracks which client holds the turn. When every client passes in a row
+// the turn is parked: the floor is free and the next client to send takes it.
+// In moderated mode an empty holder means the floor is with the moderator.
+type floor struct {
+	cfg      FloorConfig
+	registry *Registry
+
+	mu     sync.Mutex
+	order  []string // registered clients in registration order
+	holder string
+	number uint64
+	passes int // consecutive passes since the last message
+	timer  *time.Timer
+
+	// notified is the number of the last turn sent to the clients
+	notified uint64
+}
+
+// newFloor returns the floor for cfg, or nil if the floor is open
+func newFloor(cfg FloorConfig, registry *Registry) *floor {
+	if cfg.Mode == FloorOpen {
+		return nil
+	}
+	if cfg.TurnTimeout == 0 {
+		cfg.TurnTimeout = DefaultTurnTimeout
+	}
+	return &floor{cfg: cfg, registry: registry}
+}
+
+// join adds id to the turn order and calls ack with the current turn, nil when
+// the floor is open. ack runs before any later turn change is sent to id.
+func (f *floor) join(id string, ack func(turn *proto.Turn) error) error {
+	if f == nil {
+		return ack(nil)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.order = append(f.order, id)
+	return ack(f.turn())
+}
+
+// leave removes id from the turn order, moving the turn on if id held it
+func (f *floor) leave(id string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	if f.holder == id {
+		next := f.next(id)
+		if next == id || f.cfg.Mode == FloorModerated {
+			next = ""
+		}
+		f.set(next)
+	}
+	f.order = slices.DeleteFunc(f.order, func(o string) bool { return o == id })
+	f.unlockAndNotify()
+}
+
+// allow returns ErrNotYourTurn unless sender may send now, and otherwise takes
+// the turn for sender's message: in round-robin mode the turn moves on, in token
+// mode a free floor goes to sender, and in moderated mode a granted turn returns
+// to the moderator. Taking it under the same lock as the check means two messages
+// cannot both be let through on one turn. A message that then fails to be
+// delivered has still used the turn.
+func (f *floor) allow(sender string) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.unlockAndNotify()
+	if !turnAllows(f.turn(), sender) {
+		return errors.New(errs.ErrNotYourTurn)
+	}
+
+	f.passes = 0
+	switch f.cfg.Mode {
+	case FloorRoundRobin:
+		f.set(f.next(sender))
+	case FloorToken:
+		if f.holder == "" {
+			f.set(sender)
+		} else {
+			f.startTimer()
+		}
+	case FloorModerated:
+		if f.holder == sender && sender != f.cfg.Moderator {
+			f.set("")
+		}
+	}
+	return nil
+}
+
+// turnAllows reports whether id may send during turn
+func turnAllows(turn *proto.Turn, id string) bool {
+	switch {
+	case turn.Holder == id:
+		return true
+	case FloorMode(turn.Mode) == FloorModerated:
+		return id == turn.Moderator
+	default:
+		return turn.Holder == ""
+	}
+}
+
+// pass handles a Turn sent by sender, passing turn number to the client named
+// to. A pass of a turn that has already moved on is ignored.
+func (f *floor) pass(sender, to string, number uint64) error {
+	if f == nil {
+		return errors.New(errs.ErrNoFloorControl)
+	}
+	f.mu.Lock()
+	defer f.unlockAndNotify()
+	if number != f.number {
+		return nil
+	}
+	if to != "" && !slices.Contains(f.order, to) {
+		return errors.New(errs.ErrCannotPassTurn)
+	}
+
+	if f.cfg.Mode == FloorModerated {
+		switch {
+		case sender == f.cfg.Moderator:
+			f.set(to)
+		case sender == f.holder && to == "":
+			f.set("")
+		case sender == f.holder:
+			return errors.New(errs.ErrCannotPassTurn)
+		default:
+			return errors.New(errs.ErrNotYourTurn)
+		}
+		return nil
+	}
+
+	if sender != f.holder {
+		return errors.New(errs.ErrNotYourTurn)
+	}
+	if to != "" && f.cfg.Mode == FloorRoundRobin {
+		return errors.New(errs.ErrCannotPassTurn)
+	}
+	f.yield(to)
+	return nil
+}
+
+// expire moves on turn number after its holder kept it too long
+func (f *floor) expire(number uint64) {
+	f.mu.Lock()
+	if number == f.number && f.holder != "" {
+		log.Printf("Turn %d of %s timed out", number, f.holder)
+		if f.cfg.Mode == FloorModerated {
+			f.set("")
+		} else {
+			f.yield("")
+		}
+	}
+	f.unlockAndNotify()
+}
+
+// yield passes the holder's turn to to, or the next client, parking it once
+// every client has passed in a row. f.mu must be held.
+func (f *floor) yield(to string) {
+	f.passes++
+	switch {
+	case f.passes >= len(f.order):
+		f.passes = 0
+		f.set("")
+	case to != "":
+		f.set(to)
+	default:
+		f.set(f.next(f.holder))
+	}
+}
+
+// next returns the client after id in the turn order. f.mu must be held.
+func (f *floor) next(id string) string {
+	if len(f.order) == 0 {
+		return ""
+	}
+	i := slices.Index(f.order, id)
+	return f.order[(i+1)%len(f.order)]
+}
+
+// set gives the turn to holder as a new turn. f.mu must be held.
+func (f *floor) set(holder string) {
+	f.holder = holder
+	f.number++
+	f.startTimer()
+}
+
+// startTimer restarts the current turn's timeout. f.mu must be held.
+func (f *floor) startTimer() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if f.holder == "" || f.cfg.TurnTimeout < 0 {
+		return
+	}
+	number := f.number
+	f.timer = time.AfterFunc(f.cfg.TurnTimeout, func() { f.expire(number) })
+}
+
+// unlockAndNotify releases f.mu and, if the turn changed while it was held,
+// sends the new turn to every client. The envelopes are written after unlocking
+// so that a slow client cannot hold up the floor; notifications of successive
+// changes may therefore reach a client out of order, and clients drop any turn
+// with a lower Number than the last one they saw.
+func (f *floor) unlockAndNotify() {
+	turn := f.turn()
+	order := slices.Clone(f.order)
+	changed := f.number != f.notified
+	f.notified = f.number
+	f.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	env := &proto.Envelope{
+		Payload: &proto.Envelope_Turn{
+			Turn: turn,
+		},
+	}
+	for _, id := range order {
+		if conn, ok := f.registry.Get(id); ok {
+			_ = conn.WriteControl(env)
+		}
+	}
+}
+
+// stop stops the turn timer
+func (f *floor) stop() {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+}
+
+// turn returns the current turn. f.mu must be held.
+func (f *floor) turn() *proto.Turn {
+	return &proto.Turn{
+		Holder:    f.holder,
+		Mode:      string(f.cfg.Mode),
+		Number:    f.number,
+		Moderator: f.cfg.Moderator,
+	}
+}
@@ -1,20 +1,25 @@
-package main
+package server
 
 import (
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"sync"
+	"time"
 
-	"github.com/quic-go/quic-go"
 	errs "github.com/dmh2000/talkers/internal/errors"
 	"github.com/dmh2000/talkers/internal/framing"
 	"github.com/dmh2000/talkers/internal/proto"
+	"github.com/dmh2000/talkers/internal/transport"
 )
 
-// handleConnection manages a single client connection lifecycle
-func handleConnection(ctx context.Context, conn *quic.Conn, registry *Registry) {
-	// Accept the bidirectional stream from the client
+// handleConnection manages a single client connection lifecycle.
+// The first bidirectional stream is the control stream; after registration,
+// message content arrives on unidirectional streams accepted by acceptMessageStreams.
+func handleConnection(ctx context.Context, conn transport.Conn, registry *Registry) {
+	// Accept the control stream from the client
 	stream, err := conn.AcceptStream(ctx)
 	if err != nil {
 		log.Printf("Failed to accept stream: %v", err)
@@ -27,13 +32,17 @@ func handleConnection(ctx context.Context, conn *quic.Conn, registry *Registry)
 		// Ensure cleanup happens on function exit
 		if clientID != "" {
 			registry.Remove(clientID)
+			registry.floor.leave(clientID)
+			registry.failRequests(clientID)
+			registry.announce(clientID, false)
 			log.Printf("Client %s disconnected and removed from registry", clientID)
 		}
 		_ = stream.Close()
 	}()
 
 	// Read the first envelope - must be a Register message
-	env, err := framing.ReadEnvelope(stream)
+	reader := framing.NewFrameReader(stream)
+	env, err := reader.ReadEnvelope()
 	if err != nil {
 		log.Printf("Failed to read first envelope: %v", err)
 		return
@@ -72,8 +81,9 @@ func handleConnection(ctx context.Context, conn *quic.Conn, registry *Registry)
 
 	// Create ClientConn and add to registry
 	clientConn := &ClientConn{
-		Connection: conn,
-		Stream:     stream,
+		Connection:  conn,
+		Stream:      stream,
+		Compression: framing.NegotiateCompression(reg.Compression),
 	}
 
 	if err := registry.Add(clientID, clientConn); err != nil {
@@ -92,9 +102,33 @@ func handleConnection(ctx context.Context, conn *quic.Conn, registry *Registry)
 		return
 	}
 
-	log.Printf("Client %s registered successfully (total clients: %d)", clientID, registry.Count())
+	// Acknowledge registration with the negotiated compression and, under floor
+	// control, the current turn. Joining the turn order sends later turns too.
+	registered := &proto.Registered{
+		Compression: clientConn.Compression.String(),
+		Room:        registry.room,
+	}
+	registeredEnv := &proto.Envelope{
+		Payload: &proto.Envelope_Registered{
+			Registered: registered,
+		},
+	}
+	err = registry.floor.join(clientID, func(turn *proto.Turn) error {
+		registered.Turn = turn
+		return clientConn.WriteControl(registeredEnv)
+	})
+	if err != nil {
+		log.Printf("Client %s: failed to acknowledge registration: %v", clientID, err)
+		return
+	}
+
+	log.Printf("Client %s registered successfully (compression: %s, total clients: %d)", clientID, clientConn.Compression, registry.Count())
+	registry.announce(clientID, true)
 
-	// Enter message loop
+	// Accept per-message streams until the connection goes away
+	go acceptMessageStreams(ctx, conn, registry, clientID, clientConn)
+
+	// Enter control loop
 	for {
 		// Check if context is cancelled
 		select {
@@ -105,52 +139,340 @@ func handleConnection(ctx context.Context, conn *quic.Conn, registry *Registry)
 		}
 
 		// Read next envelope
-		env, err := framing.ReadEnvelope(stream)
+		env, err := reader.ReadEnvelope()
 		if err != nil {
 			log.Printf("Client %s: error reading envelope: %v", clientID, err)
 			return
 		}
 
-		// Validate that it's a Message (not Register or Error)
-		msg := env.GetMessage()
-		if msg == nil {
-			log.Printf("Client %s: received non-Message envelope after registration", clientID)
-			errorEnv := &proto.Envelope{
-				Payload: &proto.Envelope_Error{
-					Error: &proto.Error{
-						Error: errs.ErrUnexpectedMessage,
+		// Answer pings so the client can tell the server is responsive
+		if ping := env.GetPing(); ping != nil {
+			pongEnv := &proto.Envelope{
+				Payload: &proto.Envelope_Pong{
+					Pong: &proto.Pong{
+						Id: ping.Id,
+					},
+				},
+			}
+			if err := clientConn.WriteControl(pongEnv); err != nil {
+				log.Printf("Client %s: failed to answer ping: %v", clientID, err)
+				return
+			}
+			continue
+		}
+
+		// Answer roster requests with the clients connected now
+		if req := env.GetRosterRequest(); req != nil {
+			rosterEnv := &proto.Envelope{
+				Payload: &proto.Envelope_Roster{
+					Roster: &proto.Roster{
+						Id:      req.Id,
+						Clients: registry.IDs(),
 					},
 				},
 			}
-			_ = framing.WriteEnvelope(stream, errorEnv)
+			if err := clientConn.WriteControl(rosterEnv); err != nil {
+				log.Printf("Client %s: failed to answer roster request: %v", clientID, err)
+				return
+			}
+			continue
+		}
+
+		// Passing the turn is the only other request a client makes here
+		if turn := env.GetTurn(); turn != nil {
+			if err := registry.floor.pass(clientID, turn.Holder, turn.Number); err != nil {
+				log.Printf("Client %s: failed to pass turn to %q: %v", clientID, turn.Holder, err)
+				errorEnv := &proto.Envelope{
+					Payload: &proto.Envelope_Error{
+						Error: &proto.Error{
+							Error: err.Error(),
+						},
+					},
+				}
+				_ = clientConn.WriteControl(errorEnv)
+			}
+			continue
+		}
+
+		// Message content belongs on its own stream; nothing else is valid here
+		log.Printf("Client %s: received unexpected envelope on control stream: %T", clientID, env.Payload)
+		errorEnv := &proto.Envelope{
+			Payload: &proto.Envelope_Error{
+				Error: &proto.Error{
+					Error: errs.ErrUnexpectedMessage,
+				},
+			},
+		}
+		_ = clientConn.WriteControl(errorEnv)
+		return
+	}
+}
+
+// acceptMessageStreams accepts unidirectional streams from a registered client.
+// Each stream carries a single Message envelope and is handled in its own goroutine,
+// so a large message does not delay the ones behind it. Messages are still routed,
+// and numbered for their recipients, in the order the client opened their streams.
+func acceptMessageStreams(ctx context.Context, conn transport.Conn, registry *Registry, clientID string, clientConn *ClientConn) {
+	prev := make(chan struct{})
+	close(prev)
+	for {
+		stream, err := conn.AcceptUniStream(ctx)
+		if err != nil {
+			// Connection closed or context cancelled; handleConnection does the cleanup
 			return
 		}
+		order := &routeOrder{prev: prev, next: make(chan struct{})}
+		prev = order.next
+		go handleMessageStream(ctx, stream, registry, clientID, clientConn, order)
+	}
+}
+
+// routeOrder keeps a client's messages in the order it opened their streams.
+// Each stream's handler waits for the one before it to route its message, or
+// start forwarding its stream, before routing its own.
+type routeOrder struct {
+	prev <-chan struct{}
+	next chan struct{}
+	once sync.Once
+}
+
+// wait blocks until the previous stream has been routed
+func (o *routeOrder) wait(ctx context.Context) {
+	select {
+	case <-o.prev:
+	case <-ctx.Done():
+	}
+}
+
+// done lets the next stream be routed, once the previous one has been
+func (o *routeOrder) done(ctx context.Context) {
+	o.once.Do(func() {
+		o.wait(ctx)
+		close(o.next)
+	})
+}
+
+// handleMessageStream reads a Message or a streamed message from a unidirectional
+// stream and routes it. Routing errors are reported to the sender on its control stream.
+func handleMessageStream(ctx context.Context, stream transport.ReceiveStream, registry *Registry, clientID string, clientConn *ClientConn, order *routeOrder) {
+	defer order.done(ctx)
+
+	src := &frameSource{stream: stream, reader: framing.NewFrameReader(stream), timeout: registry.chunkTimeout}
+	env, err := src.next()
+	if err != nil {
+		log.Printf("Client %s: error reading message stream: %v", clientID, err)
+		stream.Cancel()
+		return
+	}
 
-		// Route the message
-		if err := routeMessage(registry, clientID, msg); err != nil {
-			log.Printf("Error routing message from %s to %s: %v", clientID, msg.ToId, err)
-			// Send error back to sender
+	order.wait(ctx)
+
+	// Streamed messages are forwarded frame by frame
+	if start := env.GetStreamStart(); start != nil {
+		if err := routeStream(ctx, registry, clientID, start, src, order); err != nil {
+			log.Printf("Error routing stream %s from %s to %s: %v", start.StreamId, clientID, start.ToId, err)
+			stream.Cancel()
 			errorEnv := &proto.Envelope{
 				Payload: &proto.Envelope_Error{
 					Error: &proto.Error{
-						Error: err.Error(),
+						Error:     err.Error(),
+						RequestId: start.RequestId,
+						AckId:     start.AckId,
 					},
 				},
 			}
-			_ = framing.WriteEnvelope(stream, errorEnv)
+			_ = clientConn.WriteControl(errorEnv)
 		} else {
-			// Log successful message routing
-			log.Printf("Message routed: %s -> %s", clientID, msg.ToId)
+			log.Printf("Stream routed: %s -> %s (%s)", clientID, start.ToId, start.StreamId)
+			acknowledge(clientConn, start.AckId)
+		}
+		return
+	}
+
+	// Validate that it's a Message (not Register or Error)
+	msg := env.GetMessage()
+	if msg == nil {
+		log.Printf("Client %s: received non-Message envelope on message stream", clientID)
+		errorEnv := &proto.Envelope{
+			Payload: &proto.Envelope_Error{
+				Error: &proto.Error{
+					Error: errs.ErrUnexpectedMessage,
+				},
+			},
 		}
+		_ = clientConn.WriteControl(errorEnv)
+		return
+	}
+
+	// Route the message
+	if err := routeMessage(ctx, registry, clientID, msg, order); err != nil {
+		log.Printf("Error routing message from %s to %s: %v", clientID, msg.ToId, err)
+		// Send error back to sender, tied to its request if it made one
+		errorEnv := &proto.Envelope{
+			Payload: &proto.Envelope_Error{
+				Error: &proto.Error{
+					Error:     err.Error(),
+					RequestId: msg.RequestId,
+					AckId:     msg.AckId,
+				},
+			},
+		}
+		_ = clientConn.WriteControl(errorEnv)
+	} else {
+		// Log successful message routing
+		log.Printf("Message routed: %s -> %s", clientID, msg.ToId)
+		acknowledge(clientConn, msg.AckId)
 	}
 }
 
-// routeMessage validates and routes a message from sender to destination
-func routeMessage(registry *Registry, sender string, msg *proto.Message) error {
+// acknowledge tells the sender its message was delivered, if it asked to be told
+func acknowledge(clientConn *ClientConn, ackID string) {
+	if ackID == "" {
+		return
+	}
+	ackEnv := &proto.Envelope{
+		Payload: &proto.Envelope_Ack{
+			Ack: &proto.Ack{
+				AckId: ackID,
+			},
+		},
+	}
+	_ = clientConn.WriteControl(ackEnv)
+}
+
+// frameSource reads the envelopes of a sender's message stream, giving up on a
+// stream that sends nothing for timeout so a stalled sender cannot hold the
+// recipient's stream, or its own later messages, open indefinitely
+type frameSource struct {
+	stream  transport.ReceiveStream
+	reader  *framing.FrameReader
+	timeout time.Duration
+}
+
+// next reads the next envelope within the timeout
+func (s *frameSource) next() (*proto.Envelope, error) {
+	_ = s.stream.SetReadDeadline(time.Now().Add(s.timeout))
+	return s.reader.ReadEnvelope()
+}
+
+// routeStream forwards a streamed message or attachment to its destination as it arrives.
+// The destination receives the frames on a single stream of its own; if the sender's
+// stream breaks off or the content or data grows past its limit, that stream is reset.
+// The sender's next message is routed once the stream is numbered and under way.
+func routeStream(ctx context.Context, registry *Registry, sender string, start *proto.StreamStart, src *frameSource, order *routeOrder) error {
+	// Ensure the from_id matches the sender
+	start.FromId = sender
+
+	// Look up destination client
+	destConn, exists := registry.Get(start.ToId)
+	if !exists {
+		return errors.New(errs.ErrClientNotRegistered)
+	}
+
+	// Under floor control only the holder of the turn may send; the message takes the turn
+	if err := registry.floor.allow(sender); err != nil {
+		return err
+	}
+
+	// A streamed reply answers its request as soon as it starts
+	if start.ReplyTo != "" {
+		registry.completeRequest(start.ToId, start.ReplyTo, sender)
+	}
+
+	// Track a request before forwarding it so that a fast reply finds it pending;
+	// it is dropped again if forwarding fails
+	if start.RequestId != "" {
+		registry.trackRequest(sender, start.RequestId, start.ToId, requestTimeout(start.TimeoutMs))
+	}
+	start.Seq = destConn.nextSeq(sender)
+	if err := forwardStream(ctx, registry, destConn, start, src, order); err != nil {
+		if start.RequestId != "" {
+			registry.completeRequest(sender, start.RequestId, start.ToId)
+		}
+		return err
+	}
+	return nil
+}
+
+// forwardStream copies a streamed message from src to a new stream to destConn,
+// validating each frame. The stream is opened before order lets the sender's next
+// message through, so that the destination accepts them in order too.
+func forwardStream(ctx context.Context, registry *Registry, destConn *ClientConn, start *proto.StreamStart, src *frameSource, order *routeOrder) error {
+	dest, err := destConn.Connection.OpenUniStream(ctx)
+	order.done(ctx)
+	if err != nil {
+		registry.Remove(start.ToId)
+		return fmt.Errorf("%s: %w", errs.ErrClientDisconnected, err)
+	}
+
+	env := &proto.Envelope{
+		Payload: &proto.Envelope_StreamStart{
+			StreamStart: start,
+		},
+	}
+
+	writer := framing.NewFrameWriter(dest, destConn.Compression)
+	total, totalData := 0, 0
+	for {
+		if err := writer.WriteEnvelope(env); err != nil {
+			dest.Cancel()
+			registry.Remove(start.ToId)
+			return fmt.Errorf("%s: %w", errs.ErrClientDisconnected, err)
+		}
+		if env.GetStreamEnd() != nil {
+			return dest.Close()
+		}
+
+		// Read the next frame from the sender
+		env, err = src.next()
+		if err != nil {
+			dest.Cancel()
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return errors.New(errs.ErrStreamStalled)
+			}
+			return fmt.Errorf("%s: %w", errs.ErrInvalidStream, err)
+		}
+
+		switch payload := env.Payload.(type) {
+		case *proto.Envelope_StreamChunk:
+			if payload.StreamChunk.StreamId != start.StreamId {
+				dest.Cancel()
+				return errors.New(errs.ErrInvalidStream)
+			}
+			// Validate accumulated content length
+			total += len(payload.StreamChunk.Content)
+			if total > 250000 {
+				dest.Cancel()
+				return errors.New(errs.ErrContentTooLarge)
+			}
+			totalData += len(payload.StreamChunk.Data)
+			if totalData > framing.MaxAttachmentSize {
+				dest.Cancel()
+				return errors.New(errs.ErrAttachmentTooLarge)
+			}
+		case *proto.Envelope_StreamEnd:
+			if payload.StreamEnd.StreamId != start.StreamId {
+				dest.Cancel()
+				return errors.New(errs.ErrInvalidStream)
+			}
+		default:
+			dest.Cancel()
+			return errors.New(errs.ErrInvalidStream)
+		}
+	}
+}
+
+// routeMessage validates and routes a message from sender to destination. The
+// sender's next message is routed once this one is numbered and its stream opened.
+func routeMessage(ctx context.Context, registry *Registry, sender string, msg *proto.Message, order *routeOrder) error {
 	// Validate content length
 	if len(msg.Content) > 250000 {
 		return errors.New(errs.ErrContentTooLarge)
 	}
+	if len(msg.Data) > framing.MaxAttachmentSize {
+		return errors.New(errs.ErrAttachmentTooLarge)
+	}
 
 	// Ensure the from_id matches the sender
 	msg.FromId = sender
@@ -161,6 +483,11 @@ func routeMessage(registry *Registry, sender string, msg *proto.Message) error {
 		return errors.New(errs.ErrClientNotRegistered)
 	}
 
+	// Under floor control only the holder of the turn may send; the message takes the turn
+	if err := registry.floor.allow(sender); err != nil {
+		return err
+	}
+
 	// Create envelope with the message
 	env := &proto.Envelope{
 		Payload: &proto.Envelope_Message{
@@ -168,12 +495,25 @@ func routeMessage(registry *Registry, sender string, msg *proto.Message) error {
 		},
 	}
 
-	// Write to destination stream
-	if err := framing.WriteEnvelope(destConn.Stream, env); err != nil {
+	// A reply answers the request it refers to
+	if msg.ReplyTo != "" {
+		registry.completeRequest(msg.ToId, msg.ReplyTo, sender)
+	}
+
+	// Track a request before delivering it so that a fast reply finds it pending
+	if msg.RequestId != "" {
+		registry.trackRequest(sender, msg.RequestId, msg.ToId, requestTimeout(msg.TimeoutMs))
+	}
+
+	// Deliver on a new stream to the destination
+	msg.Seq = destConn.nextSeq(sender)
+	if err := destConn.SendMessage(ctx, env, func() { order.done(ctx) }); err != nil {
 		// If write fails, remove the dead client from registry
 		registry.Remove(msg.ToId)
+		if msg.RequestId != "" {
+			registry.completeRequest(sender, msg.RequestId, msg.ToId)
+		}
 		return fmt.Errorf("%s: %w", errs.ErrClientDisconnected, err)
 	}
-
 	return nil
 }
@@ -1,29 +1,105 @@
-package main
+package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"maps"
+	"slices"
 	"sync"
+	"time"
 
-	"github.com/quic-go/quic-go"
 	errs "github.com/dmh2000/talkers/internal/errors"
+	"github.com/dmh2000/talkers/internal/framing"
+	"github.com/dmh2000/talkers/internal/proto"
+	"github.com/dmh2000/talkers/internal/transport"
 )
 
-// ClientConn wraps a QUIC connection and stream for a registered client
+// ClientConn wraps a transport connection and its control stream for a registered client.
+// Message content is delivered on per-message unidirectional streams so that a large
+// message never blocks control traffic queued behind it.
 type ClientConn struct {
-	Connection *quic.Conn
-	Stream     *quic.Stream
+	Connection transport.Conn
+	Stream     transport.Stream
+
+	// Compression negotiated at registration, applied to every envelope sent to the client
+	Compression framing.Compression
+
+	// mu serializes writes to the control stream through writer
+	mu     sync.Mutex
+	writer *framing.FrameWriter
+
+	// seqs holds the sequence number last given to a message to this client, by sender
+	seqMu sync.Mutex
+	seqs  map[string]uint64
+}
+
+// nextSeq returns the sequence number for the next message from sender to the client
+func (c *ClientConn) nextSeq(sender string) uint64 {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	if c.seqs == nil {
+		c.seqs = make(map[string]uint64)
+	}
+	c.seqs[sender]++
+	return c.seqs[sender]
+}
+
+// WriteControl writes an envelope to the client's control stream.
+// Safe for concurrent use.
+func (c *ClientConn) WriteControl(env *proto.Envelope) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		c.writer = framing.NewFrameWriter(c.Stream, c.Compression)
+	}
+	return c.writer.WriteEnvelope(env)
+}
+
+// SendMessage delivers an envelope to the client on a new unidirectional stream.
+// The stream carries exactly one envelope and is closed after the write. If
+// opened is set it is called once the stream has been opened, or failed to open.
+func (c *ClientConn) SendMessage(ctx context.Context, env *proto.Envelope, opened func()) error {
+	stream, err := c.Connection.OpenUniStream(ctx)
+	if opened != nil {
+		opened()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open message stream: %w", err)
+	}
+	if err := framing.WriteEnvelopeCompressed(stream, env, c.Compression); err != nil {
+		stream.Cancel()
+		return err
+	}
+	return stream.Close()
 }
 
 // Registry maintains a thread-safe map of client ID to ClientConn
 type Registry struct {
 	mu      sync.RWMutex
 	clients map[string]*ClientConn
+
+	// pending holds delivered requests awaiting a reply
+	pending pendingRequests
+
+	// floor decides who may send; nil when the floor is open
+	floor *floor
+
+	// chunkTimeout bounds the wait for each frame of an incoming message stream
+	chunkTimeout time.Duration
+
+	// room is the name of the room, sent to each client as it registers
+	room string
 }
 
 // NewRegistry creates a new empty client registry
 func NewRegistry() *Registry {
 	return &Registry{
 		clients: make(map[string]*ClientConn),
+		pending: pendingRequests{
+			requests: make(map[requestKey]*pendingRequest),
+		},
+		chunkTimeout: DefaultChunkTimeout,
 	}
 }
 
@@ -64,6 +140,39 @@ func (r *Registry) Get(id string) (*ClientConn, bool) {
 	return conn, exists
 }
 
+// announce tells every client other than id, on its control stream, that id has
+// registered or disconnected
+func (r *Registry) announce(id string, online bool) {
+	env := &proto.Envelope{
+		Payload: &proto.Envelope_Presence{
+			Presence: &proto.Presence{
+				ClientId: id,
+				Online:   online,
+			},
+		},
+	}
+
+	r.mu.RLock()
+	conns := make([]*ClientConn, 0, len(r.clients))
+	for other, conn := range r.clients {
+		if other != id {
+			conns = append(conns, conn)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, conn := range conns {
+		_ = conn.WriteControl(env)
+	}
+}
+
+// IDs returns the IDs of the registered clients, sorted
+func (r *Registry) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Sorted(maps.Keys(r.clients))
+}
+
 // Count returns the number of registered clients
 func (r *Registry) Count() int {
 	r.mu.RLock()
@@ -82,10 +191,18 @@ func (r *Registry) Close() {
 			_ = conn.Stream.Close()
 		}
 		if conn.Connection != nil {
-			_ = conn.Connection.CloseWithError(0, "server shutting down")
+			_ = conn.Connection.Close("server shutting down")
 		}
 	}
 
 	// Clear the registry
 	r.clients = make(map[string]*ClientConn)
+
+	// Drop pending requests; their requesters are gone
+	r.pending.mu.Lock()
+	for key, req := range r.pending.requests {
+		req.timer.Stop()
+		delete(r.pending.requests, key)
+	}
+	r.pending.mu.Unlock()
 }
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	errs "github.com/dmh2000/talkers/internal/errors"
+	"github.com/dmh2000/talkers/internal/proto"
+)
+
+// DefaultRequestTimeout is how long the server waits for a reply to a request
+// that does not set its own timeout.
+const DefaultRequestTimeout = 60 * time.Second
+
+// MaxRequestTimeout caps the timeout a request may ask for.
+const MaxRequestTimeout = 10 * time.Minute
+
+// requestKey identifies a request by the client that sent it and its request ID
+type requestKey struct {
+	requester string
+	id        string
+}
+
+// pendingRequest is a request that has been delivered and is awaiting a reply
+type pendingRequest struct {
+	peer  string
+	timer *time.Timer
+}
+
+// pendingRequests tracks requests awaiting a reply so the requester can be told
+// when the peer never answers
+type pendingRequests struct {
+	mu       sync.Mutex
+	requests map[requestKey]*pendingRequest
+}
+
+// requestTimeout returns the reply timeout for a request asking for timeoutMs
+func requestTimeout(timeoutMs uint32) time.Duration {
+	if timeoutMs == 0 {
+		return DefaultRequestTimeout
+	}
+	return min(time.Duration(timeoutMs)*time.Millisecond, MaxRequestTimeout)
+}
+
+// trackRequest records a request from requester to peer. If no reply arrives within
+// timeout the requester is sent ErrRequestTimeout.
+func (r *Registry) trackRequest(requester, id, peer string, timeout time.Duration) {
+	key := requestKey{requester: requester, id: id}
+
+	r.pending.mu.Lock()
+	defer r.pending.mu.Unlock()
+
+	// A reused request ID replaces the earlier request
+	if old, exists := r.pending.requests[key]; exists {
+		old.timer.Stop()
+	}
+	r.pending.requests[key] = &pendingRequest{
+		peer: peer,
+		timer: time.AfterFunc(timeout, func() {
+			if r.takeRequest(key, "") {
+				log.Printf("Request %s from %s to %s timed out", id, requester, peer)
+				r.notifyRequester(key, errs.ErrRequestTimeout)
+			}
+		}),
+	}
+}
+
+// completeRequest clears the request that a reply from peer answers.
+// It reports whether such a request was pending.
+func (r *Registry) completeRequest(requester, id, peer string) bool {
+	return r.takeRequest(requestKey{requester: requester, id: id}, peer)
+}
+
+// takeRequest removes the pending request for key and stops its timer. If peer is
+// not empty the request must have been sent to peer.
+func (r *Registry) takeRequest(key requestKey, peer string) bool {
+	r.pending.mu.Lock()
+	defer r.pending.mu.Unlock()
+
+	req, exists := r.pending.requests[key]
+	if !exists || (peer != "" && req.peer != peer) {
+		return false
+	}
+	req.timer.Stop()
+	delete(r.pending.requests, key)
+	return true
+}
+
+// failRequests drops every request sent by or to client. Requesters still waiting
+// on client are sent ErrPeerUnreachable.
+func (r *Registry) failRequests(client string) {
+	var unreachable []requestKey
+
+	r.pending.mu.Lock()
+	for key, req := range r.pending.requests {
+		if key.requester != client && req.peer != client {
+			continue
+		}
+		req.timer.Stop()
+		delete(r.pending.requests, key)
+		if key.requester != client {
+			unreachable = append(unreachable, key)
+		}
+	}
+	r.pending.mu.Unlock()
+
+	for _, key := range unreachable {
+		log.Printf("Request %s from %s failed: %s disconnected", key.id, key.requester, client)
+		r.notifyRequester(key, errs.ErrPeerUnreachable)
+	}
+}
+
+// notifyRequester sends an error about a request to the client that made it
+func (r *Registry) notifyRequester(key requestKey, message string) {
+	conn, exists := r.Get(key.requester)
+	if !exists {
+		return
+	}
+	errorEnv := &proto.Envelope{
+		Payload: &proto.Envelope_Error{
+			Error: &proto.Error{
+				Error:     message,
+				RequestId: key.id,
+			},
+		},
+	}
+	_ = conn.WriteControl(errorEnv)
+}
@@ -0,0 +1,224 @@
+// Package server implements the talkers message broker: it accepts client
+// connections on one or more transports, registers clients by ID, and routes
+// messages and streamed messages between them. The command in cmd/server runs
+// it as a standalone process; tests and embedders can run it in-process, for
+// example on the mem transport.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dmh2000/talkers/internal/framing"
+	"github.com/dmh2000/talkers/internal/tlsutil"
+	"github.com/dmh2000/talkers/internal/transport"
+)
+
+// Config configures a Server.
+type Config struct {
+	// Addrs are the listen addresses, each [scheme://]host:port
+	Addrs []string
+
+	// Transport holds the TLS and idle timeout settings for every listener.
+	// If nil, a self-signed certificate and framing.MaxIdleTimeout are used.
+	Transport *transport.Config
+
+	// Floor configures floor control. The zero value lets every client send at any time.
+	Floor FloorConfig
+
+	// ChunkTimeout is how long a streamed message may go without sending a frame
+	// before the server abandons it (0 = DefaultChunkTimeout).
+	ChunkTimeout time.Duration
+
+	// Room names the room the server hosts; clients learn it on registering
+	Room string
+}
+
+// DefaultChunkTimeout is the ChunkTimeout used when Config leaves it unset.
+const DefaultChunkTimeout = time.Minute
+
+// Server routes messages between clients connected on any of its listeners.
+type Server struct {
+	cfg       Config
+	registry  *Registry
+	listeners []transport.Listener
+	addrs     []string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a Server for cfg. Call Start to begin listening.
+func New(cfg Config) *Server {
+	registry := NewRegistry()
+	registry.floor = newFloor(cfg.Floor, registry)
+	registry.room = cfg.Room
+	registry.chunkTimeout = cfg.ChunkTimeout
+	if registry.chunkTimeout <= 0 {
+		registry.chunkTimeout = DefaultChunkTimeout
+	}
+	return &Server{
+		cfg:      cfg,
+		registry: registry,
+	}
+}
+
+// DefaultTransportConfig returns a transport configuration with a freshly
+// generated self-signed certificate.
+func DefaultTransportConfig() (*transport.Config, error) {
+	cert, err := tlsutil.GenerateSelfSignedCert()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TLS certificate: %w", err)
+	}
+	return &transport.Config{
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"talkers"},
+		},
+		IdleTimeout: framing.MaxIdleTimeout,
+	}, nil
+}
+
+// Start listens on every configured address and begins accepting connections.
+// If any address fails, listeners already opened are closed.
+func (s *Server) Start() error {
+	if len(s.cfg.Addrs) == 0 {
+		return errors.New("server: no listen addresses")
+	}
+	if err := s.cfg.Floor.Validate(); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+
+	tc := s.cfg.Transport
+	if tc == nil {
+		var err error
+		if tc, err = DefaultTransportConfig(); err != nil {
+			return err
+		}
+	}
+
+	// Create a listener for each address
+	for _, addr := range s.cfg.Addrs {
+		listener, err := transport.Listen(addr, tc)
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		s.listeners = append(s.listeners, listener)
+		s.addrs = append(s.addrs, listenAddr(addr, listener))
+		log.Printf("Server listening on %s", addr)
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	// Accept connections on each listener in its own goroutine
+	for _, listener := range s.listeners {
+		s.wg.Go(func() {
+			s.acceptLoop(listener)
+		})
+	}
+	return nil
+}
+
+// Stop closes the listeners and every client connection, and waits for the
+// connection handlers to exit.
+func (s *Server) Stop() {
+	if s.cancel == nil {
+		return
+	}
+
+	// Cancel context to stop accepting new connections and signal handlers to exit
+	s.cancel()
+	s.closeListeners()
+
+	// Close all client connections
+	s.registry.Close()
+	s.registry.floor.stop()
+
+	s.wg.Wait()
+	log.Println("Server shutdown complete")
+}
+
+// Addr returns the dialable address of the first listener, including its scheme.
+func (s *Server) Addr() string {
+	if len(s.addrs) == 0 {
+		return ""
+	}
+	return s.addrs[0]
+}
+
+// Addrs returns the dialable address of every listener, in configuration order.
+func (s *Server) Addrs() []string {
+	return s.addrs
+}
+
+// Registry returns the server's client registry.
+func (s *Server) Registry() *Registry {
+	return s.registry
+}
+
+// closeListeners closes and forgets all listeners
+func (s *Server) closeListeners() {
+	for _, listener := range s.listeners {
+		if err := listener.Close(); err != nil {
+			log.Printf("Error closing listener: %v", err)
+		}
+	}
+	s.listeners = nil
+}
+
+// acceptLoop accepts connections from listener until the server is stopped
+func (s *Server) acceptLoop(listener transport.Listener) {
+	for {
+		conn, err := listener.Accept(s.ctx)
+		if err != nil {
+			// Check if context was cancelled (graceful shutdown)
+			select {
+			case <-s.ctx.Done():
+				log.Printf("Accept loop for %s shutting down", listener.Addr())
+				return
+			default:
+			}
+			if errors.Is(err, transport.ErrClosed) {
+				log.Printf("Listener %s closed", listener.Addr())
+				return
+			}
+			log.Printf("Failed to accept connection: %v", err)
+			continue
+		}
+
+		log.Printf("New connection from %s", conn.RemoteAddr())
+
+		// Handle the connection; Stop closes it if it is still open
+		s.wg.Go(func() {
+			stop := context.AfterFunc(s.ctx, func() {
+				_ = conn.Close("server shutting down")
+			})
+			defer stop()
+			handleConnection(s.ctx, conn, s.registry)
+		})
+	}
+}
+
+// listenAddr returns addr with its host and port replaced by the listener's
+// actual address, so that port 0 resolves to the port in use
+func listenAddr(addr string, listener transport.Listener) string {
+	scheme, rest, found := strings.Cut(addr, "://")
+	if !found {
+		scheme, rest = transport.DefaultScheme, addr
+	}
+
+	// Keep a WebSocket path, if any
+	path := ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		path = rest[i:]
+	}
+	return scheme + "://" + listener.Addr().String() + path
+}
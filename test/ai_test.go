@@ -0,0 +1,357 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// TestConversationsIsolated verifies each peer's conversation only holds its own history
+func TestConversationsIsolated(t *testing.T) {
+	conversations := ai.NewConversations()
+	conversations.Add("bob", "bob", "let's talk about boats")
+	conversations.Add("carol", "carol", "let's talk about cars")
+	conversations.Add("bob", "alice", "boats are great")
+
+	bob := conversations.Context("bob")
+	if len(bob) != 2 {
+		t.Fatalf("Expected 2 entries for bob, got %d", len(bob))
+	}
+	for _, entry := range bob {
+		if strings.Contains(entry, "cars") {
+			t.Errorf("Bob's conversation contains carol's history: %q", entry)
+		}
+	}
+	if bob[1] != "<alice>\nboats are great\n</alice>" {
+		t.Errorf("Unexpected entry format: %q", bob[1])
+	}
+
+	// The returned context is a copy
+	bob[0] = "changed"
+	if conversations.Context("bob")[0] == "changed" {
+		t.Error("Context returned the internal slice")
+	}
+
+	conversations.Clear("bob")
+	if got := conversations.Keys(); len(got) != 1 || got[0] != "carol" {
+		t.Errorf("Expected only carol after clearing bob, got %v", got)
+	}
+}
+
+// longConversation returns n entries of about 100 tokens each
+func longConversation(n int) []string {
+	entries := make([]string, n)
+	for i := range entries {
+		entries[i] = fmt.Sprintf("turn %d: %s", i, strings.Repeat("word ", 70))
+	}
+	return entries
+}
+
+// TestCountTokens verifies token estimates scale with text length
+func TestCountTokens(t *testing.T) {
+	short := ai.CountTokens("claude-sonnet-4", "hello")
+	long := ai.CountTokens("claude-sonnet-4", strings.Repeat("hello ", 1000))
+	if short < 1 || long < 1000 || long > 6000 {
+		t.Errorf("Unexpected token estimates: short=%d long=%d", short, long)
+	}
+	if ai.ContextWindow("unknown-model") != ai.DefaultContextWindow {
+		t.Errorf("Expected default context window for unknown model")
+	}
+}
+
+// TestContextStrategies verifies each strategy brings a conversation within budget
+func TestContextStrategies(t *testing.T) {
+	entries := longConversation(20)
+
+	t.Run("window", func(t *testing.T) {
+		conversations := ai.NewConversations()
+		for _, e := range entries {
+			conversations.Add("bob", "bob", e)
+		}
+		m := &ai.ContextManager{Model: "claude-sonnet-4", Strategy: ai.StrategyWindow, Budget: 1000}
+
+		query, err := conversations.Query(context.Background(), "bob", m, "")
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if len(query) == 0 || len(query) >= 20 || m.Tokens("", query) > 1000 {
+			t.Errorf("Window did not fit: %d entries, %d tokens", len(query), m.Tokens("", query))
+		}
+		if !strings.Contains(query[len(query)-1], "turn 19") {
+			t.Errorf("Window does not end with the latest turn")
+		}
+		if conversations.Len("bob") != 20 {
+			t.Errorf("Window strategy changed the stored history")
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		conversations := ai.NewConversations()
+		for _, e := range entries {
+			conversations.Add("bob", "bob", e)
+		}
+		m := &ai.ContextManager{Model: "claude-sonnet-4", Strategy: ai.StrategyDropOldest, Budget: 1000}
+
+		query, err := conversations.Query(context.Background(), "bob", m, "")
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if conversations.Len("bob") != len(query) || len(query) >= 20 {
+			t.Errorf("Expected the stored history to be cut to %d entries, got %d", len(query), conversations.Len("bob"))
+		}
+	})
+
+	t.Run("summarize", func(t *testing.T) {
+		conversations := ai.NewConversations()
+		for _, e := range entries {
+			conversations.Add("bob", "bob", e)
+		}
+		var summarized int
+		m := &ai.ContextManager{
+			Model:      "claude-sonnet-4",
+			Strategy:   ai.StrategySummarize,
+			Budget:     1000,
+			KeepRecent: 3,
+			Summarize: func(_ context.Context, old []string) (string, error) {
+				summarized = len(old)
+				return "bob talked about words", nil
+			},
+		}
+
+		query, err := conversations.Query(context.Background(), "bob", m, "")
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if summarized != 17 {
+			t.Errorf("Expected 17 entries summarized, got %d", summarized)
+		}
+		history := conversations.Context("bob")
+		if len(history) != 4 || !strings.Contains(history[0], "bob talked about words") {
+			t.Errorf("Expected a summary followed by 3 recent turns, got %d entries", len(history))
+		}
+		if len(query) != 4 {
+			t.Errorf("Expected the query to use the summarized history, got %d entries", len(query))
+		}
+	})
+}
+
+// TestGuard verifies each stop condition for automatic replies
+func TestGuard(t *testing.T) {
+	t.Run("max turns", func(t *testing.T) {
+		g := ai.NewGuard(ai.GuardConfig{MaxTurns: 2})
+		for i := range 2 {
+			if err := g.Check("bob", fmt.Sprintf("message %d", i)); err != nil {
+				t.Fatalf("Turn %d refused: %v", i, err)
+			}
+			_ = g.Record("bob", fmt.Sprintf("reply %d", i), 10)
+		}
+		if err := g.Check("bob", "message 2"); !errors.Is(err, ai.ErrMaxTurns) {
+			t.Errorf("Expected ErrMaxTurns, got %v", err)
+		}
+		if err := g.Check("bob", "message 3"); !errors.Is(err, ai.ErrStopped) {
+			t.Errorf("Expected ErrStopped once stopped, got %v", err)
+		}
+		if err := g.Check("carol", "hello"); err != nil {
+			t.Errorf("Other conversations should be unaffected, got %v", err)
+		}
+
+		g.Reset("bob")
+		if err := g.Check("bob", "message 4"); err != nil {
+			t.Errorf("Expected replies to resume after Reset, got %v", err)
+		}
+	})
+
+	t.Run("token budget", func(t *testing.T) {
+		g := ai.NewGuard(ai.GuardConfig{TokenBudget: 100})
+		_ = g.Record("bob", "a long reply", 150)
+		if err := g.Check("bob", "more"); !errors.Is(err, ai.ErrTokenBudget) {
+			t.Errorf("Expected ErrTokenBudget, got %v", err)
+		}
+	})
+
+	t.Run("repetition", func(t *testing.T) {
+		g := ai.NewGuard(ai.GuardConfig{RepeatWindow: 4})
+		if err := g.Check("bob", "Fine, thanks. How are you doing?"); err != nil {
+			t.Fatalf("First message refused: %v", err)
+		}
+		if err := g.Record("bob", "fine thanks -- how are you doing", 10); !errors.Is(err, ai.ErrRepetition) {
+			t.Errorf("Expected a reply echoing the peer to give ErrRepetition, got %v", err)
+		}
+
+		g.Reset("bob")
+		if err := g.Record("bob", "Let us talk about the weather today.", 10); err != nil {
+			t.Fatalf("First reply stopped the conversation: %v", err)
+		}
+		if err := g.Check("bob", "Let us talk about the weather today."); err != nil {
+			t.Errorf("Expected the peer's messages not to be checked, got %v", err)
+		}
+		if err := g.Record("bob", "LET US TALK about the weather, today!", 10); !errors.Is(err, ai.ErrRepetition) {
+			t.Errorf("Expected ErrRepetition, got %v", err)
+		}
+	})
+
+	t.Run("human repeats", func(t *testing.T) {
+		g := ai.NewGuard(ai.GuardConfig{RepeatWindow: 4})
+		for i := range 6 {
+			if err := g.Check("bob", "ok"); err != nil {
+				t.Fatalf("Message %d refused: %v", i+1, err)
+			}
+			if err := g.Record("bob", "Ok.", 10); err != nil {
+				t.Fatalf("Short reply %d stopped the conversation: %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("end marker", func(t *testing.T) {
+		g := ai.NewGuard(ai.GuardConfig{EndMarker: ai.DefaultEndMarker})
+		if err := g.Record("bob", "Goodbye! "+ai.DefaultEndMarker, 10); !errors.Is(err, ai.ErrEndMarker) {
+			t.Errorf("Expected ErrEndMarker, got %v", err)
+		}
+		if g.Stopped("bob") == nil {
+			t.Errorf("Expected the conversation to be stopped")
+		}
+		if got := g.StripMarker("Goodbye! " + ai.DefaultEndMarker); got != "Goodbye!" {
+			t.Errorf("StripMarker = %q", got)
+		}
+
+		// The marker is removed from a stream even when split across pieces
+		var sent strings.Builder
+		filter := g.NewMarkerFilter(func(chunk string) error {
+			sent.WriteString(chunk)
+			return nil
+		})
+		for _, chunk := range []string{"Bye <", "<EN", "D>> a < b <<", ""} {
+			if err := filter.Write(chunk); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+		}
+		if err := filter.Flush(); err != nil || sent.String() != "Bye  a < b <<" {
+			t.Errorf("Filtered stream = %q, %v", sent.String(), err)
+		}
+	})
+
+	t.Run("cooldown", func(t *testing.T) {
+		g := ai.NewGuard(ai.GuardConfig{Cooldown: 50 * time.Millisecond})
+		_ = g.Record("bob", "reply", 10)
+		if err := g.Check("bob", "quick"); !errors.Is(err, ai.ErrCooldown) {
+			t.Errorf("Expected ErrCooldown, got %v", err)
+		}
+		time.Sleep(60 * time.Millisecond)
+		if err := g.Check("bob", "later"); err != nil {
+			t.Errorf("Expected a reply after the cooldown, got %v", err)
+		}
+	})
+}
+
+// TestAgentEndMarker verifies an agent sends its reply without the end marker and
+// then stops answering
+func TestAgentEndMarker(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	p := agentProfile("bob", "fake:template=Goodbye for now "+ai.DefaultEndMarker)
+	p.Server = addr
+	logs := &logRecorder{}
+	bob, err := agent.New(p, agent.Hooks{Logf: logs.logf})
+	if err != nil {
+		t.Fatalf("agent.New failed: %v", err)
+	}
+	if err := bob.Start(context.Background(), nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer bob.Close()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer alice.Close()
+	send(t, alice, "bob", "see you")
+	if msg := receiveMessage(t, alice); msg.Content != "Goodbye for now " {
+		t.Errorf("Expected the reply without the marker, got %q", msg.Content)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !logs.contains(ai.ErrEndMarker.Error()) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(bob.Guard().Stopped("alice"), ai.ErrEndMarker) {
+		t.Errorf("Expected the conversation to end, got %v", bob.Guard().Stopped("alice"))
+	}
+	for _, line := range bob.Conversations().Context("alice") {
+		if strings.Contains(line, ai.DefaultEndMarker) {
+			t.Errorf("Marker kept in the conversation: %q", line)
+		}
+	}
+}
+
+// blockingClient is an LLM client whose queries wait until their context ends
+type blockingClient struct{}
+
+func (blockingClient) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func (blockingClient) Close() error { return nil }
+
+// TestAIQueryCancel verifies an in-flight query is abandoned when its context ends
+func TestAIQueryCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ai.AIQueryStream(ctx, blockingClient{}, "", []string{"hello"}, "claude-sonnet-4", func(string) error { return nil })
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Query was not abandoned when its context ended")
+	}
+}
+
+// TestSystemPrompt verifies system prompt templates are rendered per query
+func TestSystemPrompt(t *testing.T) {
+	text := "You are {{.Self}}, talking with {{.Peer}} in {{.Room}} on {{.Date}}. Others: {{join .Peers \", \"}}."
+	prompt, err := ai.ParseSystemPrompt("persona.txt", text)
+	if err != nil {
+		t.Fatalf("ParseSystemPrompt failed: %v", err)
+	}
+
+	got, err := prompt.Render(ai.PromptVars{
+		Self:  "alice",
+		Peer:  "bob",
+		Peers: []string{"bob", "carol"},
+		Room:  "lobby",
+		Now:   time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "You are alice, talking with bob in lobby on 2026-03-14. Others: bob, carol."
+	if got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+
+	plain, err := ai.ParseSystemPrompt("plain.txt", "Be helpful.")
+	if err != nil {
+		t.Fatalf("ParseSystemPrompt failed for plain text: %v", err)
+	}
+	if got, _ := plain.Render(ai.PromptVars{}); got != "Be helpful." {
+		t.Errorf("Plain prompt rendered as %q", got)
+	}
+
+	if _, err := ai.ParseSystemPrompt("bad.txt", "Hello {{.Nickname}}"); err == nil {
+		t.Error("Expected an error for an unknown variable")
+	}
+}
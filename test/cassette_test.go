@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// recordCassette records two successful queries and one failure from a fake model
+func recordCassette(t *testing.T) string {
+	t.Helper()
+
+	fake, err := ai.NewFakeClient("fake:template=answer {{.Turn}} to {{.Last}}?fail-every=3")
+	if err != nil {
+		t.Fatalf("Failed to create fake client: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := ai.NewRecorder(fake, path)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, question := range []string{"one", "two", "three"} {
+		_, _ = ai.AIQuery(ctx, recorder, "system", ai.AIAddContext(nil, "bob", question), "fake")
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Failed to close recorder: %v", err)
+	}
+	return path
+}
+
+// TestCassetteRecord verifies every query is recorded with its outcome
+func TestCassetteRecord(t *testing.T) {
+	interactions, err := ai.LoadCassette(recordCassette(t))
+	if err != nil {
+		t.Fatalf("Failed to load cassette: %v", err)
+	}
+	if len(interactions) != 3 {
+		t.Fatalf("Expected 3 interactions, got %d", len(interactions))
+	}
+	if interactions[0].Response != "answer 1 to one" || interactions[0].System != "system" || interactions[0].Model != "fake" {
+		t.Errorf("Unexpected first interaction: %+v", interactions[0])
+	}
+	if interactions[2].Error == "" || interactions[2].Response != "" {
+		t.Errorf("Expected the third interaction to record a failure: %+v", interactions[2])
+	}
+}
+
+// TestCassetteReplay verifies recorded responses are replayed, matched by query
+func TestCassetteReplay(t *testing.T) {
+	path := recordCassette(t)
+	ctx := context.Background()
+
+	replayer, err := ai.NewReplayer(path, false)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+
+	// Out of order queries are matched to their recordings
+	got, err := ai.AIQuery(ctx, replayer, "system", ai.AIAddContext(nil, "bob", "two"), "fake")
+	if err != nil || got != "answer 2 to two" {
+		t.Errorf("Replayed %q, %v; want %q", got, err, "answer 2 to two")
+	}
+	if _, err := ai.AIQuery(ctx, replayer, "system", ai.AIAddContext(nil, "bob", "three"), "fake"); err == nil {
+		t.Error("Expected the recorded failure to be replayed")
+	}
+
+	// An unknown query gets the next unused recording
+	got, _ = ai.AIQuery(ctx, replayer, "system", ai.AIAddContext(nil, "bob", "other"), "fake")
+	if got != "answer 1 to one" {
+		t.Errorf("Replayed %q for an unrecorded query", got)
+	}
+	if _, err := ai.AIQuery(ctx, replayer, "system", nil, "fake"); !errors.Is(err, ai.ErrCassetteExhausted) {
+		t.Errorf("Expected ErrCassetteExhausted, got %v", err)
+	}
+}
+
+// TestCassetteReplayStrict verifies strict replay rejects queries that differ from
+// the recording
+func TestCassetteReplayStrict(t *testing.T) {
+	path := recordCassette(t)
+	ctx := context.Background()
+
+	replayer, err := ai.NewReplayer(path, true)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+	if _, err := ai.AIQuery(ctx, replayer, "system", ai.AIAddContext(nil, "bob", "two"), "fake"); !errors.Is(err, ai.ErrCassetteMismatch) {
+		t.Errorf("Expected ErrCassetteMismatch for an out of order query, got %v", err)
+	}
+	got, err := ai.AIQuery(ctx, replayer, "system", ai.AIAddContext(nil, "bob", "one"), "fake")
+	if err != nil || got != "answer 1 to one" {
+		t.Errorf("Replayed %q, %v; want %q", got, err, "answer 1 to one")
+	}
+	if replayer.Remaining() != 2 {
+		t.Errorf("Expected 2 recordings remaining, got %d", replayer.Remaining())
+	}
+}
@@ -0,0 +1,512 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	errs "github.com/dmh2000/talkers/internal/errors"
+	"github.com/dmh2000/talkers/internal/framing"
+	"github.com/dmh2000/talkers/internal/transport"
+	"github.com/dmh2000/talkers/server"
+)
+
+// dialTestClient connects an SDK client to the server at addr
+func dialTestClient(t *testing.T, addr, id string, opts *client.Options) *client.Client {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := client.Dial(ctx, addr, id, opts)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", id, err)
+	}
+	return c
+}
+
+// receiveMessage waits for the next message delivered to c
+func receiveMessage(t *testing.T, c *client.Client) *client.Message {
+	t.Helper()
+
+	select {
+	case msg, ok := <-c.Messages():
+		if !ok {
+			t.Fatalf("Messages channel closed: %v", c.Err())
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+	return nil
+}
+
+// receiveEvent waits for the next event of type want delivered to c
+func receiveEvent(t *testing.T, c *client.Client, want client.EventType) client.Event {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-c.Events():
+			if !ok {
+				t.Fatalf("Events channel closed waiting for %v", want)
+			}
+			if ev.Type == want {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %v event", want)
+		}
+	}
+}
+
+// TestClientSDKSend verifies messages sent with the SDK are delivered to another SDK client
+func TestClientSDKSend(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+	defer func() { _ = bob.Close() }()
+
+	if err := alice.Send(context.Background(), "bob", "Hello Bob!"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	msg := receiveMessage(t, bob)
+	if msg.From != "alice" || msg.Content != "Hello Bob!" {
+		t.Errorf("Expected message from alice with content %q, got %+v", "Hello Bob!", msg)
+	}
+}
+
+// TestClientSDKDialTimeout verifies Dial gives up when its context ends while
+// the server has not answered the registration
+func TestClientSDKDialTimeout(t *testing.T) {
+	listener, err := transport.Listen("mem://", nil)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	// Accept connections and their control streams but never answer
+	go func() {
+		for {
+			conn, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go func() { _, _ = conn.AcceptStream(context.Background()) }()
+		}
+	}()
+	addr := "mem://" + listener.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := client.Dial(ctx, addr, "alice", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Dial to time out, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := client.Dial(ctx, addr, "alice", nil); !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Errorf("Expected Dial to be cancelled, got %v after %v", err, time.Since(start))
+	}
+}
+
+// TestClientSDKControl verifies pings, delivery acks and presence notices on the
+// control stream
+func TestClientSDKControl(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+
+	if ev := receiveEvent(t, alice, client.EventJoined); ev.From != "bob" {
+		t.Errorf("Expected bob to join, got %q", ev.From)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if rtt, err := alice.Ping(ctx); err != nil || rtt <= 0 {
+		t.Errorf("Ping = %v, %v", rtt, err)
+	}
+
+	if err := alice.SendAcked(ctx, &client.Message{To: "bob", Content: "hi"}); err != nil {
+		t.Errorf("SendAcked failed: %v", err)
+	}
+	if msg := receiveMessage(t, bob); msg.Content != "hi" {
+		t.Errorf("Unexpected message %q", msg.Content)
+	}
+	var serverErr *client.ServerError
+	if err := alice.SendAcked(ctx, &client.Message{To: "nobody", Content: "hi"}); !errors.As(err, &serverErr) || serverErr.Message != errs.ErrClientNotRegistered {
+		t.Errorf("Expected %q from SendAcked, got %v", errs.ErrClientNotRegistered, err)
+	}
+
+	_ = bob.Close()
+	if ev := receiveEvent(t, alice, client.EventLeft); ev.From != "bob" {
+		t.Errorf("Expected bob to leave, got %q", ev.From)
+	}
+}
+
+// TestClientSDKRoster verifies clients learn the room's name and can list who
+// is connected
+func TestClientSDKRoster(t *testing.T) {
+	srv := server.New(server.Config{Addrs: []string{"mem://"}, Room: "lobby"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+
+	alice := dialTestClient(t, srv.Addr(), "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, srv.Addr(), "bob", nil)
+	if alice.Room() != "lobby" {
+		t.Errorf("Expected room lobby, got %q", alice.Room())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	roster, err := alice.Roster(ctx)
+	if err != nil || !slices.Equal(roster, []string{"alice", "bob"}) {
+		t.Errorf("Roster = %q, %v", roster, err)
+	}
+
+	_ = bob.Close()
+	receiveEvent(t, alice, client.EventLeft)
+	if roster, err := alice.Roster(ctx); err != nil || !slices.Equal(roster, []string{"alice"}) {
+		t.Errorf("Roster after bob left = %q, %v", roster, err)
+	}
+}
+
+// TestClientSDKOrder verifies messages from one sender are delivered in the order
+// sent, whatever their size or whether they were streamed
+func TestClientSDKOrder(t *testing.T) {
+	for _, listen := range []string{"mem://", "quic://127.0.0.1:0"} {
+		t.Run(strings.Split(listen, ":")[0], func(t *testing.T) {
+			addr, shutdown := startTestServer(t, listen)
+			defer shutdown()
+
+			alice := dialTestClient(t, addr, "alice", nil)
+			defer func() { _ = alice.Close() }()
+			bob := dialTestClient(t, addr, "bob", nil)
+			defer func() { _ = bob.Close() }()
+
+			ctx := context.Background()
+			const count = 30
+			for i := range count {
+				content := fmt.Sprintf("message %d", i)
+				var err error
+				switch i % 3 {
+				case 0:
+					err = alice.Send(ctx, "bob", content+strings.Repeat(".", 200000))
+				case 1:
+					err = alice.Send(ctx, "bob", content)
+				default:
+					w := alice.NewStream(ctx, "bob", nil)
+					if err = w.Write(content); err == nil {
+						err = w.Close(nil)
+					}
+				}
+				if err != nil {
+					t.Fatalf("Send %d failed: %v", i, err)
+				}
+			}
+
+			for i := range count {
+				msg := receiveMessage(t, bob)
+				if want := fmt.Sprintf("message %d", i); !strings.HasPrefix(msg.Content, want) || len(msg.Content) > len(want) && msg.Content[len(want)] != '.' {
+					t.Fatalf("Message %d out of order: got %.20q", i, msg.Content)
+				}
+			}
+		})
+	}
+}
+
+// TestClientSDKDuplicateID verifies Dial returns the server's rejection
+func TestClientSDKDuplicateID(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+
+	_, err := client.Dial(context.Background(), addr, "alice", nil)
+	if err == nil || !strings.Contains(err.Error(), errs.ErrDuplicateClientID) {
+		t.Errorf("Expected duplicate ID error, got: %v", err)
+	}
+}
+
+// TestClientSDKServerError verifies routing errors are reported as events
+// without closing the connection
+func TestClientSDKServerError(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+
+	if err := alice.Send(context.Background(), "nobody", "hello?"); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	ev := receiveEvent(t, alice, client.EventServerError)
+	var serverErr *client.ServerError
+	if !errors.As(ev.Err, &serverErr) || serverErr.Message != errs.ErrClientNotRegistered {
+		t.Errorf("Expected %q server error, got: %v", errs.ErrClientNotRegistered, ev.Err)
+	}
+
+	select {
+	case <-alice.Done():
+		t.Error("Connection closed after server error")
+	default:
+	}
+}
+
+// TestClientSDKStream verifies streamed messages are reported chunk by chunk and
+// delivered assembled
+func TestClientSDKStream(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	var mu sync.Mutex
+	var chunks []string
+	ended := false
+	onChunk := func(c client.Chunk) {
+		mu.Lock()
+		defer mu.Unlock()
+		if c.End {
+			ended = c.Err == nil
+			return
+		}
+		chunks = append(chunks, c.Content)
+	}
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", &client.Options{OnChunk: onChunk})
+	defer func() { _ = bob.Close() }()
+
+	w := alice.NewStream(context.Background(), "bob", nil)
+	for _, chunk := range []string{"Hello ", "from ", "a stream"} {
+		if err := w.Write(chunk); err != nil {
+			t.Fatalf("Stream write failed: %v", err)
+		}
+	}
+	if err := w.Close(nil); err != nil {
+		t.Fatalf("Stream close failed: %v", err)
+	}
+
+	msg := receiveMessage(t, bob)
+	if msg.Content != "Hello from a stream" || msg.StreamID != w.StreamID() {
+		t.Errorf("Unexpected streamed message: %+v", msg)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(chunks, "|") != "Hello |from |a stream" || !ended {
+		t.Errorf("Expected three chunks and a clean end, got %q (ended=%v)", chunks, ended)
+	}
+}
+
+// TestClientSDKSendFile verifies a file larger than one chunk arrives intact and
+// can be saved
+func TestClientSDKSendFile(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	dir := t.TempDir()
+	data := make([]byte, framing.AttachmentChunkSize*2+1234)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	path := filepath.Join(dir, "blob.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+	defer func() { _ = bob.Close() }()
+
+	sendErr := make(chan error, 1)
+	go func() {
+		_, err := alice.SendFile(context.Background(), "bob", path)
+		sendErr <- err
+	}()
+
+	msg := receiveMessage(t, bob)
+	if err := <-sendErr; err != nil {
+		t.Fatalf("SendFile failed: %v", err)
+	}
+	if !msg.IsAttachment() || msg.Filename != "blob.bin" || !bytes.Equal(msg.Data, data) {
+		t.Fatalf("Attachment not delivered intact: %s, %d bytes", msg.Filename, len(msg.Data))
+	}
+
+	saved, err := client.SaveAttachment(filepath.Join(dir, "received"), msg)
+	if err != nil {
+		t.Fatalf("SaveAttachment failed: %v", err)
+	}
+	got, err := os.ReadFile(saved)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Saved attachment does not match: %v", err)
+	}
+}
+
+// TestClientSDKClose verifies Close ends the connection and closes the channels
+func TestClientSDKClose(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	if err := alice.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	ev := receiveEvent(t, alice, client.EventDisconnected)
+	if ev.Err != nil {
+		t.Errorf("Expected clean disconnect, got: %v", ev.Err)
+	}
+
+	select {
+	case _, ok := <-alice.Messages():
+		if ok {
+			t.Error("Expected Messages channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Messages channel not closed after Close")
+	}
+}
+
+// TestRequestReply verifies Request returns the peer's reply, whether sent as a
+// single message or streamed, and that replies are not delivered on Messages
+func TestRequestReply(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+	defer func() { _ = bob.Close() }()
+
+	// Bob answers the first request with a message and the second with a stream
+	go func() {
+		ctx := context.Background()
+		req := <-bob.Messages()
+		_ = bob.Reply(ctx, req, "answer to "+req.Content)
+
+		req = <-bob.Messages()
+		w := bob.NewStream(ctx, req.From, &client.Message{ReplyTo: req.RequestID})
+		_ = w.Write("streamed ")
+		_ = w.Write("answer")
+		_ = w.Close(nil)
+	}()
+
+	ctx := context.Background()
+	answer, err := alice.Request(ctx, "bob", "question 1", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if answer.From != "bob" || answer.Content != "answer to question 1" {
+		t.Errorf("Unexpected reply: %+v", answer)
+	}
+
+	answer, err = alice.Request(ctx, "bob", "question 2", 5*time.Second)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if answer.Content != "streamed answer" {
+		t.Errorf("Unexpected streamed reply: %+v", answer)
+	}
+
+	select {
+	case msg := <-alice.Messages():
+		t.Errorf("Reply also delivered on Messages: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestRequestTimeout verifies the server reports a request the peer never answers
+func TestRequestTimeout(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+	defer func() { _ = bob.Close() }()
+
+	start := time.Now()
+	_, err := alice.Request(context.Background(), "bob", "anyone there?", 200*time.Millisecond)
+	if !errors.Is(err, client.ErrRequestTimeout) {
+		t.Fatalf("Expected ErrRequestTimeout, got: %v", err)
+	}
+	// The server's notice arrives well before the client's own fallback
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Timeout took %v, expected the server to report it", elapsed)
+	}
+}
+
+// TestRequestPeerUnreachable verifies requests fail when the peer disconnects or
+// is not registered
+func TestRequestPeerUnreachable(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+
+	// Bob disconnects once the request reaches him
+	go func() {
+		<-bob.Messages()
+		_ = bob.Close()
+	}()
+
+	_, err := alice.Request(context.Background(), "bob", "are you leaving?", 5*time.Second)
+	if !errors.Is(err, client.ErrPeerUnreachable) {
+		t.Errorf("Expected ErrPeerUnreachable, got: %v", err)
+	}
+
+	_, err = alice.Request(context.Background(), "nobody", "hello?", 5*time.Second)
+	var serverErr *client.ServerError
+	if !errors.As(err, &serverErr) || serverErr.Message != errs.ErrClientNotRegistered {
+		t.Errorf("Expected %q, got: %v", errs.ErrClientNotRegistered, err)
+	}
+}
+
+// TestMessageMentions verifies @-mentions match whole client IDs only
+func TestMessageMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"@alice what do you think?", true},
+		{"what do you think, @alice?", true},
+		{"hey @alice", true},
+		{"@alicia are you there?", false},
+		{"mail alice@alice.example", false},
+		{"no mention here", false},
+		{"@bob and then @alice", true},
+	}
+	for _, tt := range tests {
+		msg := &client.Message{Content: tt.content}
+		if got := msg.Mentions("alice"); got != tt.want {
+			t.Errorf("Mentions(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
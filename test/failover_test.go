@@ -0,0 +1,168 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// logRecorder collects Failover log lines
+type logRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *logRecorder) logf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func (l *logRecorder) contains(text string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorClient fails every query with err
+type errorClient struct {
+	err     error
+	queries int
+}
+
+func (c *errorClient) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	c.queries++
+	return "", c.err
+}
+
+func (c *errorClient) Close() error { return nil }
+
+// newTestFailover wraps the fake model primary with fast retries
+func newTestFailover(t *testing.T, primary string, cfg ai.FailoverConfig) (*ai.Failover, *ai.FakeClient, *logRecorder) {
+	t.Helper()
+	fake, err := ai.NewFakeClient(primary)
+	if err != nil {
+		t.Fatalf("Failed to create fake client: %v", err)
+	}
+	logs := &logRecorder{}
+	cfg.BaseDelay = time.Millisecond
+	cfg.MaxDelay = 5 * time.Millisecond
+	cfg.Logf = logs.logf
+	f, err := ai.NewFailover(fake, primary, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create failover: %v", err)
+	}
+	return f, fake, logs
+}
+
+// TestFailoverRetry verifies transient failures are retried until one succeeds
+func TestFailoverRetry(t *testing.T) {
+	primary := "fake:template=ok?fail-first=2"
+	f, fake, logs := newTestFailover(t, primary, ai.FailoverConfig{MaxAttempts: 3})
+
+	got, err := ai.AIQuery(context.Background(), f, "", []string{"hi"}, primary)
+	if err != nil || got != "ok" {
+		t.Fatalf("Query returned %q, %v", got, err)
+	}
+	if fake.Queries() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", fake.Queries())
+	}
+	if !logs.contains("succeeded on attempt 3") {
+		t.Errorf("Expected the successful retry to be logged, got %v", logs.lines)
+	}
+}
+
+// TestFailoverFallback verifies a failing model hands over to the next in order
+func TestFailoverFallback(t *testing.T) {
+	primary := "fake:echo?fail-every=1"
+	f, fake, logs := newTestFailover(t, primary, ai.FailoverConfig{
+		MaxAttempts: 2,
+		Fallbacks:   []string{"fake:template=backup"},
+	})
+
+	got, err := ai.AIQuery(context.Background(), f, "", []string{"hi"}, primary)
+	if err != nil || got != "backup" {
+		t.Fatalf("Query returned %q, %v", got, err)
+	}
+	if fake.Queries() != 2 {
+		t.Errorf("Expected 2 attempts on the primary, got %d", fake.Queries())
+	}
+	if !logs.contains("answered by fallback model fake:template=backup") {
+		t.Errorf("Expected the answering model to be logged, got %v", logs.lines)
+	}
+
+	if _, err := ai.NewFailover(fake, primary, ai.FailoverConfig{Fallbacks: []string{"no-such-model"}}); err == nil {
+		t.Error("Expected an error for a fallback of unknown provider")
+	}
+}
+
+// TestFailoverPermanentError verifies non-transient errors are not retried
+func TestFailoverPermanentError(t *testing.T) {
+	primary := &errorClient{err: errors.New("401 unauthorized: invalid x-api-key")}
+	f, err := ai.NewFailover(primary, "claude-sonnet-4", ai.FailoverConfig{MaxAttempts: 3, Logf: (&logRecorder{}).logf})
+	if err != nil {
+		t.Fatalf("Failed to create failover: %v", err)
+	}
+	if _, err := ai.AIQuery(context.Background(), f, "", []string{"hi"}, "claude-sonnet-4"); err == nil {
+		t.Fatal("Expected the query to fail")
+	}
+	if primary.queries != 1 {
+		t.Errorf("Expected a single attempt, got %d", primary.queries)
+	}
+}
+
+// TestFailoverCircuitBreaker verifies a model that keeps failing is skipped
+func TestFailoverCircuitBreaker(t *testing.T) {
+	primary := "fake:echo?fail-every=1"
+	f, fake, logs := newTestFailover(t, primary, ai.FailoverConfig{
+		MaxAttempts:      1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+
+	for range 3 {
+		_, _ = ai.AIQuery(context.Background(), f, "", []string{"hi"}, primary)
+	}
+	_, err := ai.AIQuery(context.Background(), f, "", []string{"hi"}, primary)
+	if !errors.Is(err, ai.ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if fake.Queries() != 2 {
+		t.Errorf("Expected the open breaker to stop queries after 2, got %d", fake.Queries())
+	}
+	if !logs.contains("pausing it") {
+		t.Errorf("Expected the breaker opening to be logged, got %v", logs.lines)
+	}
+}
+
+// TestIsTransient verifies which errors are worth retrying
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("429 Too Many Requests"), true},
+		{errors.New("anthropic: overloaded_error"), true},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), true},
+		{context.Canceled, false},
+		{errors.New("400 invalid request"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := ai.IsTransient(tt.err); got != tt.want {
+			t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
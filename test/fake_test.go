@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// queryFake sends one query with context entries from bob to a fake client
+func queryFake(t *testing.T, c ai.Client, entries ...string) (string, error) {
+	t.Helper()
+	var queryContext []string
+	for _, entry := range entries {
+		queryContext = ai.AIAddContext(queryContext, "bob", entry)
+	}
+	return ai.AIQuery(context.Background(), c, "be brief", queryContext, "")
+}
+
+// TestFakeModes verifies the echo, script and template responses
+func TestFakeModes(t *testing.T) {
+	echo, err := ai.AIClient("fake:echo")
+	if err != nil {
+		t.Fatalf("Failed to create echo client: %v", err)
+	}
+	if got, _ := queryFake(t, echo, "first", "hello there"); got != "hello there" {
+		t.Errorf("Echo replied %q, want %q", got, "hello there")
+	}
+
+	script := filepath.Join(t.TempDir(), "script.txt")
+	if err := os.WriteFile(script, []byte("one\n---\ntwo\nlines\n---\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	scripted, err := ai.AIClient("fake:script=" + script)
+	if err != nil {
+		t.Fatalf("Failed to create script client: %v", err)
+	}
+	for _, want := range []string{"one", "two\nlines", "one"} {
+		if got, _ := queryFake(t, scripted, "hi"); got != want {
+			t.Errorf("Script replied %q, want %q", got, want)
+		}
+	}
+
+	templated, err := ai.AIClient("fake:template=#{{.Turn}} {{.From}} asked: {{.Last}}?")
+	if err != nil {
+		t.Fatalf("Failed to create template client: %v", err)
+	}
+	if got, _ := queryFake(t, templated, "why"); got != "#1 bob asked: why?" {
+		t.Errorf("Template replied %q", got)
+	}
+
+	if _, err := ai.AIClient("fake:nonsense"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+// TestFakeFailuresAndLatency verifies scripted failures and latency
+func TestFakeFailuresAndLatency(t *testing.T) {
+	f, err := ai.NewFakeClient("fake:echo?fail-first=1&fail-every=3")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	var failed []int
+	for turn := 1; turn <= 6; turn++ {
+		if _, err := queryFake(t, f, "hi"); errors.Is(err, ai.ErrFakeFailure) {
+			failed = append(failed, turn)
+		}
+	}
+	if len(failed) != 3 || failed[0] != 1 || failed[1] != 3 || failed[2] != 6 {
+		t.Errorf("Expected queries 1, 3 and 6 to fail, got %v", failed)
+	}
+	if f.Queries() != 6 {
+		t.Errorf("Expected 6 queries counted, got %d", f.Queries())
+	}
+
+	slow, err := ai.NewFakeClient("fake:echo?latency=1s")
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ai.AIQuery(ctx, slow, "", []string{"hi"}, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the slow query to time out, got %v", err)
+	}
+}
+
+// runAgent answers each message c receives with its fake AI until guard stops the
+// conversation, the way the client command does
+func runAgent(c *client.Client, model ai.Client, guard *ai.Guard) {
+	conversations := ai.NewConversations()
+	for msg := range c.Messages() {
+		conversations.Add(msg.From, msg.From, msg.Content)
+		if guard.Check(msg.From, msg.Content) != nil {
+			continue
+		}
+		response, err := ai.AIQuery(context.Background(), model, "", conversations.Context(msg.From), "")
+		if err != nil {
+			continue
+		}
+		if err := c.Send(context.Background(), msg.From, response); err != nil {
+			return
+		}
+		conversations.Add(msg.From, c.ID(), response)
+		_ = guard.Record(msg.From, response, 0)
+	}
+}
+
+// TestFakeAgentConversation runs two AI clients against each other through a server
+// and verifies the turn limit ends their conversation
+func TestFakeAgentConversation(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer func() { _ = alice.Close() }()
+	bob := dialTestClient(t, addr, "bob", nil)
+	defer func() { _ = bob.Close() }()
+
+	aliceAI, _ := ai.NewFakeClient("fake:template=alice {{.Turn}}")
+	bobAI, _ := ai.NewFakeClient("fake:template=bob {{.Turn}} heard {{.Last}}")
+	bobGuard := ai.NewGuard(ai.GuardConfig{MaxTurns: 3})
+
+	go runAgent(alice, aliceAI, ai.NewGuard(ai.GuardConfig{MaxTurns: 10}))
+	go runAgent(bob, bobAI, bobGuard)
+
+	if err := alice.Send(context.Background(), "bob", "hello"); err != nil {
+		t.Fatalf("Failed to start the conversation: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !errors.Is(bobGuard.Stopped("alice"), ai.ErrMaxTurns) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Conversation did not stop: bob answered %d times", bobAI.Queries())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if bobAI.Queries() != 3 || aliceAI.Queries() != 3 {
+		t.Errorf("Expected 3 replies from each, got alice=%d bob=%d", aliceAI.Queries(), bobAI.Queries())
+	}
+	if !strings.Contains(bobGuard.Stopped("alice").Error(), "3") {
+		t.Errorf("Unexpected stop reason: %v", bobGuard.Stopped("alice"))
+	}
+}
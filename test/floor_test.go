@@ -0,0 +1,254 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/scenario"
+	"github.com/dmh2000/talkers/server"
+)
+
+// startFloorServer starts an in-memory server running floor control
+func startFloorServer(t *testing.T, floor server.FloorConfig) string {
+	t.Helper()
+
+	srv := server.New(server.Config{Addrs: []string{"mem://"}, Floor: floor})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	t.Cleanup(srv.Stop)
+	return srv.Addr()
+}
+
+// dialFloorClients connects a client for each id, closed when the test ends
+func dialFloorClients(t *testing.T, addr string, ids ...string) []*client.Client {
+	t.Helper()
+
+	var clients []*client.Client
+	for _, id := range ids {
+		c := dialTestClient(t, addr, id, nil)
+		t.Cleanup(func() { _ = c.Close() })
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// awaitHolder waits until c sees the turn held by holder
+func awaitHolder(t *testing.T, c *client.Client, holder string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		changed := c.TurnChanged()
+		if c.Turn().Holder == holder {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("%s: timed out waiting for %q to hold the turn (turn %+v)", c.ID(), holder, c.Turn())
+		}
+	}
+}
+
+// expectRejected waits for the server to reject a message from c for want
+func expectRejected(t *testing.T, c *client.Client, want error) {
+	t.Helper()
+
+	ev := receiveEvent(t, c, client.EventServerError)
+	if !errors.Is(ev.Err, want) {
+		t.Fatalf("%s: expected %v, got %v", c.ID(), want, ev.Err)
+	}
+}
+
+// send sends content from c to peer, failing the test on error
+func send(t *testing.T, c *client.Client, peer, content string) {
+	t.Helper()
+
+	if err := c.Send(context.Background(), peer, content); err != nil {
+		t.Fatalf("%s: send failed: %v", c.ID(), err)
+	}
+}
+
+// TestFloorRoundRobin verifies turns follow registration order and only the
+// holder's messages are routed
+func TestFloorRoundRobin(t *testing.T) {
+	addr := startFloorServer(t, server.FloorConfig{Mode: server.FloorRoundRobin})
+	clients := dialFloorClients(t, addr, "alice", "bob", "carol")
+	alice, bob, carol := clients[0], clients[1], clients[2]
+
+	// The floor starts free, so bob may take the first turn
+	if turn := alice.Turn(); turn.Mode != client.FloorRoundRobin || turn.Holder != "" {
+		t.Fatalf("Unexpected initial turn %+v", turn)
+	}
+	send(t, bob, "alice", "first")
+	if msg := receiveMessage(t, alice); msg.Content != "first" {
+		t.Fatalf("Expected first, got %q", msg.Content)
+	}
+
+	// The turn moves on to carol; alice must wait
+	awaitHolder(t, alice, "carol")
+	if alice.HasTurn() || !carol.HasTurn() {
+		t.Error("Expected only carol to hold the turn")
+	}
+	if ev := receiveEvent(t, alice, client.EventTurn); ev.Turn.Mode != client.FloorRoundRobin {
+		t.Errorf("Unexpected turn event %+v", ev)
+	}
+	send(t, alice, "bob", "out of turn")
+	expectRejected(t, alice, client.ErrNotYourTurn)
+
+	// carol passes and the turn wraps around to alice
+	if err := carol.PassTurn(""); err != nil {
+		t.Fatalf("PassTurn failed: %v", err)
+	}
+	awaitHolder(t, alice, "alice")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := alice.WaitTurn(ctx); err != nil {
+		t.Fatalf("WaitTurn failed: %v", err)
+	}
+	send(t, alice, "bob", "in turn")
+	if msg := receiveMessage(t, bob); msg.Content != "in turn" {
+		t.Fatalf("Expected in turn, got %q", msg.Content)
+	}
+
+	// A round-robin turn cannot be passed to a chosen client
+	awaitHolder(t, bob, "bob")
+	if err := bob.PassTurn("alice"); err != nil {
+		t.Fatalf("PassTurn failed: %v", err)
+	}
+	expectRejected(t, bob, client.ErrCannotPassTurn)
+}
+
+// TestFloorOneMessagePerTurn verifies two messages sent back to back on one
+// round-robin turn are not both routed: the first takes the turn
+func TestFloorOneMessagePerTurn(t *testing.T) {
+	addr := startFloorServer(t, server.FloorConfig{Mode: server.FloorRoundRobin})
+	clients := dialFloorClients(t, addr, "alice", "bob", "carol")
+	alice, carol := clients[0], clients[2]
+
+	send(t, alice, "carol", "first")
+	send(t, alice, "carol", "second")
+	expectRejected(t, alice, client.ErrNotYourTurn)
+	if msg := receiveMessage(t, carol); msg.Content != "first" {
+		t.Fatalf("Expected first, got %q", msg.Content)
+	}
+	select {
+	case msg := <-carol.Messages():
+		t.Fatalf("Expected one message on the turn, also got %q", msg.Content)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestFloorToken verifies the holder keeps the turn until it passes it
+func TestFloorToken(t *testing.T) {
+	addr := startFloorServer(t, server.FloorConfig{Mode: server.FloorToken})
+	clients := dialFloorClients(t, addr, "alice", "bob")
+	alice, bob := clients[0], clients[1]
+
+	// Sending on the free floor takes the token
+	send(t, alice, "bob", "one")
+	awaitHolder(t, bob, "alice")
+	send(t, alice, "bob", "two")
+	for _, want := range []string{"one", "two"} {
+		if msg := receiveMessage(t, bob); msg.Content != want {
+			t.Fatalf("Expected %q, got %q", want, msg.Content)
+		}
+	}
+	send(t, bob, "alice", "interrupt")
+	expectRejected(t, bob, client.ErrNotYourTurn)
+
+	if err := alice.PassTurn("bob"); err != nil {
+		t.Fatalf("PassTurn failed: %v", err)
+	}
+	awaitHolder(t, bob, "bob")
+	send(t, bob, "alice", "reply")
+	if msg := receiveMessage(t, alice); msg.Content != "reply" {
+		t.Fatalf("Expected reply, got %q", msg.Content)
+	}
+
+	if err := bob.PassTurn("nobody"); err != nil {
+		t.Fatalf("PassTurn failed: %v", err)
+	}
+	expectRejected(t, bob, client.ErrCannotPassTurn)
+}
+
+// TestFloorModerated verifies the moderator speaks freely and grants single turns
+func TestFloorModerated(t *testing.T) {
+	addr := startFloorServer(t, server.FloorConfig{Mode: server.FloorModerated, Moderator: "mod"})
+	clients := dialFloorClients(t, addr, "mod", "alice", "bob")
+	mod, alice, bob := clients[0], clients[1], clients[2]
+
+	if turn := alice.Turn(); turn.Moderator != "mod" || alice.HasTurn() || !mod.HasTurn() {
+		t.Fatalf("Unexpected initial turn %+v", turn)
+	}
+	send(t, alice, "bob", "uninvited")
+	expectRejected(t, alice, client.ErrNotYourTurn)
+
+	send(t, mod, "alice", "alice, your view?")
+	receiveMessage(t, alice)
+	if err := mod.PassTurn("alice"); err != nil {
+		t.Fatalf("PassTurn failed: %v", err)
+	}
+	awaitHolder(t, alice, "alice")
+
+	// The granted turn lasts for one message, then returns to the moderator
+	send(t, alice, "bob", "my view")
+	if msg := receiveMessage(t, bob); msg.Content != "my view" {
+		t.Fatalf("Expected my view, got %q", msg.Content)
+	}
+	awaitHolder(t, alice, "")
+	send(t, alice, "bob", "and another thing")
+	expectRejected(t, alice, client.ErrNotYourTurn)
+	send(t, mod, "bob", "moderator still speaks")
+	receiveMessage(t, bob)
+}
+
+// TestFloorTimeoutAndDisconnect verifies an unused turn moves on and a departing
+// holder's turn passes to the next client, and that the turn parks once every
+// client has passed
+func TestFloorTimeoutAndDisconnect(t *testing.T) {
+	addr := startFloorServer(t, server.FloorConfig{Mode: server.FloorRoundRobin, TurnTimeout: 500 * time.Millisecond})
+	clients := dialFloorClients(t, addr, "alice", "bob", "carol")
+	alice, bob, carol := clients[0], clients[1], clients[2]
+
+	send(t, alice, "bob", "hello")
+	awaitHolder(t, alice, "bob")
+	_ = bob.Close()
+	awaitHolder(t, alice, "carol")
+
+	// carol and alice let their turns time out, so the floor is freed
+	awaitHolder(t, alice, "alice")
+	awaitHolder(t, carol, "")
+	if !carol.HasTurn() {
+		t.Error("Expected a free floor to allow carol to send")
+	}
+}
+
+// TestRunScenarioFloor runs two agents taking round-robin turns
+func TestRunScenarioFloor(t *testing.T) {
+	s := fakeScenario()
+	s.Floor = scenario.Floor{Mode: "round-robin"}
+	tr, err := scenario.Run(context.Background(), s, &scenario.RunOptions{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	entries := tr.Entries()
+	if len(entries) != 5 {
+		t.Fatalf("Expected the opening and four replies, got %d entries: %v", len(entries), entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].From == entries[i-1].From {
+			t.Errorf("%s spoke twice in a row: %v", entries[i].From, entries)
+		}
+	}
+
+	s.Floor = scenario.Floor{Mode: "moderated"}
+	if err := s.Validate(); err == nil {
+		t.Error("Expected a moderated scenario to be rejected")
+	}
+}
@@ -2,12 +2,15 @@ package test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/binary"
 	"io"
 	"strings"
 	"testing"
 
 	"github.com/dmh2000/talkers/internal/framing"
 	pb "github.com/dmh2000/talkers/internal/proto"
+	"google.golang.org/protobuf/proto"
 )
 
 // mockStream implements io.ReadWriter for testing
@@ -279,3 +282,252 @@ func TestReadEnvelopeIncompletePayload(t *testing.T) {
 		t.Errorf("Expected EOF or payload error, got: %v", err)
 	}
 }
+
+// TestRoundTripCompressed tests compressed envelopes for each algorithm
+func TestRoundTripCompressed(t *testing.T) {
+	content := strings.Repeat("compressible ", 20000)
+
+	for _, c := range []framing.Compression{framing.CompressionGzip, framing.CompressionZstd} {
+		stream := newMockStream()
+
+		env := &pb.Envelope{
+			Payload: &pb.Envelope_Message{
+				Message: &pb.Message{
+					FromId:  "alice",
+					ToId:    "bob",
+					Content: content,
+				},
+			},
+		}
+
+		if err := framing.WriteEnvelopeCompressed(stream, env, c); err != nil {
+			t.Fatalf("%s: WriteEnvelopeCompressed failed: %v", c, err)
+		}
+
+		// The flags byte must be set and the frame smaller than the content
+		header := stream.Bytes()[:4]
+		if framing.Compression(header[0]) != c {
+			t.Errorf("%s: expected flags byte %d, got %d", c, c, header[0])
+		}
+		if stream.Len() >= len(content) {
+			t.Errorf("%s: expected compressed frame smaller than %d bytes, got %d", c, len(content), stream.Len())
+		}
+
+		readEnv, err := framing.ReadEnvelope(stream)
+		if err != nil {
+			t.Fatalf("%s: ReadEnvelope failed: %v", c, err)
+		}
+		if readEnv.GetMessage().GetContent() != content {
+			t.Errorf("%s: content mismatch after decompression", c)
+		}
+	}
+}
+
+// TestCompressionThreshold tests that small envelopes are sent uncompressed
+func TestCompressionThreshold(t *testing.T) {
+	stream := newMockStream()
+
+	env := &pb.Envelope{
+		Payload: &pb.Envelope_Message{
+			Message: &pb.Message{Content: "hi"},
+		},
+	}
+
+	if err := framing.WriteEnvelopeCompressed(stream, env, framing.CompressionZstd); err != nil {
+		t.Fatalf("WriteEnvelopeCompressed failed: %v", err)
+	}
+	if flags := stream.Bytes()[0]; flags != 0 {
+		t.Errorf("Expected uncompressed frame, got flags %d", flags)
+	}
+}
+
+// TestDecompressionBomb tests that a payload expanding past MaxDecompressedSize is rejected
+func TestDecompressionBomb(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(make([]byte, framing.MaxDecompressedSize+1))
+	_ = zw.Close()
+
+	stream := newMockStream()
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(framing.CompressionGzip)<<24|uint32(compressed.Len()))
+	stream.Write(header)
+	stream.Write(compressed.Bytes())
+
+	_, err := framing.ReadEnvelope(stream)
+	if err == nil {
+		t.Fatal("Expected error for oversized decompressed payload, got nil")
+	}
+	if !strings.Contains(err.Error(), "MaxDecompressedSize") {
+		t.Errorf("Expected MaxDecompressedSize error, got: %v", err)
+	}
+}
+
+// TestFrameWriterReader tests several envelopes through one FrameWriter and FrameReader
+func TestFrameWriterReader(t *testing.T) {
+	stream := newMockStream()
+	writer := framing.NewFrameWriter(stream, framing.CompressionZstd)
+	reader := framing.NewFrameReader(stream)
+
+	contents := []string{"first", strings.Repeat("second ", 5000), "third"}
+	for _, content := range contents {
+		env := &pb.Envelope{
+			Payload: &pb.Envelope_Message{
+				Message: &pb.Message{Content: content},
+			},
+		}
+		if err := writer.WriteEnvelope(env); err != nil {
+			t.Fatalf("WriteEnvelope failed: %v", err)
+		}
+	}
+
+	// Read them back; earlier results must not be clobbered by buffer reuse
+	var got []*pb.Envelope
+	for range contents {
+		env, err := reader.ReadEnvelope()
+		if err != nil {
+			t.Fatalf("ReadEnvelope failed: %v", err)
+		}
+		got = append(got, env)
+	}
+	for i, content := range contents {
+		if got[i].GetMessage().GetContent() != content {
+			t.Errorf("Envelope %d: content mismatch", i)
+		}
+	}
+}
+
+// countingWriter counts Write calls
+type countingWriter struct {
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return len(p), nil
+}
+
+// TestSingleWritePerFrame tests that each frame is written with one Write call
+func TestSingleWritePerFrame(t *testing.T) {
+	w := &countingWriter{}
+	env := &pb.Envelope{
+		Payload: &pb.Envelope_Message{
+			Message: &pb.Message{Content: "hello"},
+		},
+	}
+
+	if err := framing.WriteEnvelope(w, env); err != nil {
+		t.Fatalf("WriteEnvelope failed: %v", err)
+	}
+	if err := framing.NewFrameWriter(w, framing.CompressionNone).WriteEnvelope(env); err != nil {
+		t.Fatalf("FrameWriter.WriteEnvelope failed: %v", err)
+	}
+
+	if w.writes != 2 {
+		t.Errorf("Expected 2 writes for 2 frames, got %d", w.writes)
+	}
+}
+
+// benchmarkEnvelope is a typical chat message used by the framing benchmarks
+var benchmarkEnvelope = &pb.Envelope{
+	Payload: &pb.Envelope_Message{
+		Message: &pb.Message{
+			FromId:  "alice",
+			ToId:    "bob",
+			Content: strings.Repeat("benchmark content ", 64),
+		},
+	},
+}
+
+// legacyWriteEnvelope is the original framing write path (fresh buffers, two
+// writes per frame), kept as a baseline for the benchmarks
+func legacyWriteEnvelope(w io.Writer, env *pb.Envelope) error {
+	data, err := proto.Marshal(env)
+	if err != nil {
+		return err
+	}
+	lengthPrefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthPrefix, uint32(len(data)))
+	if _, err := w.Write(lengthPrefix); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// legacyReadEnvelope is the original framing read path, allocating a new
+// prefix and payload buffer per frame
+func legacyReadEnvelope(r io.Reader) (*pb.Envelope, error) {
+	lengthPrefix := make([]byte, 4)
+	if _, err := io.ReadFull(r, lengthPrefix); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(lengthPrefix))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	env := &pb.Envelope{}
+	return env, proto.Unmarshal(payload, env)
+}
+
+func BenchmarkWriteLegacy(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = legacyWriteEnvelope(io.Discard, benchmarkEnvelope)
+	}
+}
+
+func BenchmarkWriteEnvelope(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = framing.WriteEnvelope(io.Discard, benchmarkEnvelope)
+	}
+}
+
+func BenchmarkFrameWriter(b *testing.B) {
+	writer := framing.NewFrameWriter(io.Discard, framing.CompressionNone)
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = writer.WriteEnvelope(benchmarkEnvelope)
+	}
+}
+
+// encodedFrame returns benchmarkEnvelope framed once, for the read benchmarks
+func encodedFrame(b *testing.B) []byte {
+	var buf bytes.Buffer
+	if err := framing.WriteEnvelope(&buf, benchmarkEnvelope); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkReadLegacy(b *testing.B) {
+	frame := encodedFrame(b)
+	r := bytes.NewReader(frame)
+	b.ReportAllocs()
+	for b.Loop() {
+		r.Reset(frame)
+		_, _ = legacyReadEnvelope(r)
+	}
+}
+
+func BenchmarkReadEnvelope(b *testing.B) {
+	frame := encodedFrame(b)
+	r := bytes.NewReader(frame)
+	b.ReportAllocs()
+	for b.Loop() {
+		r.Reset(frame)
+		_, _ = framing.ReadEnvelope(r)
+	}
+}
+
+func BenchmarkFrameReader(b *testing.B) {
+	frame := encodedFrame(b)
+	r := bytes.NewReader(frame)
+	reader := framing.NewFrameReader(r)
+	b.ReportAllocs()
+	for b.Loop() {
+		r.Reset(frame)
+		_, _ = reader.ReadEnvelope()
+	}
+}
@@ -1,320 +1,128 @@
 package test
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"io"
-	"net"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/dmh2000/talkers/client"
 	errs "github.com/dmh2000/talkers/internal/errors"
 	"github.com/dmh2000/talkers/internal/framing"
 	pb "github.com/dmh2000/talkers/internal/proto"
-	"github.com/dmh2000/talkers/internal/tlsutil"
-	"github.com/quic-go/quic-go"
+	"github.com/dmh2000/talkers/internal/transport"
+	"github.com/dmh2000/talkers/server"
 )
 
-// Registry maintains a thread-safe map of client ID to ClientConn
-// (copied from server package for testing)
-type Registry struct {
-	clients map[string]*ClientConn
-}
-
-// ClientConn wraps a QUIC connection and stream for a registered client
-type ClientConn struct {
-	Connection *quic.Conn
-	Stream     *quic.Stream
-}
-
-// NewRegistry creates a new empty client registry
-func NewRegistry() *Registry {
-	return &Registry{
-		clients: make(map[string]*ClientConn),
-	}
-}
-
-// Add adds a new client to the registry
-func (r *Registry) Add(id string, conn *ClientConn) error {
-	if len(r.clients) >= 16 {
-		return errors.New(errs.ErrMaxClientsReached)
-	}
-	if _, exists := r.clients[id]; exists {
-		return errors.New(errs.ErrDuplicateClientID)
-	}
-	r.clients[id] = conn
-	return nil
-}
-
-// Remove removes a client from the registry by ID
-func (r *Registry) Remove(id string) {
-	delete(r.clients, id)
-}
-
-// Get retrieves a client connection by ID
-func (r *Registry) Get(id string) (*ClientConn, bool) {
-	conn, exists := r.clients[id]
-	return conn, exists
-}
-
-// Count returns the number of registered clients
-func (r *Registry) Count() int {
-	return len(r.clients)
-}
+// startTestServer starts a server on the in-memory transport, or on the given
+// listen addresses, and returns the address of its first listener
+func startTestServer(t *testing.T, addrs ...string) (addr string, shutdown func()) {
+	t.Helper()
 
-// Close closes all client connections and clears the registry
-func (r *Registry) Close() {
-	for _, conn := range r.clients {
-		if conn.Stream != nil {
-			_ = conn.Stream.Close()
-		}
-		if conn.Connection != nil {
-			_ = conn.Connection.CloseWithError(0, "server shutting down")
-		}
+	if len(addrs) == 0 {
+		addrs = []string{"mem://"}
 	}
-	r.clients = make(map[string]*ClientConn)
-}
 
-// handleConnection manages a single client connection lifecycle
-func handleConnection(ctx context.Context, conn *quic.Conn, registry *Registry) {
-	stream, err := conn.AcceptStream(ctx)
+	tc, err := server.DefaultTransportConfig()
 	if err != nil {
-		return
+		t.Fatalf("Failed to create transport config: %v", err)
 	}
+	tc.IdleTimeout = 30 * time.Second
 
-	var clientID string
-	defer func() {
-		if clientID != "" {
-			registry.Remove(clientID)
-		}
-		_ = stream.Close()
-	}()
-
-	// Read the first envelope - must be a Register message
-	env, err := framing.ReadEnvelope(stream)
-	if err != nil {
-		return
+	srv := server.New(server.Config{Addrs: addrs, Transport: tc})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
 	}
 
-	reg := env.GetRegister()
-	if reg == nil {
-		errorEnv := &pb.Envelope{
-			Payload: &pb.Envelope_Error{
-				Error: &pb.Error{
-					Error: errs.ErrInvalidFirstMessage,
-				},
-			},
-		}
-		_ = framing.WriteEnvelope(stream, errorEnv)
-		return
-	}
-
-	clientID = reg.From
-	if len(clientID) == 0 || len(clientID) > 32 {
-		errorEnv := &pb.Envelope{
-			Payload: &pb.Envelope_Error{
-				Error: &pb.Error{
-					Error: "client ID must be 1-32 characters",
-				},
-			},
-		}
-		_ = framing.WriteEnvelope(stream, errorEnv)
-		return
-	}
-
-	clientConn := &ClientConn{
-		Connection: conn,
-		Stream:     stream,
-	}
-
-	if err := registry.Add(clientID, clientConn); err != nil {
-		errorEnv := &pb.Envelope{
-			Payload: &pb.Envelope_Error{
-				Error: &pb.Error{
-					Error: err.Error(),
-				},
-			},
-		}
-		_ = framing.WriteEnvelope(stream, errorEnv)
-		clientID = ""
-		return
-	}
-
-	// Enter message loop
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-
-		env, err := framing.ReadEnvelope(stream)
-		if err != nil {
-			return
-		}
-
-		msg := env.GetMessage()
-		if msg == nil {
-			errorEnv := &pb.Envelope{
-				Payload: &pb.Envelope_Error{
-					Error: &pb.Error{
-						Error: errs.ErrUnexpectedMessage,
-					},
-				},
-			}
-			_ = framing.WriteEnvelope(stream, errorEnv)
-			return
-		}
-
-		if err := routeMessage(registry, clientID, msg); err != nil {
-			errorEnv := &pb.Envelope{
-				Payload: &pb.Envelope_Error{
-					Error: &pb.Error{
-						Error: err.Error(),
-					},
-				},
-			}
-			_ = framing.WriteEnvelope(stream, errorEnv)
-		}
-	}
+	return srv.Addr(), srv.Stop
 }
 
-// routeMessage validates and routes a message from sender to destination
-func routeMessage(registry *Registry, sender string, msg *pb.Message) error {
-	if len(msg.Content) > 250000 {
-		return errors.New(errs.ErrContentTooLarge)
-	}
-
-	msg.FromId = sender
-
-	destConn, exists := registry.Get(msg.ToId)
-	if !exists {
-		return errors.New(errs.ErrClientNotRegistered)
-	}
-
-	env := &pb.Envelope{
-		Payload: &pb.Envelope_Message{
-			Message: msg,
+// clientTransportConfig returns the transport configuration test clients dial with
+func clientTransportConfig() *transport.Config {
+	return &transport.Config{
+		TLS: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"talkers"},
 		},
+		IdleTimeout: 30 * time.Second,
 	}
-
-	if err := framing.WriteEnvelope(destConn.Stream, env); err != nil {
-		registry.Remove(msg.ToId)
-		return fmt.Errorf("%s: %w", errs.ErrClientDisconnected, err)
-	}
-
-	return nil
 }
 
-// startTestServer starts a QUIC server on a random port for testing
-func startTestServer(t *testing.T) (addr string, shutdown func()) {
+// dialServer connects to the server and opens the control stream without registering
+func dialServer(t *testing.T, serverAddr string) (transport.Conn, transport.Stream) {
 	t.Helper()
 
-	// Generate self-signed TLS certificate
-	cert, err := tlsutil.GenerateSelfSignedCert()
-	if err != nil {
-		t.Fatalf("Failed to generate TLS certificate: %v", err)
-	}
-
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		NextProtos:   []string{"talkers"},
-	}
-
-	quicConfig := &quic.Config{
-		MaxIdleTimeout: 30 * time.Second,
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	// Listen on random port
-	listener, err := quic.ListenAddr(":0", tlsConfig, quicConfig)
+	conn, err := transport.Dial(ctx, serverAddr, clientTransportConfig())
 	if err != nil {
-		t.Fatalf("Failed to create QUIC listener: %v", err)
+		t.Fatalf("Failed to dial server: %v", err)
 	}
 
-	// Get the actual address assigned by OS
-	addr = listener.Addr().String()
-
-	registry := NewRegistry()
-	ctx, cancel := context.WithCancel(context.Background())
-	done := make(chan struct{})
-
-	// Accept connections in a goroutine
-	go func() {
-		defer close(done)
-		for {
-			conn, err := listener.Accept(ctx)
-			if err != nil {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					continue
-				}
-			}
-			go handleConnection(ctx, conn, registry)
-		}
-	}()
-
-	shutdown = func() {
-		cancel()
-		_ = listener.Close()
-		registry.Close()
-		<-done
+	stream, err := conn.OpenStream(ctx)
+	if err != nil {
+		_ = conn.Close("failed to open stream")
+		t.Fatalf("Failed to open stream: %v", err)
 	}
 
-	return addr, shutdown
+	return conn, stream
 }
 
 // connectClient connects to the server and registers a client
-func connectClient(t *testing.T, clientID, serverAddr string) (*quic.Conn, *quic.Stream) {
+func connectClient(t *testing.T, clientID, serverAddr string) (transport.Conn, transport.Stream) {
 	t.Helper()
+	conn, stream, _ := connectClientWithCompression(t, clientID, serverAddr)
+	return conn, stream
+}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"talkers"},
-	}
-
-	quicConfig := &quic.Config{
-		MaxIdleTimeout: 30 * time.Second,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	conn, err := quic.DialAddr(ctx, serverAddr, tlsConfig, quicConfig)
-	if err != nil {
-		t.Fatalf("Failed to dial server: %v", err)
-	}
+// connectClientWithCompression registers a client offering the given compressions
+// and returns the compression the server chose
+func connectClientWithCompression(t *testing.T, clientID, serverAddr string, offered ...string) (transport.Conn, transport.Stream, string) {
+	t.Helper()
 
-	stream, err := conn.OpenStreamSync(ctx)
-	if err != nil {
-		_ = conn.CloseWithError(0, "failed to open stream")
-		t.Fatalf("Failed to open stream: %v", err)
-	}
+	conn, stream := dialServer(t, serverAddr)
 
 	// Send registration envelope
 	regEnv := &pb.Envelope{
 		Payload: &pb.Envelope_Register{
 			Register: &pb.Register{
-				From: clientID,
+				From:        clientID,
+				Compression: offered,
 			},
 		},
 	}
 
 	if err := framing.WriteEnvelope(stream, regEnv); err != nil {
 		_ = stream.Close()
-		_ = conn.CloseWithError(0, "failed to register")
+		_ = conn.Close("failed to register")
 		t.Fatalf("Failed to send registration: %v", err)
 	}
 
-	return conn, stream
+	// Wait for the registration acknowledgement
+	_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer func() { _ = stream.SetReadDeadline(time.Time{}) }()
+
+	env, err := framing.ReadEnvelope(stream)
+	if err != nil {
+		_ = conn.Close("failed to register")
+		t.Fatalf("Failed to read registration response: %v", err)
+	}
+	registered := env.GetRegistered()
+	if registered == nil {
+		_ = conn.Close("failed to register")
+		t.Fatalf("Expected Registered envelope, got: %v", env)
+	}
+
+	return conn, stream, registered.Compression
 }
 
-// sendMessage sends a message envelope through a stream
-func sendMessage(t *testing.T, stream *quic.Stream, to, content string) {
+// sendMessage sends a message envelope on a new unidirectional stream
+func sendMessage(t *testing.T, conn transport.Conn, to, content string) {
 	t.Helper()
 
 	msgEnv := &pb.Envelope{
@@ -326,18 +134,27 @@ func sendMessage(t *testing.T, stream *quic.Stream, to, content string) {
 		},
 	}
 
+	stream, err := conn.OpenUniStream(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open message stream: %v", err)
+	}
 	if err := framing.WriteEnvelope(stream, msgEnv); err != nil {
 		t.Fatalf("Failed to send message: %v", err)
 	}
+	_ = stream.Close()
 }
 
-// expectMessage reads and validates a message from the stream
-func expectMessage(t *testing.T, stream *quic.Stream, expectedFrom, expectedContent string) {
+// expectMessage accepts the next message stream and validates the message it carries
+func expectMessage(t *testing.T, conn transport.Conn, expectedFrom, expectedContent string) {
 	t.Helper()
 
-	// Set read deadline
-	_ = stream.SetReadDeadline(time.Now().Add(5 * time.Second))
-	defer func() { _ = stream.SetReadDeadline(time.Time{}) }()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := conn.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept message stream: %v", err)
+	}
 
 	env, err := framing.ReadEnvelope(stream)
 	if err != nil {
@@ -358,8 +175,8 @@ func expectMessage(t *testing.T, stream *quic.Stream, expectedFrom, expectedCont
 	}
 }
 
-// expectError reads and validates an error from the stream
-func expectError(t *testing.T, stream *quic.Stream, expectedError string) {
+// expectError reads and validates an error from the stream, skipping presence notices
+func expectError(t *testing.T, stream transport.Stream, expectedError string) {
 	t.Helper()
 
 	// Set read deadline
@@ -367,6 +184,9 @@ func expectError(t *testing.T, stream *quic.Stream, expectedError string) {
 	defer func() { _ = stream.SetReadDeadline(time.Time{}) }()
 
 	env, err := framing.ReadEnvelope(stream)
+	for err == nil && env.GetPresence() != nil {
+		env, err = framing.ReadEnvelope(stream)
+	}
 	if err != nil {
 		t.Fatalf("Failed to read envelope: %v", err)
 	}
@@ -391,7 +211,7 @@ func TestClientRegistration(t *testing.T) {
 
 	conn, stream := connectClient(t, "alice", addr)
 	defer func() { _ = stream.Close() }()
-	defer func() { _ = conn.CloseWithError(0, "test complete") }()
+	defer func() { _ = conn.Close("test complete") }()
 
 	// If we get here without error, registration succeeded
 	t.Log("Client registered successfully")
@@ -407,31 +227,11 @@ func TestDuplicateIDRejection(t *testing.T) {
 	// Register first client
 	conn1, stream1 := connectClient(t, "alice", addr)
 	defer func() { _ = stream1.Close() }()
-	defer func() { _ = conn1.CloseWithError(0, "test complete") }()
+	defer func() { _ = conn1.Close("test complete") }()
 
 	// Try to register second client with same ID
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"talkers"},
-	}
-
-	quicConfig := &quic.Config{
-		MaxIdleTimeout: 30 * time.Second,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	conn2, err := quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
-	if err != nil {
-		t.Fatalf("Failed to dial server: %v", err)
-	}
-	defer func() { _ = conn2.CloseWithError(0, "test complete") }()
-
-	stream2, err := conn2.OpenStreamSync(ctx)
-	if err != nil {
-		t.Fatalf("Failed to open stream: %v", err)
-	}
+	conn2, stream2 := dialServer(t, addr)
+	defer func() { _ = conn2.Close("test complete") }()
 	defer func() { _ = stream2.Close() }()
 
 	// Send registration with duplicate ID
@@ -459,8 +259,8 @@ func TestMaxClients(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Register 16 clients
-	var conns []*quic.Conn
-	var streams []*quic.Stream
+	var conns []transport.Conn
+	var streams []transport.Stream
 
 	for i := 0; i < 16; i++ {
 		clientID := fmt.Sprintf("client%d", i)
@@ -473,33 +273,13 @@ func TestMaxClients(t *testing.T) {
 	defer func() {
 		for i := range streams {
 			_ = streams[i].Close()
-			_ = conns[i].CloseWithError(0, "test complete")
+			_ = conns[i].Close("test complete")
 		}
 	}()
 
 	// Try to register 17th client
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"talkers"},
-	}
-
-	quicConfig := &quic.Config{
-		MaxIdleTimeout: 30 * time.Second,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	conn17, err := quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
-	if err != nil {
-		t.Fatalf("Failed to dial server: %v", err)
-	}
-	defer func() { _ = conn17.CloseWithError(0, "test complete") }()
-
-	stream17, err := conn17.OpenStreamSync(ctx)
-	if err != nil {
-		t.Fatalf("Failed to open stream: %v", err)
-	}
+	conn17, stream17 := dialServer(t, addr)
+	defer func() { _ = conn17.Close("test complete") }()
 	defer func() { _ = stream17.Close() }()
 
 	// Send registration
@@ -529,21 +309,387 @@ func TestMessageRouting(t *testing.T) {
 	// Register Alice
 	connAlice, streamAlice := connectClient(t, "alice", addr)
 	defer func() { _ = streamAlice.Close() }()
-	defer func() { _ = connAlice.CloseWithError(0, "test complete") }()
+	defer func() { _ = connAlice.Close("test complete") }()
 
 	// Register Bob
 	connBob, streamBob := connectClient(t, "bob", addr)
 	defer func() { _ = streamBob.Close() }()
-	defer func() { _ = connBob.CloseWithError(0, "test complete") }()
+	defer func() { _ = connBob.Close("test complete") }()
 
 	// Allow time for both registrations to complete on server
 	time.Sleep(50 * time.Millisecond)
 
 	// Alice sends message to Bob
-	sendMessage(t, streamAlice, "bob", "Hello Bob!")
+	sendMessage(t, connAlice, "bob", "Hello Bob!")
 
 	// Bob should receive the message
-	expectMessage(t, streamBob, "alice", "Hello Bob!")
+	expectMessage(t, connBob, "alice", "Hello Bob!")
+}
+
+// TestConcurrentMessageStreams verifies a large message and a small message sent
+// back to back are delivered on their own streams, numbered in the order sent
+func TestConcurrentMessageStreams(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connAlice, streamAlice := connectClient(t, "alice", addr)
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+
+	connBob, streamBob := connectClient(t, "bob", addr)
+	defer func() { _ = streamBob.Close() }()
+	defer func() { _ = connBob.Close("test complete") }()
+
+	time.Sleep(50 * time.Millisecond)
+
+	largeContent := strings.Repeat("a", 250000)
+	sendMessage(t, connAlice, "bob", largeContent)
+	sendMessage(t, connAlice, "bob", "small")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	seqs := make(map[string]uint64)
+	for i := 0; i < 2; i++ {
+		stream, err := connBob.AcceptUniStream(ctx)
+		if err != nil {
+			t.Fatalf("Failed to accept message stream: %v", err)
+		}
+		env, err := framing.ReadEnvelope(stream)
+		if err != nil {
+			t.Fatalf("Failed to read envelope: %v", err)
+		}
+		seqs[env.GetMessage().GetContent()] = env.GetMessage().GetSeq()
+	}
+
+	if seqs[largeContent] != 1 || seqs["small"] != 2 {
+		t.Errorf("Expected the large message numbered 1 and the small one 2, got %d and %d", seqs[largeContent], seqs["small"])
+	}
+}
+
+// TestMessageOnControlStreamRejected verifies content sent on the control stream is refused
+func TestMessageOnControlStreamRejected(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connAlice, streamAlice := connectClient(t, "alice", addr)
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+
+	msgEnv := &pb.Envelope{
+		Payload: &pb.Envelope_Message{
+			Message: &pb.Message{
+				ToId:    "alice",
+				Content: "wrong stream",
+			},
+		},
+	}
+	if err := framing.WriteEnvelope(streamAlice, msgEnv); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+
+	expectError(t, streamAlice, errs.ErrUnexpectedMessage)
+}
+
+// sendStream sends a streamed message made of the given chunks on a new stream
+func sendStream(t *testing.T, conn transport.Conn, to, streamID string, chunks ...string) {
+	t.Helper()
+
+	stream, err := conn.OpenUniStream(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open message stream: %v", err)
+	}
+
+	envs := []*pb.Envelope{{
+		Payload: &pb.Envelope_StreamStart{
+			StreamStart: &pb.StreamStart{StreamId: streamID, ToId: to},
+		},
+	}}
+	for _, chunk := range chunks {
+		envs = append(envs, &pb.Envelope{
+			Payload: &pb.Envelope_StreamChunk{
+				StreamChunk: &pb.StreamChunk{StreamId: streamID, Content: chunk},
+			},
+		})
+	}
+	envs = append(envs, &pb.Envelope{
+		Payload: &pb.Envelope_StreamEnd{
+			StreamEnd: &pb.StreamEnd{StreamId: streamID},
+		},
+	})
+
+	for _, env := range envs {
+		if err := framing.WriteEnvelope(stream, env); err != nil {
+			t.Fatalf("Failed to send stream frame: %v", err)
+		}
+	}
+	_ = stream.Close()
+}
+
+// TestStreamedMessage verifies start/chunk/end frames are forwarded to the recipient
+func TestStreamedMessage(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connAlice, streamAlice := connectClient(t, "alice", addr)
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+
+	connBob, streamBob := connectClient(t, "bob", addr)
+	defer func() { _ = streamBob.Close() }()
+	defer func() { _ = connBob.Close("test complete") }()
+
+	time.Sleep(50 * time.Millisecond)
+
+	sendStream(t, connAlice, "bob", "s1", "Hel", "lo ", "Bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := connBob.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept message stream: %v", err)
+	}
+
+	env, err := framing.ReadEnvelope(stream)
+	if err != nil {
+		t.Fatalf("Failed to read envelope: %v", err)
+	}
+	start := env.GetStreamStart()
+	if start == nil || start.FromId != "alice" || start.StreamId != "s1" {
+		t.Fatalf("Expected StreamStart from alice with ID s1, got: %v", env)
+	}
+
+	var content strings.Builder
+	for {
+		env, err := framing.ReadEnvelope(stream)
+		if err != nil {
+			t.Fatalf("Failed to read envelope: %v", err)
+		}
+		if env.GetStreamEnd() != nil {
+			break
+		}
+		content.WriteString(env.GetStreamChunk().GetContent())
+	}
+
+	if content.String() != "Hello Bob" {
+		t.Errorf("Expected content=%q, got %q", "Hello Bob", content.String())
+	}
+}
+
+// TestStreamedContentLimit verifies the content limit applies across all chunks
+func TestStreamedContentLimit(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connAlice, streamAlice := connectClient(t, "alice", addr)
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+
+	connBob, streamBob := connectClient(t, "bob", addr)
+	defer func() { _ = streamBob.Close() }()
+	defer func() { _ = connBob.Close("test complete") }()
+
+	time.Sleep(50 * time.Millisecond)
+
+	half := strings.Repeat("a", 125001)
+	sendStream(t, connAlice, "bob", "s1", half, half)
+
+	expectError(t, streamAlice, errs.ErrContentTooLarge)
+}
+
+// TestStreamedMessageStalled verifies a streamed message that stops sending is
+// abandoned after the chunk timeout, breaking off the recipient's stream
+func TestStreamedMessageStalled(t *testing.T) {
+	tc, err := server.DefaultTransportConfig()
+	if err != nil {
+		t.Fatalf("Failed to create transport config: %v", err)
+	}
+	srv := server.New(server.Config{Addrs: []string{"mem://"}, Transport: tc, ChunkTimeout: 200 * time.Millisecond})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Stop()
+
+	connAlice, streamAlice := connectClient(t, "alice", srv.Addr())
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+	bob := dialTestClient(t, srv.Addr(), "bob", nil)
+	defer func() { _ = bob.Close() }()
+
+	stream, err := connAlice.OpenUniStream(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open message stream: %v", err)
+	}
+	defer stream.Cancel()
+	for _, env := range []*pb.Envelope{
+		{Payload: &pb.Envelope_StreamStart{StreamStart: &pb.StreamStart{StreamId: "s1", ToId: "bob"}}},
+		{Payload: &pb.Envelope_StreamChunk{StreamChunk: &pb.StreamChunk{StreamId: "s1", Content: "Hello"}}},
+	} {
+		if err := framing.WriteEnvelope(stream, env); err != nil {
+			t.Fatalf("Failed to write envelope: %v", err)
+		}
+	}
+
+	expectError(t, streamAlice, errs.ErrStreamStalled)
+	if ev := receiveEvent(t, bob, client.EventStreamError); ev.From != "alice" {
+		t.Errorf("Expected alice's stream to break off, got %+v", ev)
+	}
+}
+
+// TestStreamedAttachment verifies binary data larger than MaxFrameSize is forwarded
+// in chunks along with its content type, file name and metadata
+func TestStreamedAttachment(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connAlice, streamAlice := connectClient(t, "alice", addr)
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+
+	connBob, streamBob := connectClient(t, "bob", addr)
+	defer func() { _ = streamBob.Close() }()
+	defer func() { _ = connBob.Close("test complete") }()
+
+	time.Sleep(50 * time.Millisecond)
+
+	data := make([]byte, framing.MaxFrameSize+100000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	stream, err := connAlice.OpenUniStream(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open message stream: %v", err)
+	}
+	envs := []*pb.Envelope{{
+		Payload: &pb.Envelope_StreamStart{
+			StreamStart: &pb.StreamStart{
+				StreamId:    "a1",
+				ToId:        "bob",
+				ContentType: "application/octet-stream",
+				Filename:    "blob.bin",
+				Metadata:    map[string]string{"purpose": "test"},
+			},
+		},
+	}}
+	for off := 0; off < len(data); off += framing.AttachmentChunkSize {
+		end := min(off+framing.AttachmentChunkSize, len(data))
+		envs = append(envs, &pb.Envelope{
+			Payload: &pb.Envelope_StreamChunk{
+				StreamChunk: &pb.StreamChunk{StreamId: "a1", Data: data[off:end]},
+			},
+		})
+	}
+	envs = append(envs, &pb.Envelope{
+		Payload: &pb.Envelope_StreamEnd{
+			StreamEnd: &pb.StreamEnd{StreamId: "a1"},
+		},
+	})
+
+	// Send while Bob reads; the attachment is larger than the stream flow control windows
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, env := range envs {
+			if err := framing.WriteEnvelope(stream, env); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- stream.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	recv, err := connBob.AcceptUniStream(ctx)
+	if err != nil {
+		t.Fatalf("Failed to accept message stream: %v", err)
+	}
+
+	env, err := framing.ReadEnvelope(recv)
+	if err != nil {
+		t.Fatalf("Failed to read envelope: %v", err)
+	}
+	start := env.GetStreamStart()
+	if start == nil {
+		t.Fatalf("Expected StreamStart, got: %v", env)
+	}
+	if start.Filename != "blob.bin" || start.ContentType != "application/octet-stream" || start.Metadata["purpose"] != "test" {
+		t.Errorf("Attachment attributes not preserved: %v", start)
+	}
+
+	var got []byte
+	for {
+		env, err := framing.ReadEnvelope(recv)
+		if err != nil {
+			t.Fatalf("Failed to read envelope: %v", err)
+		}
+		if env.GetStreamEnd() != nil {
+			break
+		}
+		got = append(got, env.GetStreamChunk().GetData()...)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("Expected %d bytes of attachment data, got %d", len(data), len(got))
+	}
+	if err := <-sendErr; err != nil {
+		t.Errorf("Failed to send stream frame: %v", err)
+	}
+}
+
+// TestCompressionNegotiation verifies the server picks the client's preferred
+// compression and that compressed envelopes are routed intact
+func TestCompressionNegotiation(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	time.Sleep(100 * time.Millisecond)
+
+	connAlice, streamAlice, aliceCompression := connectClientWithCompression(t, "alice", addr, "brotli", "zstd", "gzip")
+	defer func() { _ = streamAlice.Close() }()
+	defer func() { _ = connAlice.Close("test complete") }()
+	if aliceCompression != "zstd" {
+		t.Errorf("Expected zstd to be negotiated, got %q", aliceCompression)
+	}
+
+	connBob, streamBob, bobCompression := connectClientWithCompression(t, "bob", addr, "gzip")
+	defer func() { _ = streamBob.Close() }()
+	defer func() { _ = connBob.Close("test complete") }()
+	if bobCompression != "gzip" {
+		t.Errorf("Expected gzip to be negotiated, got %q", bobCompression)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Alice sends a zstd-compressed message; Bob receives it gzip-compressed
+	content := strings.Repeat("all work and no play ", 10000)
+	stream, err := connAlice.OpenUniStream(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open message stream: %v", err)
+	}
+	msgEnv := &pb.Envelope{
+		Payload: &pb.Envelope_Message{
+			Message: &pb.Message{ToId: "bob", Content: content},
+		},
+	}
+	if err := framing.WriteEnvelopeCompressed(stream, msgEnv, framing.CompressionZstd); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	_ = stream.Close()
+
+	expectMessage(t, connBob, "alice", content)
 }
 
 // TestUnknownDestination verifies error when sending to unregistered client
@@ -556,10 +702,10 @@ func TestUnknownDestination(t *testing.T) {
 	// Register Alice
 	connAlice, streamAlice := connectClient(t, "alice", addr)
 	defer func() { _ = streamAlice.Close() }()
-	defer func() { _ = connAlice.CloseWithError(0, "test complete") }()
+	defer func() { _ = connAlice.Close("test complete") }()
 
 	// Alice sends message to unregistered client
-	sendMessage(t, streamAlice, "charlie", "Hello Charlie!")
+	sendMessage(t, connAlice, "charlie", "Hello Charlie!")
 
 	// Alice should receive error
 	expectError(t, streamAlice, errs.ErrClientNotRegistered)
@@ -575,17 +721,17 @@ func TestOversizedContent(t *testing.T) {
 	// Register Alice and Bob
 	connAlice, streamAlice := connectClient(t, "alice", addr)
 	defer func() { _ = streamAlice.Close() }()
-	defer func() { _ = connAlice.CloseWithError(0, "test complete") }()
+	defer func() { _ = connAlice.Close("test complete") }()
 
 	connBob, streamBob := connectClient(t, "bob", addr)
 	defer func() { _ = streamBob.Close() }()
-	defer func() { _ = connBob.CloseWithError(0, "test complete") }()
+	defer func() { _ = connBob.Close("test complete") }()
 
 	// Create content > 250,000 characters
 	largeContent := strings.Repeat("a", 250001)
 
 	// Alice sends oversized message to Bob
-	sendMessage(t, streamAlice, "bob", largeContent)
+	sendMessage(t, connAlice, "bob", largeContent)
 
 	// Alice should receive error
 	expectError(t, streamAlice, errs.ErrContentTooLarge)
@@ -601,19 +747,19 @@ func TestClientDisconnect(t *testing.T) {
 	// Register Alice and Bob
 	connAlice, streamAlice := connectClient(t, "alice", addr)
 	defer func() { _ = streamAlice.Close() }()
-	defer func() { _ = connAlice.CloseWithError(0, "test complete") }()
+	defer func() { _ = connAlice.Close("test complete") }()
 
 	connBob, streamBob := connectClient(t, "bob", addr)
 
 	// Bob disconnects
 	_ = streamBob.Close()
-	_ = connBob.CloseWithError(0, "client disconnecting")
+	_ = connBob.Close("client disconnecting")
 
 	// Allow server to process disconnection
 	time.Sleep(200 * time.Millisecond)
 
 	// Alice tries to send message to Bob
-	sendMessage(t, streamAlice, "bob", "Hello Bob!")
+	sendMessage(t, connAlice, "bob", "Hello Bob!")
 
 	// Alice should receive error (Bob is no longer registered)
 	expectError(t, streamAlice, errs.ErrClientNotRegistered)
@@ -628,7 +774,7 @@ func TestServerShutdown(t *testing.T) {
 	// Register Alice
 	connAlice, streamAlice := connectClient(t, "alice", addr)
 	defer func() { _ = streamAlice.Close() }()
-	defer func() { _ = connAlice.CloseWithError(0, "test complete") }()
+	defer func() { _ = connAlice.Close("test complete") }()
 
 	// Shutdown server
 	shutdown()
@@ -650,120 +796,68 @@ func TestServerShutdown(t *testing.T) {
 	}
 }
 
-// TestServerShutdownWithSIGINT verifies SIGINT triggers graceful shutdown
+// TestServerShutdownWithSIGINT verifies the shutdown path taken on SIGINT closes
+// client connections on a real QUIC listener
 func TestServerShutdownWithSIGINT(t *testing.T) {
-	// This test starts the actual server binary as a subprocess
-	// Generate self-signed TLS certificate
-	cert, err := tlsutil.GenerateSelfSignedCert()
-	if err != nil {
-		t.Fatalf("Failed to generate TLS certificate: %v", err)
-	}
+	addr, shutdown := startTestServer(t, "quic://127.0.0.1:0")
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		NextProtos:   []string{"talkers"},
-	}
-
-	quicConfig := &quic.Config{
-		MaxIdleTimeout: 30 * time.Second,
-	}
-
-	// Find a free port
-	listener, err := net.Listen("tcp", ":0")
-	if err != nil {
-		t.Fatalf("Failed to find free port: %v", err)
-	}
-	port := listener.Addr().(*net.TCPAddr).Port
-	_ = listener.Close()
-
-	serverAddr := fmt.Sprintf("127.0.0.1:%d", port)
-
-	// Start embedded server
-	registry := NewRegistry()
-	ctx, cancel := context.WithCancel(context.Background())
-	done := make(chan struct{})
-
-	quicListener, err := quic.ListenAddr(serverAddr, tlsConfig, quicConfig)
-	if err != nil {
-		t.Fatalf("Failed to create QUIC listener: %v", err)
-	}
+	// Register client
+	conn, stream := connectClient(t, "alice", addr)
 
-	go func() {
-		defer close(done)
-		for {
-			conn, err := quicListener.Accept(ctx)
-			if err != nil {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					continue
-				}
-			}
-			go handleConnection(ctx, conn, registry)
-		}
-	}()
+	// Simulate SIGINT: the command stops the server on the signal
+	shutdown()
 
-	// Allow server to start
+	// Allow shutdown to propagate
 	time.Sleep(200 * time.Millisecond)
 
-	// Connect clients
-	tlsClientConfig := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"talkers"},
-	}
+	// Try to read from stream - should get error
+	_ = stream.SetReadDeadline(time.Now().Add(1 * time.Second))
+	_, err := framing.ReadEnvelope(stream)
 
-	quicClientConfig := &quic.Config{
-		MaxIdleTimeout: 30 * time.Second,
+	if err == nil {
+		t.Error("Expected error after SIGINT shutdown, got nil")
 	}
 
-	clientCtx, clientCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer clientCancel()
+	_ = stream.Close()
+	_ = conn.Close("test complete")
 
-	conn, err := quic.DialAddr(clientCtx, serverAddr, tlsClientConfig, quicClientConfig)
-	if err != nil {
-		t.Fatalf("Failed to dial server: %v", err)
-	}
+	t.Log("Server shutdown cleanly after SIGINT")
+}
 
-	stream, err := conn.OpenStreamSync(clientCtx)
+// TestCrossTransportRouting verifies one server routes messages between clients
+// connected over different transports
+func TestCrossTransportRouting(t *testing.T) {
+	tc, err := server.DefaultTransportConfig()
 	if err != nil {
-		t.Fatalf("Failed to open stream: %v", err)
+		t.Fatalf("Failed to create transport config: %v", err)
 	}
-
-	// Register client
-	regEnv := &pb.Envelope{
-		Payload: &pb.Envelope_Register{
-			Register: &pb.Register{
-				From: "alice",
-			},
-		},
+	srv := server.New(server.Config{
+		Addrs:     []string{"quic://127.0.0.1:0", "tcp://127.0.0.1:0", "wss://127.0.0.1:0", "mem://"},
+		Transport: tc,
+	})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
 	}
+	defer srv.Stop()
 
-	if err := framing.WriteEnvelope(stream, regEnv); err != nil {
-		t.Fatalf("Failed to send registration: %v", err)
+	addrs := srv.Addrs()
+	ids := []string{"quic-client", "tcp-client", "wss-client", "mem-client"}
+	conns := make([]transport.Conn, len(addrs))
+	for i, addr := range addrs {
+		conn, stream := connectClient(t, ids[i], addr)
+		defer func() { _ = stream.Close() }()
+		defer func() { _ = conn.Close("test complete") }()
+		conns[i] = conn
 	}
 
-	// Simulate SIGINT by canceling context and closing
-	cancel()
-	_ = quicListener.Close()
-	registry.Close()
-
-	// Wait for server to shutdown
-	<-done
-
-	// Allow shutdown to propagate
-	time.Sleep(200 * time.Millisecond)
-
-	// Try to read from stream - should get error
-	_ = stream.SetReadDeadline(time.Now().Add(1 * time.Second))
-	_, err = framing.ReadEnvelope(stream)
-
-	if err == nil {
-		t.Error("Expected error after SIGINT shutdown, got nil")
+	if got := srv.Registry().Count(); got != len(addrs) {
+		t.Fatalf("Expected %d registered clients, got %d", len(addrs), got)
 	}
 
-	_ = stream.Close()
-	_ = conn.CloseWithError(0, "test complete")
-
-	t.Log("Server shutdown cleanly after SIGINT")
+	// Each client sends to the next, wrapping around
+	for i := range conns {
+		next := (i + 1) % len(conns)
+		sendMessage(t, conns[i], ids[next], "hello from "+ids[i])
+		expectMessage(t, conns[next], ids[i], "hello from "+ids[i])
+	}
 }
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/ai"
+	"github.com/dmh2000/talkers/internal/profile"
+)
+
+// writeProfile writes a profile file to dir and returns its path
+func writeProfile(t *testing.T, dir, name, text string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatalf("Failed to write profile: %v", err)
+	}
+	return path
+}
+
+// TestLoadProfile verifies a profile is read over the defaults, with relative
+// paths taken from the profile's directory
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeProfile(t, dir, "alice.yaml", `
+id: alice
+server: tcp://localhost:8080
+model: fake:echo
+system_file: prompts/alice.txt
+generation:
+  temperature: 0.4
+  max_tokens: 256
+reply:
+  to: [bob, "team-*"]
+  approve_timeout: 30s
+limits:
+  max_turns: 5
+ai:
+  record: /tmp/alice.jsonl
+output:
+  schema_file: schemas/reply.json
+`)
+
+	p, err := profile.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p.ID != "alice" || p.Server != "tcp://localhost:8080" || p.Model != "fake:echo" {
+		t.Errorf("Unexpected identity: %+v", p)
+	}
+	if p.SystemFile != filepath.Join(dir, "prompts/alice.txt") {
+		t.Errorf("SystemFile = %q, want it relative to the profile", p.SystemFile)
+	}
+	if p.Output.SchemaFile != filepath.Join(dir, "schemas/reply.json") || p.Output.Retries != ai.DefaultSchemaRetries {
+		t.Errorf("Unexpected output: %+v", p.Output)
+	}
+	if p.AI.Record != "/tmp/alice.jsonl" {
+		t.Errorf("Record = %q, want the absolute path unchanged", p.AI.Record)
+	}
+	if opts := p.Options(); opts.Temperature != 0.4 || opts.MaxTokens != 256 {
+		t.Errorf("Unexpected options: %+v", opts)
+	}
+	if len(p.Reply.To) != 2 || p.Reply.To[1] != "team-*" || p.Reply.ApproveTimeout != 30*time.Second {
+		t.Errorf("Unexpected reply policy: %+v", p.Reply)
+	}
+
+	// Fields left out keep their defaults
+	if p.Limits.MaxTurns != 5 || p.Limits.RepeatWindow != profile.DefaultRepeatWindow ||
+		p.Limits.AITimeout != profile.DefaultAITimeout || p.Attachments != profile.DefaultAttachments {
+		t.Errorf("Unexpected limits: %+v", p.Limits)
+	}
+}
+
+// TestLoadProfileUnknownField verifies misspelled fields are reported
+func TestLoadProfileUnknownField(t *testing.T) {
+	path := writeProfile(t, t.TempDir(), "bad.yaml", "id: alice\ntemprature: 0.5\n")
+	if _, err := profile.Load(path); err == nil || !strings.Contains(err.Error(), "temprature") {
+		t.Errorf("Expected an error naming the unknown field, got %v", err)
+	}
+}
+
+// TestValidateProfile verifies incomplete and conflicting profiles are rejected
+func TestValidateProfile(t *testing.T) {
+	valid := profile.Default()
+	valid.ID, valid.Server, valid.Model, valid.System = "alice", "localhost:8080", "fake:echo", "Be brief."
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Valid profile rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *profile.Profile)
+	}{
+		{"no id", func(p *profile.Profile) { p.ID = "" }},
+		{"long id", func(p *profile.Profile) { p.ID = strings.Repeat("a", profile.MaxIDLength+1) }},
+		{"no server", func(p *profile.Profile) { p.Server = "" }},
+		{"no model", func(p *profile.Profile) { p.Model = "" }},
+		{"no system prompt", func(p *profile.Profile) { p.System = "" }},
+		{"two system prompts", func(p *profile.Profile) { p.SystemFile = "system.txt" }},
+		{"record and replay", func(p *profile.Profile) { p.AI.Record, p.AI.Replay = "a", "b" }},
+		{"negative temperature", func(p *profile.Profile) { p.Generation.Temperature = -1 }},
+		{"unknown strategy", func(p *profile.Profile) { p.Context.Strategy = "forget" }},
+		{"two schemas", func(p *profile.Profile) { p.Output.Schema, p.Output.SchemaFile = "{}", "schema.json" }},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.change(&p)
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	// Without AI only the identity and server are needed
+	plain := profile.Profile{ID: "alice", Server: "localhost:8080", NoAI: true}
+	if err := plain.Validate(); err != nil {
+		t.Errorf("Plain profile rejected: %v", err)
+	}
+}
+
+// TestProfileSystemPrompt verifies inline prompts are parsed as templates
+func TestProfileSystemPrompt(t *testing.T) {
+	p := profile.Profile{ID: "alice", System: "You are {{.Self}}, talking to {{.Peer}}."}
+	prompt, err := p.SystemPrompt()
+	if err != nil {
+		t.Fatalf("SystemPrompt failed: %v", err)
+	}
+	text, err := prompt.Render(ai.PromptVars{Self: "alice", Peer: "bob", Now: time.Now()})
+	if err != nil || text != "You are alice, talking to bob." {
+		t.Errorf("Render = %q, %v", text, err)
+	}
+}
+
+// TestWithOptions verifies generation options replace the caller's options,
+// streamed or not
+func TestWithOptions(t *testing.T) {
+	fake, err := ai.NewFakeClient("fake:template=one two three four five")
+	if err != nil {
+		t.Fatalf("Failed to create fake client: %v", err)
+	}
+	c := ai.WithOptions(fake, llmclient.Options{MaxTokens: 3})
+	ctx := context.Background()
+
+	response, err := ai.AIQuery(ctx, c, "", []string{"hi"}, "fake")
+	if err != nil || response != "one two three" {
+		t.Errorf("AIQuery = %q, %v; want the response cut to 3 tokens", response, err)
+	}
+
+	var streamed strings.Builder
+	response, err = ai.AIQueryStream(ctx, c, "", []string{"hi"}, "fake", func(chunk string) error {
+		streamed.WriteString(chunk)
+		return nil
+	})
+	if err != nil || response != "one two three" || streamed.String() != response {
+		t.Errorf("AIQueryStream = %q (streamed %q), %v", response, streamed.String(), err)
+	}
+}
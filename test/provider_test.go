@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// openAIServer serves OpenAI chat completions answering "Hello there", streamed
+// in three pieces when asked, and records each request. Offered tools, it calls
+// calculate until given a result.
+func openAIServer(t *testing.T) (*httptest.Server, *[]map[string]any) {
+	t.Helper()
+
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+
+		if stream, _ := req["stream"].(bool); stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, piece := range []string{"Hello", " there", ""} {
+				fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": %q}}]}\n\n", piece)
+				w.(http.Flusher).Flush()
+			}
+			fmt.Fprint(w, "data: {\"choices\": [], \"usage\": {\"prompt_tokens\": 12, \"completion_tokens\": 3, \"total_tokens\": 15}}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		messages, _ := req["messages"].([]any)
+		last, _ := messages[len(messages)-1].(map[string]any)
+		if _, ok := req["tools"]; ok && last["role"] != "tool" {
+			fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "tool_calls": [{"id": "c1", "type": "function",
+				"function": {"name": "calculate", "arguments": "{\"expression\": \"6 * 7\"}"}}]}, "finish_reason": "tool_calls"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "Hello there"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}}`)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("OPENAI_API_KEY", "test-key-0123456789abcdef")
+	t.Setenv("OPENAI_BASE_URL", srv.URL)
+	return srv, &requests
+}
+
+// TestProviderClient verifies a provider model streams its response, reports
+// the provider's token counts and is sent the caller's options
+func TestProviderClient(t *testing.T) {
+	_, requests := openAIServer(t)
+
+	client, err := ai.AIClient("gpt-5")
+	if err != nil {
+		t.Fatalf("AIClient failed: %v", err)
+	}
+	if _, ok := client.(ai.StreamingClient); !ok {
+		t.Fatalf("Expected a StreamingClient, got %T", client)
+	}
+
+	var chunks []string
+	response, err := ai.AIQueryStream(context.Background(), client, "be brief", []string{"<alice>\nhi\n</alice>"}, "gpt-5", func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AIQueryStream failed: %v", err)
+	}
+	if response != "Hello there" || len(chunks) != 2 {
+		t.Errorf("Expected the response in 2 chunks, got %q in %q", response, chunks)
+	}
+
+	response, usage, err := client.(ai.StreamingUsageClient).QueryTextStreamUsage(context.Background(), "be brief", []string{"hi"}, "gpt-5", llmclient.Options{}, func(string) error { return nil })
+	if err != nil || response != "Hello there" || usage != (ai.Usage{PromptTokens: 12, CompletionTokens: 3}) {
+		t.Errorf("QueryTextStreamUsage = %q, %+v, %v", response, usage, err)
+	}
+
+	response, usage, err = client.(ai.UsageClient).QueryTextUsage(context.Background(), "be brief", []string{"hi"}, "gpt-5", llmclient.Options{Temperature: 0.5, MaxTokens: 100})
+	if err != nil || response != "Hello there" {
+		t.Fatalf("QueryTextUsage = %q, %v", response, err)
+	}
+	if usage != (ai.Usage{PromptTokens: 12, CompletionTokens: 3}) {
+		t.Errorf("Unexpected usage %+v", usage)
+	}
+	last := (*requests)[len(*requests)-1]
+	if last["temperature"] != 1.0 || last["max_completion_tokens"] != 100.0 {
+		t.Errorf("Options not sent: temperature %v, max tokens %v", last["temperature"], last["max_completion_tokens"])
+	}
+	if _, err := client.QueryText(context.Background(), "", []string{"hi"}, "claude-sonnet-4", llmclient.Options{}); err == nil {
+		t.Error("Expected a model of another provider to be rejected")
+	}
+}
+
+// TestProviderClientTools verifies a provider model is offered the tools natively
+// and given the results of the calls it makes
+func TestProviderClientTools(t *testing.T) {
+	_, requests := openAIServer(t)
+	tools, _ := newTestTools(t)
+
+	client, err := ai.AIClient("gpt-5")
+	if err != nil {
+		t.Fatalf("AIClient failed: %v", err)
+	}
+	var calls []string
+	loop := &ai.ToolLoop{Tools: tools, OnCall: func(call ai.ToolCall, result ai.ToolResult) {
+		calls = append(calls, call.ID+" "+call.Name+"="+result.Content)
+	}}
+	reply, err := loop.Query(context.Background(), client, "be brief", []string{"what is 6*7?"}, "gpt-5")
+	if err != nil || reply != "Hello there" {
+		t.Fatalf("Query = %q, %v", reply, err)
+	}
+	if len(calls) != 1 || calls[0] != "c1 calculate=42" {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(*requests))
+	}
+	offered, _ := (*requests)[0]["tools"].([]any)
+	if len(offered) != len(tools.List()) {
+		t.Errorf("Expected %d tools offered, got %v", len(tools.List()), (*requests)[0]["tools"])
+	}
+	messages, _ := (*requests)[1]["messages"].([]any)
+	result, _ := messages[len(messages)-1].(map[string]any)
+	if result["role"] != "tool" || result["tool_call_id"] != "c1" || result["content"] != "42" {
+		t.Errorf("Result not sent back: %v", result)
+	}
+}
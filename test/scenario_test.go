@@ -0,0 +1,215 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/talkers/client"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/profile"
+	"github.com/dmh2000/talkers/internal/scenario"
+)
+
+// TestLoadScenario verifies agents may be written inline or taken from a profile
+// file with fields overridden
+func TestLoadScenario(t *testing.T) {
+	dir := t.TempDir()
+	writeProfile(t, dir, "alice.yaml", `
+id: alice
+server: tcp://elsewhere:4434
+model: fake:echo
+system: Be brief.
+limits:
+  max_turns: 9
+`)
+	path := writeProfile(t, dir, "debate.yaml", `
+name: debate
+agents:
+  - profile: alice.yaml
+    limits:
+      max_turns: 2
+  - id: bob
+    model: fake:echo
+    system_file: bob.txt
+opening:
+  from: alice
+  to: bob
+  text: hello
+stop:
+  idle: 2s
+transcript: out.txt
+`)
+
+	s, err := scenario.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if s.Name != "debate" || len(s.Agents) != 2 || s.Stop.Idle != 2*time.Second {
+		t.Fatalf("Unexpected scenario: %+v", s)
+	}
+	alice, bob := s.Agents[0], s.Agents[1]
+	if alice.Limits.MaxTurns != 2 || alice.System != "Be brief." || alice.Server != "tcp://elsewhere:4434" {
+		t.Errorf("Unexpected alice: %+v", alice)
+	}
+	if bob.Server != "" || bob.SystemFile != filepath.Join(dir, "bob.txt") {
+		t.Errorf("Unexpected bob: %+v", bob)
+	}
+	if s.Transcript != filepath.Join(dir, "out.txt") {
+		t.Errorf("Transcript = %q", s.Transcript)
+	}
+
+	// The opening message must have a sender and a recipient
+	bad := writeProfile(t, dir, "bad.yaml", "agents:\n  - {id: bob, model: fake:echo, system: hi}\nopening: {to: bob, text: hi}\n")
+	if _, err := scenario.Load(bad); err == nil {
+		t.Error("Expected an error for an opening message without a sender")
+	}
+}
+
+// agentProfile returns a default profile for the agent id answering with model
+func agentProfile(id, model string) profile.Profile {
+	p := profile.Default()
+	p.ID, p.Model, p.System = id, model, "You are {{.Self}}."
+	return p
+}
+
+// fakeScenario returns a scenario of two fake agents, alice opening to bob
+func fakeScenario() *scenario.Scenario {
+	s := &scenario.Scenario{
+		Name:    "test",
+		Opening: scenario.Opening{From: "alice", To: "bob", Text: "hello"},
+		Stop:    scenario.Stop{Idle: 200 * time.Millisecond, Timeout: 10 * time.Second},
+	}
+	for _, spec := range []struct{ id, model string }{
+		{"alice", "fake:template=alice {{.Turn}}"},
+		{"bob", "fake:template=bob {{.Turn}}"},
+	} {
+		p := agentProfile(spec.id, spec.model)
+		p.Limits.MaxTurns = 2
+		s.Agents = append(s.Agents, p)
+	}
+	return s
+}
+
+// TestRunScenario runs two agents on an embedded server until their turn limits
+// leave the conversation idle
+func TestRunScenario(t *testing.T) {
+	var live []scenario.Entry
+	tr, err := scenario.Run(context.Background(), fakeScenario(), &scenario.RunOptions{
+		Logf:    t.Logf,
+		OnEntry: func(e scenario.Entry) { live = append(live, e) },
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var got []string
+	for _, e := range tr.Entries() {
+		got = append(got, e.From+">"+e.To+":"+e.Text)
+	}
+	want := "alice>bob:hello bob>alice:bob 1 alice>bob:alice 1 bob>alice:bob 2 alice>bob:alice 2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Transcript = %q, want %q", strings.Join(got, " "), want)
+	}
+	if len(live) != len(got) {
+		t.Errorf("OnEntry saw %d entries, want %d", len(live), len(got))
+	}
+	if !strings.HasPrefix(tr.Reason, "idle") {
+		t.Errorf("Reason = %q, want idle", tr.Reason)
+	}
+
+	var text bytes.Buffer
+	if err := tr.WriteText(&text); err != nil || !strings.Contains(text.String(), "alice -> bob: alice 2") {
+		t.Errorf("Unexpected text transcript %q, %v", text.String(), err)
+	}
+	var jsonl bytes.Buffer
+	if err := tr.WriteJSON(&jsonl); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var first scenario.Entry
+	if err := json.Unmarshal(bytes.SplitN(jsonl.Bytes(), []byte("\n"), 2)[0], &first); err != nil || first.Text != "hello" {
+		t.Errorf("Unexpected first JSON entry %+v, %v", first, err)
+	}
+}
+
+// TestRunScenarioLimits verifies a run stops at its message limit, and that an
+// opening sender outside the scenario is connected to send it
+func TestRunScenarioLimits(t *testing.T) {
+	s := fakeScenario()
+	s.Opening.From = "moderator"
+	s.Opening.To = "alice"
+	s.Stop = scenario.Stop{MaxMessages: 2, Timeout: 10 * time.Second}
+
+	tr, err := scenario.Run(context.Background(), s, &scenario.RunOptions{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	entries := tr.Entries()
+	if len(entries) != 2 || tr.Reason != "reached 2 messages" {
+		t.Fatalf("Got %d entries, reason %q", len(entries), tr.Reason)
+	}
+	if entries[0].From != "moderator" || entries[1].From != "alice" || entries[1].To != "moderator" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+// TestRunScenarioRemote verifies agents can join a server started elsewhere
+func TestRunScenarioRemote(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	// A participant outside the run sees the conversation's opening
+	carol := dialTestClient(t, addr, "carol", nil)
+	defer func() { _ = carol.Close() }()
+
+	s := fakeScenario()
+	s.Server = addr
+	s.Opening.To = "carol"
+	s.Stop = scenario.Stop{Timeout: 300 * time.Millisecond}
+
+	tr, err := scenario.Run(context.Background(), s, &scenario.RunOptions{Logf: t.Logf})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	msg := receiveMessage(t, carol)
+	if msg.From != "alice" || msg.Content != "hello" {
+		t.Errorf("carol received %+v", msg)
+	}
+	if entries := tr.Entries(); len(entries) != 1 || entries[0].To != "carol" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+	if !strings.HasPrefix(tr.Reason, "timed out") {
+		t.Errorf("Reason = %q", tr.Reason)
+	}
+}
+
+// TestPolicyAnswers verifies senders are matched against the reply policy
+func TestPolicyAnswers(t *testing.T) {
+	policy, err := agent.NewPolicy("bot", []string{"team-*", "alice"}, []string{"team-x"}, true)
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+	tests := []struct {
+		msg  client.Message
+		want bool
+	}{
+		{client.Message{From: "alice", Content: "hi @bot"}, true},
+		{client.Message{From: "team-a", Content: "@bot hello"}, true},
+		{client.Message{From: "team-x", Content: "@bot hello"}, false},
+		{client.Message{From: "bob", Content: "@bot hello"}, false},
+		{client.Message{From: "alice", Content: "no mention"}, false},
+	}
+	for _, tt := range tests {
+		if got := policy.Answers(&tt.msg); got != tt.want {
+			t.Errorf("Answers(%s: %q) = %v, want %v", tt.msg.From, tt.msg.Content, got, tt.want)
+		}
+	}
+
+	if _, err := agent.NewPolicy("bot", []string{"["}, nil, false); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,196 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// moodSchema is the schema the structured output tests reply with
+const moodSchema = `{
+	"type": "object",
+	"properties": {
+		"mood": {"enum": ["happy", "sad"]},
+		"score": {"type": "integer", "minimum": 0, "maximum": 10},
+		"tags": {"type": "array", "items": {"type": "string", "minLength": 1}, "maxItems": 2}
+	},
+	"required": ["mood"],
+	"additionalProperties": false
+}`
+
+// TestSchemaValidate verifies replies are checked against the schema
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ai.ParseSchema("mood", []byte(moodSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	for reply, want := range map[string]string{
+		`{"mood": "happy"}`:                           "",
+		`{"mood": "sad", "score": 10, "tags": ["a"]}`: "",
+		`{"mood": "happy", "score": 2.0}`:             "",
+		`{"score": 1}`:                                `missing required property "mood"`,
+		`{"mood": "angry"}`:                           `$.mood: "angry" is not one of`,
+		`{"mood": "happy", "score": 1.5}`:             "$.score: expected integer, got number",
+		`{"mood": "happy", "score": 11}`:              "greater than the maximum",
+		`{"mood": "happy", "tags": ["a", ""]}`:        "$.tags[1]: expected at least 1 characters",
+		`{"mood": "happy", "tags": ["a", "b", "c"]}`:  "at most 2 items",
+		`{"mood": "happy", "extra": true}`:            `unexpected property "extra"`,
+		`["happy"]`:                                   "$: expected object, got array",
+		`{"mood": "happy"} {}`:                        "more than one value",
+		`mood: happy`:                                 "invalid JSON",
+	} {
+		err := schema.Validate([]byte(reply))
+		switch {
+		case want == "" && err != nil:
+			t.Errorf("Validate(%s) failed: %v", reply, err)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Errorf("Validate(%s) = %v, want an error containing %q", reply, err, want)
+		}
+	}
+
+	for _, bad := range []string{`[]`, `{"type": "text"}`, `{"properties": {"a": 1}}`, `{"pattern": "("}`, `{"minItems": -1}`} {
+		if _, err := ai.ParseSchema("bad", []byte(bad)); err == nil {
+			t.Errorf("ParseSchema(%s) should fail", bad)
+		}
+	}
+}
+
+// TestExtractJSON verifies JSON is found in replies that wrap it
+func TestExtractJSON(t *testing.T) {
+	for response, want := range map[string]string{
+		`{"a": 1}`:                      `{"a": 1}`,
+		"```json\n{\"a\": 1}\n```":      `{"a": 1}`,
+		"Here it is:\n{\"a\": 1}\nDone": `{"a": 1}`,
+		"List: [1, 2]":                  `[1, 2]`,
+		"no json":                       "no json",
+	} {
+		if got := ai.ExtractJSON(response); got != want {
+			t.Errorf("ExtractJSON(%q) = %q, want %q", response, got, want)
+		}
+	}
+}
+
+// TestStructuredQuery verifies a reply that does not match is asked for again
+// with the problem, and that one that never matches fails
+func TestStructuredQuery(t *testing.T) {
+	schema, err := ai.ParseSchema("mood", []byte(moodSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+	model := &scriptedClient{responses: []string{`{"mood": "angry"}`, "```json\n{\"mood\": \"sad\",\n \"score\": 3}\n```"}}
+	reply, err := ai.AIQueryJSON(context.Background(), model, "You are bob.", []string{"<alice>\nhow are you?\n</alice>"}, "m", schema)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if reply != `{"mood":"sad","score":3}` {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+	if !strings.HasPrefix(model.systems[0], "You are bob.") || !strings.Contains(model.systems[0], `"required":["mood"]`) {
+		t.Errorf("Schema not given in system prompt: %q", model.systems[0])
+	}
+	if retry := model.prompts[1]; len(retry) != 3 || !strings.Contains(retry[1], "angry") || !strings.Contains(retry[2], "is not one of") {
+		t.Errorf("Problem not fed back: %q", retry)
+	}
+
+	q := &ai.StructuredQuery{Schema: schema, Retries: 1}
+	invalid := 0
+	q.OnInvalid = func(string, error) { invalid++ }
+	_, err = q.Query(context.Background(), "system", nil, func(ctx context.Context, system string, prompts []string) (string, error) {
+		return "I feel fine", nil
+	})
+	if !errors.Is(err, ai.ErrSchemaMismatch) || invalid != 2 {
+		t.Errorf("Expected ErrSchemaMismatch after 2 replies, got %v after %d", err, invalid)
+	}
+}
+
+// TestAgentStructuredReply verifies an agent with an output schema sends its
+// validated reply as JSON
+func TestAgentStructuredReply(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	script := filepath.Join(t.TempDir(), "bob.txt")
+	if err := os.WriteFile(script, []byte("I am happy\n---\n{\"mood\": \"happy\", \"score\": 7}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	p := agentProfile("bob", "fake:script="+script)
+	p.Server = addr
+	p.Output.Schema = moodSchema
+
+	logs := &logRecorder{}
+	bob, err := agent.New(p, agent.Hooks{Logf: logs.logf})
+	if err != nil {
+		t.Fatalf("agent.New failed: %v", err)
+	}
+	if err := bob.Start(context.Background(), nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer bob.Close()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer alice.Close()
+	send(t, alice, "bob", "how are you?")
+
+	msg := receiveMessage(t, alice)
+	if !msg.IsJSON() || msg.Content != `{"mood":"happy","score":7}` {
+		t.Errorf("Expected a JSON reply, got %q (%s)", msg.Content, msg.ContentType)
+	}
+	if !logs.contains("does not match the schema") {
+		t.Error("Expected the invalid reply to be reported")
+	}
+}
+
+// TestAgentReviewedEdit verifies an edit that does not match the output schema is
+// refused and the same draft shown again, without querying the model
+func TestAgentReviewedEdit(t *testing.T) {
+	addr, shutdown := startTestServer(t)
+	defer shutdown()
+
+	script := filepath.Join(t.TempDir(), "bob.txt")
+	if err := os.WriteFile(script, []byte("{\"mood\": \"happy\", \"score\": 7}\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	p := agentProfile("bob", "fake:script="+script)
+	p.Server = addr
+	p.Output.Schema = moodSchema
+
+	var drafts []string
+	var problems []error
+	review := func(ctx context.Context, peer, draft string, problem error) agent.Decision {
+		drafts, problems = append(drafts, draft), append(problems, problem)
+		if len(drafts) == 1 {
+			return agent.Decision{Action: agent.Edit, Text: `{"mood": "angry"}`}
+		}
+		return agent.Decision{Action: agent.Approve}
+	}
+	bob, err := agent.New(p, agent.Hooks{Review: review, Logf: (&logRecorder{}).logf})
+	if err != nil {
+		t.Fatalf("agent.New failed: %v", err)
+	}
+	if err := bob.Start(context.Background(), nil); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer bob.Close()
+
+	alice := dialTestClient(t, addr, "alice", nil)
+	defer alice.Close()
+	send(t, alice, "bob", "how are you?")
+
+	msg := receiveMessage(t, alice)
+	if msg.Content != `{"mood":"happy","score":7}` {
+		t.Errorf("Expected the model's draft, got %q", msg.Content)
+	}
+	if len(drafts) != 2 || drafts[1] != drafts[0] || problems[0] != nil || problems[1] == nil {
+		t.Errorf("Expected the draft shown again with the problem, got %q, %v", drafts, problems)
+	}
+	if queries := bob.Ledger().Total().Queries; queries != 1 {
+		t.Errorf("Expected 1 model query, got %d", queries)
+	}
+}
@@ -0,0 +1,210 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// scriptedClient answers queries with its responses in turn and records each query
+type scriptedClient struct {
+	responses []string
+	systems   []string
+	prompts   [][]string
+}
+
+func (c *scriptedClient) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	c.systems = append(c.systems, system)
+	c.prompts = append(c.prompts, prompts)
+	response := c.responses[min(len(c.prompts), len(c.responses))-1]
+	return response, nil
+}
+
+func (*scriptedClient) Close() error { return nil }
+
+// nativeToolClient calls calculate once through the ToolClient interface, then
+// replies with the result it was given
+type nativeToolClient struct {
+	fixedClient
+	offered [][]ai.Tool
+	options []llmclient.Options
+}
+
+func (c *nativeToolClient) QueryTextTools(ctx context.Context, system string, prompts []string, model string, options llmclient.Options, tools []ai.Tool, rounds []ai.ToolRound) (string, []ai.ToolCall, error) {
+	c.offered = append(c.offered, tools)
+	c.options = append(c.options, options)
+	if len(rounds) == 0 {
+		return "", []ai.ToolCall{{ID: "t1", Name: "calculate", Arguments: json.RawMessage(`{"expression": "6 * 7"}`)}}, nil
+	}
+	return "it is " + rounds[0].Results[0].Content, nil, nil
+}
+
+// newTestTools returns the built-in tools reading from a directory holding notes.txt
+func newTestTools(t *testing.T) (*ai.Tools, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("the launch code is 1234"), 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	roster := func(ctx context.Context) ([]string, error) { return []string{"alice", "bob"}, nil }
+	tools, err := agent.BuiltinTools(agent.BuiltinToolNames, dir, roster)
+	if err != nil {
+		t.Fatalf("BuiltinTools failed: %v", err)
+	}
+	return tools, dir
+}
+
+// TestToolLoopText verifies tool calls written in the response are run and their
+// results fed back before the reply
+func TestToolLoopText(t *testing.T) {
+	tools, _ := newTestTools(t)
+	model := &scriptedClient{responses: []string{
+		`Let me check. <tool_call>{"name": "calculate", "arguments": {"expression": "6 * 7"}}</tool_call>
+<tool_call>{"name": "read_file", "arguments": {"path": "notes.txt"}}</tool_call>
+<tool_call>{"name": "list_clients", "arguments": {}}</tool_call>`,
+		"The answer is 42.",
+	}}
+
+	var calls []string
+	loop := &ai.ToolLoop{Tools: tools, OnCall: func(call ai.ToolCall, result ai.ToolResult) {
+		calls = append(calls, call.Name+"="+result.Content)
+	}}
+	reply, err := loop.Query(context.Background(), model, "be brief", []string{"<bob>\nwhat is 6*7?\n</bob>"}, "m")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if reply != "The answer is 42." {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+	if len(calls) != 3 || calls[0] != "calculate=42" || calls[1] != "read_file=the launch code is 1234" || calls[2] != "list_clients=alice\nbob" {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	// The tools are described to the model and the results fed back
+	if !strings.Contains(model.systems[0], "calculate: Evaluate") || !strings.HasPrefix(model.systems[0], "be brief") {
+		t.Errorf("Tools not described in system prompt: %q", model.systems[0])
+	}
+	second := model.prompts[1]
+	if len(second) != 7 || !strings.Contains(second[2], "calculate result:\n42") || !strings.Contains(second[4], "1234") {
+		t.Errorf("Results not fed back: %q", second)
+	}
+}
+
+// TestToolLoopNative verifies a ToolClient is given the tools directly
+func TestToolLoopNative(t *testing.T) {
+	tools, _ := newTestTools(t)
+	model := &nativeToolClient{}
+	reply, err := ai.AIQueryTools(context.Background(), model, "system", []string{"question"}, "m", tools)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if reply != "it is 42" {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+	if len(model.offered) != 2 || len(model.offered[0]) != len(agent.BuiltinToolNames) {
+		t.Errorf("Unexpected tools offered: %v", model.offered)
+	}
+
+	// The tools and the caller's options pass through the clients wrapping it
+	model = &nativeToolClient{}
+	ledger := ai.NewLedger(nil, 0)
+	options := llmclient.Options{Temperature: 0.3, MaxTokens: 200}
+	loop := &ai.ToolLoop{Tools: tools, Options: llmclient.Options{MaxTokens: 5}}
+	reply, err = loop.Query(context.Background(), ai.WithOptions(ai.NewMeter(model, ledger), options), "system", []string{"question"}, "m")
+	if err != nil || reply != "it is 42" {
+		t.Fatalf("Query through wrappers = %q, %v", reply, err)
+	}
+	if len(model.offered) != 2 || model.options[0] != options {
+		t.Errorf("Expected native calls with %+v, got %d queries with %+v", options, len(model.offered), model.options)
+	}
+	if ledger.Total().Queries != 2 {
+		t.Errorf("Expected the meter to record 2 queries, got %+v", ledger.Total())
+	}
+
+	// Without wrappers the loop's own options are used
+	model = &nativeToolClient{}
+	loop.Options = options
+	if _, err := loop.Query(context.Background(), model, "system", []string{"question"}, "m"); err != nil || model.options[0] != options {
+		t.Errorf("Expected loop options %+v, got %+v (%v)", options, model.options, err)
+	}
+}
+
+// TestToolLoopRounds verifies a model that keeps calling tools is told to reply,
+// and fails if it still calls one
+func TestToolLoopRounds(t *testing.T) {
+	tools, _ := newTestTools(t)
+	model := &scriptedClient{responses: []string{`<tool_call>{"name": "calculate", "arguments": {"expression": "1"}}</tool_call>`}}
+	loop := &ai.ToolLoop{Tools: tools, MaxRounds: 2}
+	if _, err := loop.Query(context.Background(), model, "system", nil, "m"); !errors.Is(err, ai.ErrToolRounds) {
+		t.Fatalf("Expected ErrToolRounds, got %v", err)
+	}
+	if len(model.systems) != 3 || strings.Contains(model.systems[2], "tool_call") {
+		t.Errorf("Expected a final query without tools, got %d queries", len(model.systems))
+	}
+}
+
+// TestToolCallErrors verifies bad calls give failed results the model can see
+func TestToolCallErrors(t *testing.T) {
+	tools, _ := newTestTools(t)
+	ctx := context.Background()
+	calls := ai.ParseToolCalls(`<tool_call>{"name": "nope"}</tool_call>
+<tool_call>{"name": "calculate", "arguments": {}}</tool_call>
+<tool_call>not json</tool_call>
+<tool_call>{"name": "read_file", "arguments": {"path": "../secret"}}</tool_call>
+<tool_call>{"name": "calculate", "arguments": {"expression": "1/0"}}</tool_call>
+<tool_call>{"name": "calculate", "arguments": {"expression": 42}}</tool_call>`)
+	if len(calls) != 6 {
+		t.Fatalf("Expected 6 calls, got %d", len(calls))
+	}
+	for i, want := range []string{"unknown tool", "missing required property", "invalid tool call", "", "division by zero", "invalid arguments"} {
+		result := tools.Call(ctx, calls[i])
+		if !result.IsError || !strings.Contains(result.Content, want) {
+			t.Errorf("Call %d: expected a failure containing %q, got %+v", i, want, result)
+		}
+	}
+
+	if err := tools.Register(ai.Tool{Name: "bad name", Handler: func(context.Context, json.RawMessage) (string, error) { return "", nil }}); err == nil {
+		t.Error("Expected an invalid tool name to be rejected")
+	}
+	if _, err := agent.BuiltinTools([]string{"read_file"}, "", nil); err == nil {
+		t.Error("Expected read_file without a directory to be rejected")
+	}
+	if _, err := agent.BuiltinTools([]string{"list_clients"}, "", nil); err == nil {
+		t.Error("Expected list_clients without a roster to be rejected")
+	}
+	if err := tools.Register(ai.Tool{Name: "bad_schema", Schema: json.RawMessage(`{"type": "thing"}`), Handler: func(context.Context, json.RawMessage) (string, error) { return "", nil }}); err == nil {
+		t.Error("Expected an invalid schema to be rejected")
+	}
+}
+
+// TestCalculate verifies the calculator's arithmetic
+func TestCalculate(t *testing.T) {
+	for expr, want := range map[string]float64{
+		"1 + 2 * 3":       7,
+		"(1 + 2) * 3":     9,
+		"7 / 2":           3.5,
+		"-4 + 10 % 3":     -3,
+		"sqrt(16) + 0.5":  4.5,
+		"pow(2, 10)":      1024,
+		"round(pi * 100)": 314,
+	} {
+		got, err := agent.Calculate(expr)
+		if err != nil || got != want {
+			t.Errorf("Calculate(%q) = %v, %v; want %v", expr, got, err, want)
+		}
+	}
+	for _, expr := range []string{"os.Exit(1)", "x + 1", `"a"`, "sqrt(1, 2)"} {
+		if _, err := agent.Calculate(expr); err == nil {
+			t.Errorf("Calculate(%q) should fail", expr)
+		}
+	}
+}
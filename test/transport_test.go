@@ -0,0 +1,238 @@
+package test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmh2000/talkers/internal/framing"
+	pb "github.com/dmh2000/talkers/internal/proto"
+	"github.com/dmh2000/talkers/internal/tlsutil"
+	"github.com/dmh2000/talkers/internal/transport"
+)
+
+// transportConfigs returns matching server and client configurations
+func transportConfigs(t *testing.T) (server, client *transport.Config) {
+	t.Helper()
+
+	cert, err := tlsutil.GenerateSelfSignedCert()
+	if err != nil {
+		t.Fatalf("Failed to generate TLS certificate: %v", err)
+	}
+
+	server = &transport.Config{
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"talkers"},
+		},
+		IdleTimeout: 30 * time.Second,
+	}
+	client = &transport.Config{
+		TLS: &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"talkers"},
+		},
+		IdleTimeout: 30 * time.Second,
+	}
+	return server, client
+}
+
+// TestTransports verifies control and message streams behave the same on every transport
+func TestTransports(t *testing.T) {
+	for _, scheme := range []string{"quic", "tcp", "ws", "wss"} {
+		t.Run(scheme, func(t *testing.T) {
+			serverCfg, clientCfg := transportConfigs(t)
+
+			listenAddr := scheme + "://127.0.0.1:0"
+			listener, err := transport.Listen(listenAddr, serverCfg)
+			if err != nil {
+				t.Fatalf("Listen failed: %v", err)
+			}
+			defer func() { _ = listener.Close() }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The server echoes the control stream envelope back and returns
+			// each message stream's content on a new message stream
+			serverDone := make(chan error, 1)
+			go func() {
+				conn, err := listener.Accept(ctx)
+				if err != nil {
+					serverDone <- err
+					return
+				}
+				control, err := conn.AcceptStream(ctx)
+				if err != nil {
+					serverDone <- err
+					return
+				}
+				env, err := framing.ReadEnvelope(control)
+				if err != nil {
+					serverDone <- err
+					return
+				}
+				if err := framing.WriteEnvelope(control, env); err != nil {
+					serverDone <- err
+					return
+				}
+
+				in, err := conn.AcceptUniStream(ctx)
+				if err != nil {
+					serverDone <- err
+					return
+				}
+				env, err = framing.ReadEnvelope(in)
+				if err != nil {
+					serverDone <- err
+					return
+				}
+				out, err := conn.OpenUniStream(ctx)
+				if err != nil {
+					serverDone <- err
+					return
+				}
+				if err := framing.WriteEnvelope(out, env); err != nil {
+					serverDone <- err
+					return
+				}
+				serverDone <- out.Close()
+			}()
+
+			conn, err := transport.Dial(ctx, scheme+"://"+listener.Addr().String(), clientCfg)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer func() { _ = conn.Close("test complete") }()
+
+			control, err := conn.OpenStream(ctx)
+			if err != nil {
+				t.Fatalf("OpenStream failed: %v", err)
+			}
+			regEnv := &pb.Envelope{
+				Payload: &pb.Envelope_Register{
+					Register: &pb.Register{From: "alice"},
+				},
+			}
+			if err := framing.WriteEnvelope(control, regEnv); err != nil {
+				t.Fatalf("Failed to write control envelope: %v", err)
+			}
+			echo, err := framing.ReadEnvelope(control)
+			if err != nil {
+				t.Fatalf("Failed to read control envelope: %v", err)
+			}
+			if echo.GetRegister().GetFrom() != "alice" {
+				t.Errorf("Expected echoed Register from alice, got: %v", echo)
+			}
+
+			// A message larger than one multiplexer window exercises flow control
+			content := strings.Repeat("x", 200000)
+			out, err := conn.OpenUniStream(ctx)
+			if err != nil {
+				t.Fatalf("OpenUniStream failed: %v", err)
+			}
+			msgEnv := &pb.Envelope{
+				Payload: &pb.Envelope_Message{
+					Message: &pb.Message{ToId: "bob", Content: content},
+				},
+			}
+			if err := framing.WriteEnvelope(out, msgEnv); err != nil {
+				t.Fatalf("Failed to write message: %v", err)
+			}
+			_ = out.Close()
+
+			in, err := conn.AcceptUniStream(ctx)
+			if err != nil {
+				t.Fatalf("AcceptUniStream failed: %v", err)
+			}
+			env, err := framing.ReadEnvelope(in)
+			if err != nil {
+				t.Fatalf("Failed to read message: %v", err)
+			}
+			if env.GetMessage().GetContent() != content {
+				t.Errorf("Message content mismatch over %s", scheme)
+			}
+
+			if err := <-serverDone; err != nil {
+				t.Fatalf("Server side failed: %v", err)
+			}
+		})
+	}
+}
+
+// TestUnknownTransport verifies an unregistered scheme is rejected
+func TestUnknownTransport(t *testing.T) {
+	_, err := transport.Listen("carrier-pigeon://127.0.0.1:0", &transport.Config{})
+	if err == nil {
+		t.Fatal("Expected error for unknown transport scheme, got nil")
+	}
+}
+
+// TestStreamCancel verifies a canceled message stream reads as an error on every
+// transport, so a receiver never mistakes an abandoned message for a complete one
+func TestStreamCancel(t *testing.T) {
+	for _, scheme := range []string{"quic", "tcp", "ws"} {
+		t.Run(scheme, func(t *testing.T) {
+			serverCfg, clientCfg := transportConfigs(t)
+
+			listener, err := transport.Listen(scheme+"://127.0.0.1:0", serverCfg)
+			if err != nil {
+				t.Fatalf("Listen failed: %v", err)
+			}
+			defer func() { _ = listener.Close() }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			accepted := make(chan transport.Conn, 1)
+			go func() {
+				conn, err := listener.Accept(ctx)
+				if err == nil {
+					accepted <- conn
+				}
+				close(accepted)
+			}()
+
+			conn, err := transport.Dial(ctx, scheme+"://"+listener.Addr().String(), clientCfg)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer func() { _ = conn.Close("test complete") }()
+			peer, ok := <-accepted
+			if !ok {
+				t.Fatal("Accept failed")
+			}
+			defer func() { _ = peer.Close("test complete") }()
+
+			for _, canceled := range []bool{false, true} {
+				out, err := conn.OpenUniStream(ctx)
+				if err != nil {
+					t.Fatalf("OpenUniStream failed: %v", err)
+				}
+				if _, err := out.Write([]byte("partial")); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+				if canceled {
+					out.Cancel()
+				} else {
+					_ = out.Close()
+				}
+
+				in, err := peer.AcceptUniStream(ctx)
+				if err != nil {
+					t.Fatalf("AcceptUniStream failed: %v", err)
+				}
+				_, err = io.ReadAll(in)
+				if canceled && err == nil {
+					t.Error("Expected a canceled stream to read as an error")
+				}
+				if !canceled && err != nil {
+					t.Errorf("Expected a closed stream to read to EOF, got: %v", err)
+				}
+			}
+		})
+	}
+}
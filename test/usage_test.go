@@ -0,0 +1,150 @@
+package test
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	llmclient "github.com/dmh2000/go-llmclient"
+	"github.com/dmh2000/talkers/internal/agent"
+	"github.com/dmh2000/talkers/internal/ai"
+)
+
+// fixedClient answers every query with the same response and reports no usage
+type fixedClient string
+
+func (c fixedClient) QueryText(ctx context.Context, system string, prompts []string, model string, options llmclient.Options) (string, error) {
+	return string(c), nil
+}
+
+func (fixedClient) Close() error { return nil }
+
+// TestMeterUsage verifies reported usage is charged to the query's conversation
+func TestMeterUsage(t *testing.T) {
+	fake, err := ai.NewFakeClient("fake:template=one two three")
+	if err != nil {
+		t.Fatalf("Failed to create fake client: %v", err)
+	}
+	ledger := ai.NewLedger(map[string]ai.Price{"m": {Input: 1, Output: 2}}, 0)
+	meter := ai.NewMeter(fake, ledger)
+
+	ctx := ai.WithConversation(context.Background(), "bob")
+	if _, err := ai.AIQuery(ctx, meter, "be brief", []string{"hi there"}, "m"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	bob := ledger.Conversation("bob")
+	if bob.Queries != 1 || bob.PromptTokens != 4 || bob.CompletionTokens != 3 || bob.Estimated {
+		t.Errorf("Unexpected usage for bob: %+v", bob)
+	}
+	if want := (4*1 + 3*2) / 1e6; math.Abs(bob.Cost-want) > 1e-12 {
+		t.Errorf("Cost = %v, want %v", bob.Cost, want)
+	}
+	if ledger.Conversation("carol").Queries != 0 {
+		t.Error("Expected no spend for carol")
+	}
+}
+
+// TestMeterUsageFailover verifies the usage reported by the model reaches the
+// ledger through an agent's failover and recorder, streamed or not, and is priced
+// at the rate of the model that answered
+func TestMeterUsageFailover(t *testing.T) {
+	primary, fallback := "fake:template=one two three?fail-first=1", "fake:template=four five"
+	client, err := agent.NewAIClient(primary, filepath.Join(t.TempDir(), "cassette.jsonl"), "", false, ai.FailoverConfig{
+		Fallbacks:   []string{fallback},
+		MaxAttempts: 1,
+		Logf:        func(string, ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("NewAIClient failed: %v", err)
+	}
+	defer client.Close()
+	ledger := ai.NewLedger(map[string]ai.Price{primary: {Input: 1, Output: 2}, fallback: {Input: 10, Output: 20}}, 0)
+	meter := ai.NewMeter(client, ledger)
+
+	// The primary fails its first query, so the fallback streams the reply
+	ctx := ai.WithConversation(context.Background(), "bob")
+	response, err := ai.AIQueryStream(ctx, meter, "be brief", []string{"hi there"}, primary, func(string) error { return nil })
+	if err != nil || response != "four five" {
+		t.Fatalf("AIQueryStream = %q, %v", response, err)
+	}
+	bob := ledger.Conversation("bob")
+	if bob.Queries != 1 || bob.PromptTokens != 4 || bob.CompletionTokens != 2 || bob.Estimated {
+		t.Errorf("Unexpected usage of the fallback: %+v", bob)
+	}
+	if want := (4*10 + 2*20) / 1e6; math.Abs(bob.Cost-want) > 1e-12 {
+		t.Errorf("Cost = %v, want the fallback's %v", bob.Cost, want)
+	}
+
+	// The primary answers the next query at its own rate
+	if _, err := ai.AIQuery(ai.WithConversation(context.Background(), "carol"), meter, "be brief", []string{"hi there"}, primary); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	carol := ledger.Conversation("carol")
+	if carol.PromptTokens != 4 || carol.CompletionTokens != 3 || carol.Estimated {
+		t.Errorf("Unexpected usage of the primary: %+v", carol)
+	}
+	if want := (4*1 + 3*2) / 1e6; math.Abs(carol.Cost-want) > 1e-12 {
+		t.Errorf("Cost = %v, want the primary's %v", carol.Cost, want)
+	}
+}
+
+// TestMeterEstimate verifies usage is estimated for clients that do not report it,
+// including streamed queries
+func TestMeterEstimate(t *testing.T) {
+	ledger := ai.NewLedger(nil, 0)
+	meter := ai.NewMeter(fixedClient("a reply of some length"), ledger)
+	ctx := ai.WithConversation(context.Background(), "bob")
+
+	if _, err := ai.AIQuery(ctx, meter, "system", []string{"question"}, "claude-sonnet-4"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if _, err := ai.AIQueryStream(ctx, meter, "system", []string{"question"}, "claude-sonnet-4", func(string) error { return nil }); err != nil {
+		t.Fatalf("Streamed query failed: %v", err)
+	}
+
+	total := ledger.Total()
+	if total.Queries != 2 || !total.Estimated || total.PromptTokens == 0 || total.CompletionTokens == 0 {
+		t.Errorf("Unexpected estimated usage: %+v", total)
+	}
+	if total.Cost <= 0 {
+		t.Errorf("Expected a cost from the default price of claude-sonnet-4, got %v", total.Cost)
+	}
+}
+
+// TestLedgerCeiling verifies the spend ceiling
+func TestLedgerCeiling(t *testing.T) {
+	ledger := ai.NewLedger(map[string]ai.Price{"m": {Input: 1e6}}, 2)
+	ledger.Add("bob", "m", ai.Usage{PromptTokens: 1})
+	if ledger.OverBudget() {
+		t.Error("Ledger over budget after $1 of $2")
+	}
+	ledger.Add("carol", "m", ai.Usage{PromptTokens: 1})
+	if !ledger.OverBudget() {
+		t.Error("Ledger not over budget after $2 of $2")
+	}
+	if keys := ledger.Keys(); len(keys) != 2 || keys[0] != "bob" {
+		t.Errorf("Unexpected conversation keys %v", keys)
+	}
+}
+
+// TestLoadPrices verifies a price file overrides and extends the defaults
+func TestLoadPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	data := `{"claude-sonnet-4": {"input": 1, "output": 2}, "local-model": {"input": 0.1, "output": 0.1}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write price file: %v", err)
+	}
+	prices, err := ai.LoadPrices(path)
+	if err != nil {
+		t.Fatalf("LoadPrices failed: %v", err)
+	}
+	if prices["claude-sonnet-4"].Output != 2 || prices["local-model"].Input != 0.1 || prices["gpt-5"].Input == 0 {
+		t.Errorf("Unexpected prices: %v", prices)
+	}
+	if ai.DefaultPrices["claude-sonnet-4"].Output != 15 {
+		t.Error("LoadPrices modified DefaultPrices")
+	}
+}